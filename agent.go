@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // BaseNode represents the basic node structure in the agent framework
 type BaseNode struct {
+	name       string
 	params     map[string]interface{}
 	successors map[string]interface{}
 }
@@ -27,6 +31,21 @@ func (b *BaseNode) SetParams(params map[string]interface{}) {
 	b.params = params
 }
 
+// SetName sets the name the node is reported under by flows and hooks
+func (b *BaseNode) SetName(name string) {
+	b.name = name
+}
+
+// Name returns the name set with SetName, or "" if none was set
+func (b *BaseNode) Name() string {
+	return b.name
+}
+
+// baseNode gives the flow access to the embedded BaseNode of custom node types
+func (b *BaseNode) baseNode() *BaseNode {
+	return b
+}
+
 // Next adds a successor node for a specific action
 func (b *BaseNode) Next(node interface{}, action string) interface{} {
 	if action == "" {
@@ -39,6 +58,11 @@ func (b *BaseNode) Next(node interface{}, action string) interface{} {
 	return node
 }
 
+// Actions returns the actions that have a successor, sorted
+func (b *BaseNode) Actions() []string {
+	return sortedActions(b)
+}
+
 // Prep prepares the node for execution
 func (b *BaseNode) Prep(shared map[string]interface{}) interface{} {
 	return nil
@@ -74,6 +98,169 @@ func (b *BaseNode) runInternal(shared map[string]interface{}) interface{} {
 	return b.Post(shared, prepRes, execRes)
 }
 
+// Runnable is the node lifecycle a Flow drives. Any type embedding *BaseNode,
+// directly or through Node, BatchNode or Flow, satisfies it, and Prep, Exec,
+// Post and ExecFallback defined on the outer type are the ones that run.
+type Runnable interface {
+	SetParams(params map[string]interface{})
+	Prep(shared map[string]interface{}) interface{}
+	Exec(prepRes interface{}) interface{}
+	Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{}
+	baseNode() *BaseNode
+}
+
+// NodeName returns the name a node is reported under: the name given with
+// SetName, or else its type name
+func NodeName(node interface{}) string {
+	if r, ok := node.(Runnable); ok && r.baseNode().name != "" {
+		return r.baseNode().name
+	}
+	t := reflect.TypeOf(node)
+	if t == nil {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// actionName converts a Post result into the action used for transitions
+func actionName(action interface{}) string {
+	switch v := action.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// runNode runs the full lifecycle of a node, or orchestrates it if it is a
+// flow. emit, when not nil, receives the node's Exec events. cache, when not
+// nil, may supply the node's Exec result and keeps new ones.
+func runNode(node Runnable, shared map[string]interface{}, emit func(Event), cache ExecCache) interface{} {
+	prepRes := node.Prep(shared)
+	var execRes interface{}
+	if sub, ok := node.(interface {
+		orchestrate(map[string]interface{}, map[string]interface{}) interface{}
+	}); ok {
+		execRes = sub.orchestrate(shared, nil)
+	} else {
+		execRes = execCached(node, prepRes, emit, cache)
+	}
+	return node.Post(shared, prepRes, execRes)
+}
+
+// execCached returns the cached Exec result of a node for prepRes, or runs
+// the node and caches its result unless it failed
+func execCached(node Runnable, prepRes interface{}, emit func(Event), cache ExecCache) interface{} {
+	if cache == nil {
+		return execNode(node, prepRes, emit)
+	}
+	name := NodeName(node)
+	key := cache.Key(name, prepRes)
+	if key == "" {
+		return execNode(node, prepRes, emit)
+	}
+	if execRes, ok := cache.Get(key); ok {
+		if emit != nil {
+			emit(Event{Type: CacheHit, Node: name})
+		}
+		return execRes
+	}
+	if emit != nil {
+		emit(Event{Type: CacheMiss, Node: name})
+	}
+	execRes := execNode(node, prepRes, emit)
+	if _, failed := execRes.(error); !failed && execRes != nil {
+		cache.Set(key, execRes)
+	}
+	return execRes
+}
+
+// execNode runs Exec once per item for batch nodes and once otherwise
+func execNode(node Runnable, prepRes interface{}, emit func(Event)) interface{} {
+	if b, ok := node.(interface{ isBatch() bool }); ok && b.isBatch() {
+		items, _ := prepRes.([]interface{})
+		results := make([]interface{}, len(items))
+		for i, item := range items {
+			results[i] = execWithRetry(node, item, emit)
+		}
+		return results
+	}
+	return execWithRetry(node, prepRes, emit)
+}
+
+// execWithRetry calls Exec, treating a panic as a failed attempt. Nodes that
+// embed *Node are retried according to their settings and fall back to
+// ExecFallback once all attempts failed. emit, when not nil, receives an
+// ExecAttempt event per attempt, a RetryScheduled event per retry and an
+// ExecFailed event when the last attempt failed.
+func execWithRetry(node Runnable, prepRes interface{}, emit func(Event)) interface{} {
+	var n *Node
+	if r, ok := node.(interface{ retryNode() *Node }); ok {
+		n = r.retryNode()
+	}
+	maxRetries := 1
+	if n != nil && n.maxRetries > 1 {
+		maxRetries = n.maxRetries
+	}
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if n != nil {
+			n.curRetry = attempt
+		}
+		if emit != nil {
+			emit(Event{Type: ExecAttempt, Node: NodeName(node), Attempt: attempt + 1})
+		}
+		result, err := safeExec(node, prepRes)
+		if err == nil {
+			return result
+		}
+
+		if attempt == maxRetries-1 {
+			if emit != nil {
+				emit(Event{Type: ExecFailed, Node: NodeName(node), Attempt: attempt + 1, Error: err.Error()})
+			}
+			if fb, ok := node.(interface {
+				ExecFallback(interface{}, error) interface{}
+			}); ok {
+				return fb.ExecFallback(prepRes, err)
+			}
+			return err
+		}
+
+		var wait time.Duration
+		if n != nil {
+			wait = n.wait
+		}
+		if emit != nil {
+			emit(Event{Type: RetryScheduled, Node: NodeName(node), Attempt: attempt + 1, Wait: wait, Error: err.Error()})
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	return nil
+}
+
+// safeExec calls Exec and converts a panic into an error
+func safeExec(node Runnable, prepRes interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch v := r.(type) {
+			case error:
+				err = v
+			default:
+				err = fmt.Errorf("%v", v)
+			}
+		}
+	}()
+	return node.Exec(prepRes), nil
+}
+
 // ConditionalTransition represents a transition with a specific action
 type conditionalTransition struct {
 	src    *BaseNode
@@ -110,6 +297,11 @@ func NewNode(maxRetries int, wait time.Duration) *Node {
 	}
 }
 
+// retryNode exposes the retry settings of custom node types to the flow
+func (n *Node) retryNode() *Node {
+	return n
+}
+
 // ExecFallback handles execution failures
 func (n *Node) ExecFallback(prepRes interface{}, err error) interface{} {
 	return err
@@ -158,6 +350,11 @@ func NewBatchNode(maxRetries int, wait time.Duration) *BatchNode {
 	}
 }
 
+// isBatch tells the flow to run Exec once per item of the prep result
+func (b *BatchNode) isBatch() bool {
+	return true
+}
+
 // ExecInternal processes each item in the batch
 func (b *BatchNode) execInternal(items interface{}) interface{} {
 	if items == nil {
@@ -176,10 +373,45 @@ func (b *BatchNode) execInternal(items interface{}) interface{} {
 	return results
 }
 
+// Hook observes the nodes run by a Flow and may redirect it
+type Hook interface {
+	// BeforeNode is called before a node runs. Returning a non-empty action
+	// skips the node and transitions on that action instead.
+	BeforeNode(name string, shared map[string]interface{}) string
+	// AfterNode is called after a node runs with the action it returned, and
+	// returns the action the flow should transition on.
+	AfterNode(name string, shared map[string]interface{}, action string) string
+}
+
+// AbortHook is a Hook that is told when a node ends without an action,
+// because it suspended the flow or panicked. AfterNode is not called for
+// such a node, so hooks that hold something from BeforeNode to AfterNode
+// release it in AbortNode.
+type AbortHook interface {
+	Hook
+	AbortNode(name string, shared map[string]interface{})
+}
+
+// ExecCache lets a flow reuse the Exec results of earlier runs instead of
+// executing nodes again
+type ExecCache interface {
+	// Key returns the key a node's Exec result for prepRes is cached under,
+	// or "" when the node should not be cached
+	Key(node string, prepRes interface{}) string
+	// Get returns the result cached under key
+	Get(key string) (interface{}, bool)
+	// Set caches a successful Exec result under key
+	Set(key string, execRes interface{})
+}
+
 // Flow orchestrates the execution of multiple nodes
 type Flow struct {
 	*BaseNode
 	startNode interface{}
+	hooks     []Hook
+	cache     ExecCache
+	observers []*observer
+	stream    func(Event)
 }
 
 // NewFlow creates a new Flow instance
@@ -196,6 +428,18 @@ func (f *Flow) Start(start interface{}) interface{} {
 	return start
 }
 
+// Use registers hooks that run around every node of the flow, in order
+func (f *Flow) Use(hooks ...Hook) {
+	f.hooks = append(f.hooks, hooks...)
+}
+
+// Cache makes the flow look up the Exec results of its nodes in cache before
+// running them. Nodes of nested flows are not cached. Lookups are reported
+// as CacheHit and CacheMiss events.
+func (f *Flow) Cache(cache ExecCache) {
+	f.cache = cache
+}
+
 // GetNextNode determines the next node based on the current node and action
 func (f *Flow) GetNextNode(curr *BaseNode, action string) interface{} {
 	if action == "" {
@@ -213,51 +457,265 @@ func (f *Flow) GetNextNode(curr *BaseNode, action string) interface{} {
 	return next
 }
 
+// Suspension is returned by a node's Post to pause its flow, for example
+// until a human has made a decision. The flow stops and returns the
+// Suspension; Flow.Resume continues it later from the suspended node.
+type Suspension struct {
+	// Node is the name of the suspended node; the flow fills it in
+	Node string
+	// Path names the nested flows that enclose Node, outermost first; the
+	// flows fill it in. It is empty when Node belongs to the flow that
+	// returned the Suspension.
+	Path []string
+	// Reason describes what the flow is waiting for
+	Reason interface{}
+}
+
 // orchestrate manages the flow of execution through nodes
 func (f *Flow) orchestrate(shared map[string]interface{}, params map[string]interface{}) interface{} {
 	if f.startNode == nil {
 		return nil
 	}
 
-	if params == nil {
-		params = make(map[string]interface{})
-		for k, v := range f.params {
-			params[k] = v
-		}
-	}
-
 	// Deep copy of startNode would be implemented here
 	// For simplicity, we're using the original node
-	curr, ok := f.startNode.(*BaseNode)
+	curr, ok := f.startNode.(Runnable)
 	if !ok {
+		log.Printf("Warning: Flow start node %T is not a node", f.startNode)
 		return nil
 	}
+	return f.walk(curr, shared, f.runParams(params))
+}
+
+// runParams returns params, or a copy of the flow's own params when nil
+func (f *Flow) runParams(params map[string]interface{}) map[string]interface{} {
+	if params != nil {
+		return params
+	}
+	params = make(map[string]interface{})
+	for k, v := range f.params {
+		params[k] = v
+	}
+	return params
+}
 
+// walk runs nodes from curr, following the actions they return, until a node
+// has no successor for its action or suspends the flow
+func (f *Flow) walk(curr Runnable, shared map[string]interface{}, params map[string]interface{}) interface{} {
 	var lastAction interface{}
 	for curr != nil {
 		curr.SetParams(params)
-		lastAction = curr.runInternal(shared)
+		name := NodeName(curr)
 
-		nextNode := f.GetNextNode(curr, fmt.Sprintf("%v", lastAction))
-		if nextNode == nil {
-			break
+		action, skipped := "", false
+		for _, h := range f.hooks {
+			if a := h.BeforeNode(name, shared); a != "" {
+				action, skipped = a, true
+				break
+			}
 		}
-
-		nextBaseNode, ok := nextNode.(*BaseNode)
-		if !ok {
-			break
+		if skipped {
+			lastAction = action
+			f.emit(Event{Type: NodeCompleted, Node: name, Action: action, Skipped: true})
+		} else {
+			f.emit(Event{Type: NodeStarted, Node: name})
+			lastAction = f.runHooked(curr, name, shared)
+			if s, ok := lastAction.(*Suspension); ok {
+				f.abortNode(name, shared)
+				if _, nested := curr.(*Flow); nested {
+					s.Path = append([]string{name}, s.Path...)
+				} else if s.Node == "" {
+					s.Node = name
+				}
+				f.emit(Event{Type: NodeCompleted, Node: name, Action: "suspended"})
+				return s
+			}
+			action = actionName(lastAction)
+			f.emit(Event{Type: NodeCompleted, Node: name, Action: action})
 		}
-		curr = nextBaseNode
+
+		var next Runnable
+		next, lastAction = f.advance(curr, name, shared, action, lastAction)
+		curr = next
 	}
 
 	return lastAction
 }
 
+// runHooked runs curr, telling AbortHooks about a panic before passing it on
+func (f *Flow) runHooked(curr Runnable, name string, shared map[string]interface{}) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			f.abortNode(name, shared)
+			panic(r)
+		}
+	}()
+	return runNode(curr, shared, f.emitter(), f.cache)
+}
+
+// abortNode tells the AbortHooks that the node named name ended without an
+// action
+func (f *Flow) abortNode(name string, shared map[string]interface{}) {
+	for _, h := range f.hooks {
+		if a, ok := h.(AbortHook); ok {
+			a.AbortNode(name, shared)
+		}
+	}
+}
+
+// advance runs the AfterNode hooks for a finished node and returns its
+// successor for the resulting action, or nil when the flow ends
+func (f *Flow) advance(curr Runnable, name string, shared map[string]interface{}, action string, lastAction interface{}) (Runnable, interface{}) {
+	for _, h := range f.hooks {
+		if a := h.AfterNode(name, shared, action); a != action {
+			action, lastAction = a, a
+		}
+	}
+
+	nextNode := f.GetNextNode(curr.baseNode(), action)
+	if nextNode == nil {
+		return nil, lastAction
+	}
+
+	next, ok := nextNode.(Runnable)
+	if !ok {
+		log.Printf("Warning: Flow ends: successor %T for '%s' is not a node", nextNode, action)
+		return nil, lastAction
+	}
+	f.emit(Event{Type: Transition, Node: name, Action: action, Next: NodeName(next)})
+	return next, lastAction
+}
+
+// emitter returns emit when the flow has observers, or nil
+func (f *Flow) emitter() func(Event) {
+	if len(f.observers) == 0 && f.stream == nil {
+		return nil
+	}
+	return f.emit
+}
+
+// FindNode returns the node named name among the nodes reachable from the
+// flow's start node, or nil. Nodes inside nested flows are not searched.
+func (f *Flow) FindNode(name string) Runnable {
+	var found Runnable
+	f.visit(func(node Runnable) {
+		if found == nil && NodeName(node) == name {
+			found = node
+		}
+	})
+	return found
+}
+
+// FindPath returns the names of the nested flows that lead to the node named
+// name, outermost first, searching this flow before the nested ones. It
+// reports false when no such node is reachable.
+func (f *Flow) FindPath(name string) ([]string, bool) {
+	if f.FindNode(name) != nil {
+		return nil, true
+	}
+	var path []string
+	found := false
+	f.visit(func(node Runnable) {
+		if nested, ok := node.(*Flow); ok && !found {
+			if p, ok := nested.FindPath(name); ok {
+				path, found = append([]string{NodeName(nested)}, p...), true
+			}
+		}
+	})
+	return path, found
+}
+
+// Locate returns the node named name inside the nested flows named by path,
+// outermost first, or nil
+func (f *Flow) Locate(path []string, name string) Runnable {
+	if len(path) == 0 {
+		return f.FindNode(name)
+	}
+	nested, ok := f.FindNode(path[0]).(*Flow)
+	if !ok {
+		return nil
+	}
+	return nested.Locate(path[1:], name)
+}
+
+// Resume continues a suspended flow: the node named nodeName is treated as
+// having returned action, and the flow goes on from its successor. shared
+// should hold the state the flow had when it was suspended. A node inside a
+// nested flow is found by name too, the first match winning; use
+// ResumeSuspension when names are not unique across nested flows.
+func (f *Flow) Resume(shared map[string]interface{}, nodeName string, action string) interface{} {
+	path, ok := f.FindPath(nodeName)
+	if !ok {
+		log.Printf("Warning: cannot resume flow: node %q not found", nodeName)
+		return nil
+	}
+	return f.resume(shared, path, nodeName, action)
+}
+
+// ResumeSuspension continues the flow suspended with s, as Resume does, from
+// the node named by s.Path and s.Node
+func (f *Flow) ResumeSuspension(shared map[string]interface{}, s *Suspension, action string) interface{} {
+	if f.Locate(s.Path, s.Node) == nil {
+		log.Printf("Warning: cannot resume flow: node %q not found", strings.Join(append(append([]string(nil), s.Path...), s.Node), "/"))
+		return nil
+	}
+	return f.resume(shared, s.Path, s.Node, action)
+}
+
+// resume continues the flow from the node named nodeName inside the nested
+// flows named by path, which must exist. A nested flow finishes its own run
+// first, and its result becomes its action in this flow.
+func (f *Flow) resume(shared map[string]interface{}, path []string, nodeName string, action string) interface{} {
+	f.emit(Event{Type: FlowStarted, Node: nodeName, Action: action})
+	prepRes := f.Prep(shared)
+	params := f.runParams(nil)
+
+	name := nodeName
+	if len(path) > 0 {
+		name = path[0]
+	}
+	node := f.FindNode(name)
+	var result interface{} = action
+	if nested, ok := node.(*Flow); ok && len(path) > 0 {
+		result = nested.resume(shared, path[1:], nodeName, action)
+		if s, ok := result.(*Suspension); ok {
+			s.Path = append([]string{name}, s.Path...)
+			f.emit(Event{Type: NodeCompleted, Node: name, Action: "suspended"})
+			result = f.Post(shared, prepRes, s)
+			f.finished(shared, result)
+			return result
+		}
+		action = actionName(result)
+		f.emit(Event{Type: NodeCompleted, Node: name, Action: action})
+	}
+
+	next, result := f.advance(node, name, shared, action, result)
+	if next != nil {
+		result = f.walk(next, shared, params)
+	}
+	result = f.Post(shared, prepRes, result)
+	f.finished(shared, result)
+	return result
+}
+
+// Run executes the flow from its start node and returns the last action
+func (f *Flow) Run(shared map[string]interface{}) interface{} {
+	return f.runInternal(shared)
+}
+
 // runInternal executes the flow
 func (f *Flow) runInternal(shared map[string]interface{}) interface{} {
+	return f.runWith(shared, nil)
+}
+
+// runWith executes the flow with params in place of its own when not nil
+func (f *Flow) runWith(shared map[string]interface{}, params map[string]interface{}) interface{} {
+	f.emit(Event{Type: FlowStarted})
 	prepRes := f.Prep(shared)
-	orchRes := f.orchestrate(shared, nil)
-	return f.Post(shared, prepRes, orchRes)
+	orchRes := f.orchestrate(shared, params)
+	result := f.Post(shared, prepRes, orchRes)
+	f.finished(shared, result)
+	return result
 }
 
 // Post processes the results after flow execution
@@ -305,6 +763,347 @@ func (b *BatchFlow) runInternal(shared map[string]interface{}) interface{} {
 	return b.Post(shared, prepRes, nil)
 }
 
+// SubFlow runs a child Flow as a single node of a parent flow. The child gets
+// its own shared map holding only the keys the SubFlow reads, and only the
+// keys it writes are copied back, optionally under other names. The child's
+// final action is mapped to an action of the parent, so a reusable sub-agent
+// can be wired in without knowing the parent's keys or actions.
+//
+// Values are copied shallowly: a map or slice read into the child is the
+// same map or slice the parent holds. Hooks registered on the parent do not
+// run for the child's nodes; register them on the child flow as well.
+//
+// The child's scope is not kept once it ends, so a child flow cannot be
+// suspended and resumed: a Suspension from the child sets shared["error"]
+// and makes the SubFlow return "error". Nest the Flow itself to suspend
+// inside it.
+type SubFlow struct {
+	*BaseNode
+	flow    *Flow
+	inputs  map[string]string // parent key -> child key
+	outputs map[string]string // child key -> parent key
+	actions map[string]string // child action -> parent action
+	passed  []string          // parent params passed to the child
+}
+
+// NewSubFlow wraps flow as a node
+func NewSubFlow(flow *Flow) *SubFlow {
+	return &SubFlow{
+		BaseNode: NewBaseNode(),
+		flow:     flow,
+		inputs:   make(map[string]string),
+		outputs:  make(map[string]string),
+		actions:  make(map[string]string),
+	}
+}
+
+// Reads copies the given parent keys into the child scope under the same names
+func (s *SubFlow) Reads(keys ...string) *SubFlow {
+	for _, k := range keys {
+		s.inputs[k] = k
+	}
+	return s
+}
+
+// ReadAs copies parentKey into the child scope as childKey
+func (s *SubFlow) ReadAs(parentKey, childKey string) *SubFlow {
+	s.inputs[parentKey] = childKey
+	return s
+}
+
+// Writes copies the given child keys back to the parent under the same names
+func (s *SubFlow) Writes(keys ...string) *SubFlow {
+	for _, k := range keys {
+		s.outputs[k] = k
+	}
+	return s
+}
+
+// WriteAs copies childKey back to the parent as parentKey
+func (s *SubFlow) WriteAs(childKey, parentKey string) *SubFlow {
+	s.outputs[childKey] = parentKey
+	return s
+}
+
+// MapAction makes the SubFlow return parentAction when the child flow ends
+// on childAction. Unmapped actions are returned unchanged.
+func (s *SubFlow) MapAction(childAction, parentAction string) *SubFlow {
+	s.actions[childAction] = parentAction
+	return s
+}
+
+// PassParams passes the named parameters of the parent flow on to the child
+// flow, which otherwise runs with its own parameters only
+func (s *SubFlow) PassParams(keys ...string) *SubFlow {
+	s.passed = append(s.passed, keys...)
+	return s
+}
+
+// subFlowRun is what a SubFlow hands from Prep to Exec and from Exec to Post
+type subFlowRun struct {
+	scope  map[string]interface{}
+	params map[string]interface{}
+	action interface{}
+}
+
+// Prep builds the child scope from the parent's shared map
+func (s *SubFlow) Prep(shared map[string]interface{}) interface{} {
+	scope := make(map[string]interface{}, len(s.inputs))
+	for parentKey, childKey := range s.inputs {
+		if v, ok := shared[parentKey]; ok {
+			scope[childKey] = v
+		}
+	}
+	// The passed params are for this run only; the child flow keeps its own
+	var params map[string]interface{}
+	if len(s.passed) > 0 {
+		params = s.flow.runParams(nil)
+		for _, k := range s.passed {
+			if v, ok := s.params[k]; ok {
+				params[k] = v
+			}
+		}
+	}
+	return &subFlowRun{scope: scope, params: params}
+}
+
+// Exec runs the child flow in its scope
+func (s *SubFlow) Exec(prepRes interface{}) interface{} {
+	run, ok := prepRes.(*subFlowRun)
+	if !ok {
+		return fmt.Errorf("sub-flow: invalid prep result %T", prepRes)
+	}
+	run.action = s.flow.runWith(run.scope, run.params)
+	return run
+}
+
+// Post copies the written keys back to the parent and maps the child's action
+func (s *SubFlow) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	run, ok := execRes.(*subFlowRun)
+	if !ok {
+		log.Printf("Warning: sub-flow %s failed: %v", NodeName(s), execRes)
+		return "error"
+	}
+	if susp, ok := run.action.(*Suspension); ok {
+		err := fmt.Sprintf("sub-flow %s cannot be suspended, but node %q suspended it", NodeName(s), susp.Node)
+		log.Printf("Warning: %s", err)
+		shared["error"] = err
+		return "error"
+	}
+	for childKey, parentKey := range s.outputs {
+		if v, ok := run.scope[childKey]; ok {
+			shared[parentKey] = v
+		}
+	}
+	action := actionName(run.action)
+	if mapped, ok := s.actions[action]; ok {
+		return mapped
+	}
+	return run.action
+}
+
+// MapFunc processes one chunk of a MapReduceNode's input
+type MapFunc func(chunk interface{}) (interface{}, error)
+
+// ReduceFunc combines partial results into one. With tree reduction its
+// output is fed back in as a partial, so it must accept its own results.
+type ReduceFunc func(partials []interface{}) (interface{}, error)
+
+// MapReduceNode splits an input from the shared map into chunks, runs Map on
+// the chunks in parallel and combines the results with Reduce. It suits
+// inputs too large for one LLM call, such as summarizing every page of a set
+// of search results.
+type MapReduceNode struct {
+	*BaseNode
+	// InputKey and OutputKey name the shared input and the reduced result
+	InputKey  string
+	OutputKey string
+	// Split turns the input into chunks; SplitItems when nil
+	Split  func(input interface{}) []interface{}
+	Map    MapFunc
+	Reduce ReduceFunc
+	// Concurrency bounds the Map and Reduce calls in flight (4 when unset)
+	Concurrency int
+	// FanIn, when above 1, reduces the partials in groups of FanIn and then
+	// reduces the group results, level by level, until one result remains
+	FanIn int
+	// Action is returned from Post on success ("default" when empty);
+	// failures set shared["error"] and return "error"
+	Action string
+}
+
+// NewMapReduceNode creates a MapReduceNode reading shared[inputKey] and
+// writing shared[outputKey]
+func NewMapReduceNode(inputKey, outputKey string, mapFn MapFunc, reduceFn ReduceFunc) *MapReduceNode {
+	return &MapReduceNode{
+		BaseNode:  NewBaseNode(),
+		InputKey:  inputKey,
+		OutputKey: outputKey,
+		Map:       mapFn,
+		Reduce:    reduceFn,
+	}
+}
+
+// SplitItems treats slices as their items and anything else as one chunk
+func SplitItems(input interface{}) []interface{} {
+	switch v := input.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return items
+	default:
+		return []interface{}{v}
+	}
+}
+
+// SplitText returns a Split function that packs the paragraphs of a string
+// input into chunks of at most maxChars characters. Longer paragraphs are cut
+// at spaces, or between characters when a word is longer than maxChars.
+// maxChars below 1 counts as 1.
+func SplitText(maxChars int) func(input interface{}) []interface{} {
+	maxChars = max(maxChars, 1)
+	return func(input interface{}) []interface{} {
+		text, ok := input.(string)
+		if !ok {
+			return SplitItems(input)
+		}
+		var chunks []interface{}
+		current := ""
+		add := func(piece string) {
+			if current != "" && utf8.RuneCountInString(current)+2+utf8.RuneCountInString(piece) > maxChars {
+				chunks = append(chunks, current)
+				current = ""
+			}
+			if current == "" {
+				current = piece
+			} else {
+				current += "\n\n" + piece
+			}
+		}
+		for _, para := range strings.Split(text, "\n\n") {
+			para = strings.TrimSpace(para)
+			if para == "" {
+				continue
+			}
+			for utf8.RuneCountInString(para) > maxChars {
+				// Byte offset of the first character past the limit
+				end := 0
+				for i := 0; i < maxChars; i++ {
+					_, size := utf8.DecodeRuneInString(para[end:])
+					end += size
+				}
+				cut := strings.LastIndex(para[:end], " ")
+				if cut <= 0 {
+					cut = end
+				}
+				add(strings.TrimSpace(para[:cut]))
+				para = strings.TrimSpace(para[cut:])
+			}
+			add(para)
+		}
+		if current != "" {
+			chunks = append(chunks, current)
+		}
+		return chunks
+	}
+}
+
+// Prep splits the input into chunks
+func (m *MapReduceNode) Prep(shared map[string]interface{}) interface{} {
+	split := m.Split
+	if split == nil {
+		split = SplitItems
+	}
+	return split(shared[m.InputKey])
+}
+
+// Exec maps the chunks and reduces the results, returning an error if any
+// call fails
+func (m *MapReduceNode) Exec(prepRes interface{}) interface{} {
+	chunks, _ := prepRes.([]interface{})
+	partials, err := m.parallel(len(chunks), func(i int) (interface{}, error) {
+		return m.Map(chunks[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	for m.FanIn > 1 && len(partials) > m.FanIn {
+		groups := (len(partials) + m.FanIn - 1) / m.FanIn
+		level := partials
+		partials, err = m.parallel(groups, func(i int) (interface{}, error) {
+			end := (i + 1) * m.FanIn
+			if end > len(level) {
+				end = len(level)
+			}
+			return m.Reduce(level[i*m.FanIn : end])
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := m.Reduce(partials)
+	if err != nil {
+		return fmt.Errorf("reduce: %w", err)
+	}
+	return result
+}
+
+// parallel calls fn for 0..n-1 with bounded concurrency and returns the
+// results in order, or the first error
+func (m *MapReduceNode) parallel(n int, fn func(i int) (interface{}, error)) ([]interface{}, error) {
+	limit := m.Concurrency
+	if limit <= 0 {
+		limit = 4
+	}
+	results := make([]interface{}, n)
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			results[i], errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
+
+// Post stores the result under OutputKey
+func (m *MapReduceNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if err, ok := execRes.(error); ok {
+		log.Printf("Warning: map-reduce %s failed: %v", NodeName(m), err)
+		shared["error"] = err.Error()
+		return "error"
+	}
+	shared[m.OutputKey] = execRes
+	if m.Action == "" {
+		return "default"
+	}
+	return m.Action
+}
+
 // AsyncNode represents a node that can be executed asynchronously
 type AsyncNode struct {
 	*Node
@@ -3,8 +3,11 @@ package go_agent
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestBaseNode_SetParams(t *testing.T) {
@@ -509,3 +512,378 @@ func (n *batchTestNode) execInternal(items interface{}) interface{} {
 	}
 	return results
 }
+
+// Custom node types for flow dispatch tests
+type countingNode struct {
+	*Node
+	action string
+	calls  *int
+}
+
+func (n *countingNode) Prep(shared map[string]interface{}) interface{} {
+	return shared["count"]
+}
+
+func (n *countingNode) Exec(prepRes interface{}) interface{} {
+	(*n.calls)++
+	if *n.calls < 2 {
+		panic("first attempt fails")
+	}
+	return prepRes.(int) + 1
+}
+
+func (n *countingNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["count"] = execRes
+	return n.action
+}
+
+type pathHook struct {
+	path []string
+	skip string
+}
+
+func (h *pathHook) BeforeNode(name string, shared map[string]interface{}) string {
+	if name == h.skip {
+		return "skipped"
+	}
+	return ""
+}
+
+func (h *pathHook) AfterNode(name string, shared map[string]interface{}, action string) string {
+	h.path = append(h.path, name+":"+action)
+	return action
+}
+
+func TestFlow_RunDispatchesToCustomNodes(t *testing.T) {
+	calls := 0
+	first := &countingNode{Node: NewNode(2, 0), action: "next", calls: &calls}
+	second := &countingNode{Node: NewNode(2, 0), action: "done", calls: &calls}
+	first.SetName("first")
+	first.Next(second, "next")
+
+	hook := &pathHook{}
+	flow := NewFlow(first)
+	flow.Use(hook)
+
+	shared := map[string]interface{}{"count": 0}
+	result := flow.Run(shared)
+
+	if result != "done" {
+		t.Fatalf("Expected final action 'done', got %v", result)
+	}
+	if shared["count"] != 2 {
+		t.Fatalf("Expected both nodes to run, count is %v", shared["count"])
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 Exec calls including one retry, got %d", calls)
+	}
+	if fmt.Sprint(hook.path) != "[first:next countingNode:done]" {
+		t.Fatalf("Unexpected hook path: %v", hook.path)
+	}
+}
+
+func TestFlow_HookCanSkipAndRedirect(t *testing.T) {
+	calls := 0
+	first := &countingNode{Node: NewNode(1, 0), action: "next", calls: &calls}
+	alt := &countingNode{Node: NewNode(1, 0), action: "done", calls: &calls}
+	first.SetName("first")
+	alt.SetName("alt")
+	first.Next(alt, "skipped")
+
+	hook := &pathHook{skip: "first"}
+	flow := NewFlow(first)
+	flow.Use(hook)
+
+	shared := map[string]interface{}{"count": 5}
+	flow.Run(shared)
+
+	if fmt.Sprint(hook.path) != "[first:skipped alt:done]" {
+		t.Fatalf("Unexpected hook path: %v", hook.path)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected skipped node not to execute, got %d Exec calls", calls)
+	}
+}
+
+func TestFlow_ExecFallbackAfterRetries(t *testing.T) {
+	retryCount := 0
+	n := &retryTestNode{
+		Node:       NewNode(3, 0),
+		retryCount: &retryCount,
+		mockErr:    errors.New("always fails"),
+	}
+
+	result := execWithRetry(n, nil, nil)
+	if retryCount != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", retryCount)
+	}
+	if err, ok := result.(error); !ok || err.Error() != "always fails" {
+		t.Fatalf("Expected fallback error result, got %v", result)
+	}
+}
+
+func TestNodeName(t *testing.T) {
+	n := &startTestNode{BaseNode: NewBaseNode()}
+	if got := NodeName(n); got != "startTestNode" {
+		t.Fatalf("Expected type name, got %q", got)
+	}
+	n.SetName("start")
+	if got := NodeName(n); got != "start" {
+		t.Fatalf("Expected explicit name, got %q", got)
+	}
+}
+
+// copyNode copies shared[from] to shared[to] with a suffix and returns action
+type copyNode struct {
+	*BaseNode
+	from, to, action string
+}
+
+func (c *copyNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	v, _ := shared[c.from].(string)
+	suffix, _ := c.params["suffix"].(string)
+	shared[c.to] = v + suffix
+	return c.action
+}
+
+func TestSubFlow_IsolatesScopeAndMapsActions(t *testing.T) {
+	inner := &copyNode{BaseNode: NewBaseNode(), from: "text", to: "result", action: "finished"}
+	child := NewFlow(inner)
+
+	sub := NewSubFlow(child).
+		ReadAs("query", "text").
+		WriteAs("result", "answer").
+		MapAction("finished", "answered").
+		PassParams("suffix")
+
+	after := &copyNode{BaseNode: NewBaseNode(), from: "answer", to: "final", action: "done"}
+	sub.Next(after, "answered")
+
+	parent := NewFlow(sub)
+	parent.SetParams(map[string]interface{}{"suffix": "!", "secret": "hidden"})
+
+	shared := map[string]interface{}{"query": "hello", "text": "parent text", "other": 1}
+	result := parent.Run(shared)
+
+	if result != "done" {
+		t.Fatalf("Expected mapped action to reach the next node, got %v", result)
+	}
+	if shared["answer"] != "hello!" || shared["final"] != "hello!!" {
+		t.Fatalf("Unexpected outputs: answer=%v final=%v", shared["answer"], shared["final"])
+	}
+	if shared["text"] != "parent text" {
+		t.Fatalf("Child scope leaked into parent: text=%v", shared["text"])
+	}
+	if _, ok := shared["result"]; ok {
+		t.Fatalf("Unwritten child key leaked into parent")
+	}
+	if _, ok := child.params["secret"]; ok {
+		t.Fatalf("Parameter not passed explicitly reached the child flow")
+	}
+	if _, ok := child.params["suffix"]; ok {
+		t.Fatalf("Passed parameter was stored on the child flow")
+	}
+
+	// A later run without the parameter does not see the earlier value
+	parent.SetParams(map[string]interface{}{})
+	shared = map[string]interface{}{"query": "again"}
+	parent.Run(shared)
+	if shared["answer"] != "again" {
+		t.Fatalf("Expected no suffix on a run without it, got %v", shared["answer"])
+	}
+}
+
+func TestSubFlow_UnmappedActionPassesThrough(t *testing.T) {
+	inner := &copyNode{BaseNode: NewBaseNode(), from: "a", to: "b", action: "other"}
+	sub := NewSubFlow(NewFlow(inner)).Reads("a").Writes("b")
+
+	shared := map[string]interface{}{"a": "x"}
+	if result := NewFlow(sub).Run(shared); result != "other" {
+		t.Fatalf("Expected unmapped action 'other', got %v", result)
+	}
+	if shared["b"] != "x" {
+		t.Fatalf("Expected written key b, got %v", shared["b"])
+	}
+}
+
+func TestMapReduceNode_TreeReduce(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight, reduceCalls := 0, 0, 0
+
+	mapFn := func(chunk interface{}) (interface{}, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return len(chunk.(string)), nil
+	}
+	reduceFn := func(partials []interface{}) (interface{}, error) {
+		mu.Lock()
+		reduceCalls++
+		mu.Unlock()
+		if len(partials) > 3 {
+			t.Errorf("Expected at most FanIn partials per reduce, got %d", len(partials))
+		}
+		sum := 0
+		for _, p := range partials {
+			sum += p.(int)
+		}
+		return sum, nil
+	}
+
+	node := NewMapReduceNode("pages", "total", mapFn, reduceFn)
+	node.Concurrency = 2
+	node.FanIn = 3
+	node.Action = "reduced"
+
+	pages := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff", "g"}
+	shared := map[string]interface{}{"pages": pages}
+	result := NewFlow(node).Run(shared)
+
+	if result != "reduced" {
+		t.Fatalf("Expected action 'reduced', got %v", result)
+	}
+	if shared["total"] != 22 {
+		t.Fatalf("Expected total 22, got %v", shared["total"])
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("Expected at most 2 concurrent map calls, got %d", maxInFlight)
+	}
+	// 7 partials -> 3 groups -> 1 final reduce
+	if reduceCalls != 4 {
+		t.Fatalf("Expected 4 reduce calls, got %d", reduceCalls)
+	}
+}
+
+func TestMapReduceNode_MapErrorSetsError(t *testing.T) {
+	node := NewMapReduceNode("in", "out",
+		func(chunk interface{}) (interface{}, error) {
+			if chunk == "bad" {
+				return nil, errors.New("boom")
+			}
+			return chunk, nil
+		},
+		func(partials []interface{}) (interface{}, error) { return partials, nil },
+	)
+	shared := map[string]interface{}{"in": []interface{}{"ok", "bad"}}
+	if result := NewFlow(node).Run(shared); result != "error" {
+		t.Fatalf("Expected action 'error', got %v", result)
+	}
+	if _, ok := shared["out"]; ok {
+		t.Fatalf("Expected no output after a failed map")
+	}
+	if msg, _ := shared["error"].(string); !strings.Contains(msg, "boom") {
+		t.Fatalf("Expected error message in shared, got %v", shared["error"])
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	chunks := SplitText(12)("one two\n\nthree four\n\nfive six seven eight")
+	want := []interface{}{"one two", "three four", "five six", "seven eight"}
+	if fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, chunks)
+	}
+
+	// Limits count characters, and long words are cut between them
+	chunks = SplitText(4)("héllo wörld\n\nçà")
+	want = []interface{}{"héll", "o", "wörl", "d", "çà"}
+	if fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, chunks)
+	}
+	for _, c := range SplitText(0)("日本") {
+		if !utf8.ValidString(c.(string)) {
+			t.Fatalf("Expected valid UTF-8 chunks, got %q", c)
+		}
+	}
+}
+
+// suspendNode suspends the flow the first time it runs
+type suspendNode struct {
+	*BaseNode
+}
+
+func (s *suspendNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	return &Suspension{Reason: "waiting"}
+}
+
+func TestFlow_SuspendAndResume(t *testing.T) {
+	wait := &suspendNode{BaseNode: NewBaseNode()}
+	wait.SetName("wait")
+	after := &copyNode{BaseNode: NewBaseNode(), from: "in", to: "out", action: "done"}
+	wait.Next(after, "go")
+
+	hook := &pathHook{}
+	flow := NewFlow(wait)
+	flow.Use(hook)
+
+	shared := map[string]interface{}{"in": "x"}
+	result := flow.Run(shared)
+	s, ok := result.(*Suspension)
+	if !ok || s.Node != "wait" || s.Reason != "waiting" {
+		t.Fatalf("Expected suspension at 'wait', got %#v", result)
+	}
+	if _, ok := shared["out"]; ok {
+		t.Fatalf("Expected flow to stop at the suspended node")
+	}
+
+	if result := flow.Resume(shared, "wait", "go"); result != "done" {
+		t.Fatalf("Expected resumed flow to finish with 'done', got %v", result)
+	}
+	if shared["out"] != "x" {
+		t.Fatalf("Expected successor to run after resume, got %v", shared["out"])
+	}
+	if fmt.Sprint(hook.path) != "[wait:go copyNode:done]" {
+		t.Fatalf("Unexpected hook path: %v", hook.path)
+	}
+	if flow.Resume(shared, "missing", "go") != nil {
+		t.Fatalf("Expected nil when resuming an unknown node")
+	}
+}
+
+func TestFlow_ResumeInsideNestedFlow(t *testing.T) {
+	wait := &suspendNode{BaseNode: NewBaseNode()}
+	wait.SetName("approve")
+	inner := NewFlow(wait)
+	inner.SetName("review")
+	wait.Next(&copyNode{BaseNode: NewBaseNode(), from: "in", to: "mid", action: "reviewed"}, "yes")
+
+	after := &copyNode{BaseNode: NewBaseNode(), from: "mid", to: "out", action: "done"}
+	inner.Next(after, "reviewed")
+	outer := NewFlow(inner)
+
+	shared := map[string]interface{}{"in": "x"}
+	s, ok := outer.Run(shared).(*Suspension)
+	if !ok || s.Node != "approve" || fmt.Sprint(s.Path) != "[review]" {
+		t.Fatalf("Expected suspension at review/approve, got %#v", s)
+	}
+	if result := outer.ResumeSuspension(shared, s, "yes"); result != "done" {
+		t.Fatalf("Expected resumed flow to finish with 'done', got %v", result)
+	}
+	if shared["out"] != "x" {
+		t.Fatalf("Expected the outer flow to continue after the nested one, got %v", shared["out"])
+	}
+
+	shared = map[string]interface{}{"in": "y"}
+	outer.Run(shared)
+	if result := outer.Resume(shared, "approve", "yes"); result != "done" || shared["out"] != "y" {
+		t.Fatalf("Expected Resume to find the nested node, got %v", result)
+	}
+}
+
+func TestSubFlow_RejectsSuspension(t *testing.T) {
+	wait := &suspendNode{BaseNode: NewBaseNode()}
+	sub := NewSubFlow(NewFlow(wait))
+	shared := map[string]interface{}{}
+	if result := NewFlow(sub).Run(shared); result != "error" {
+		t.Fatalf("Expected 'error' from a suspended sub-flow, got %v", result)
+	}
+	if msg, _ := shared["error"].(string); !strings.Contains(msg, "cannot be suspended") {
+		t.Fatalf("Expected error message in shared, got %v", shared["error"])
+	}
+}
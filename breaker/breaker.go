@@ -0,0 +1,347 @@
+// Package breaker implements circuit breakers for flaky external
+// dependencies such as LLM and search APIs.
+//
+// A Breaker watches the outcome of calls over a sliding time window. While
+// it is closed calls go through; once enough of them fail it opens and
+// rejects calls immediately with ErrOpen, instead of letting every node wait
+// through its retries. After a cooldown it is half-open and lets a few probe
+// calls through: a success closes it again, a failure reopens it.
+//
+// A Breaker is attached to shared clients with Model, Search and Transport,
+// and to nodes with a Hook, which routes the flow to a fallback action such
+// as "degraded" while the breaker is open.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned for calls rejected by an open breaker
+var ErrOpen = errors.New("breaker: circuit open")
+
+// State is the state of a Breaker
+type State int
+
+const (
+	// Closed lets calls through and counts their failures
+	Closed State = iota
+	// Open rejects calls
+	Open
+	// HalfOpen lets a few probe calls through
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Defaults used by New
+const (
+	DefaultWindow      = time.Minute
+	DefaultMinRequests = 5
+	DefaultFailureRate = 0.5
+	DefaultCooldown    = 30 * time.Second
+)
+
+// outcome is the result of one call
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	Name string
+	// Window is the span over which failures are counted
+	Window time.Duration
+	// MinRequests is the number of calls in the window below which the
+	// breaker never opens
+	MinRequests int
+	// FailureRate is the fraction of failed calls in the window that opens
+	// the breaker
+	FailureRate float64
+	// Cooldown is how long the breaker stays open before letting probes
+	// through
+	Cooldown time.Duration
+	// HalfOpenProbes is the number of concurrent probe calls allowed while
+	// half-open
+	HalfOpenProbes int
+	// IsFailure decides which errors count as failures; nil counts every
+	// error except context cancellation
+	IsFailure func(err error) bool
+	// OnStateChange, when set, is called after every state change
+	OnStateChange func(name string, from, to State)
+
+	mu       sync.Mutex
+	state    State
+	outcomes []outcome
+	openedAt time.Time
+	probes   int
+	now      func() time.Time
+	// period counts state changes, so that calls allowed before one can be
+	// told apart from newer ones
+	period uint64
+	// nodes holds the calls let through by a Hook, by node
+	nodes map[string][]ticket
+}
+
+// ticket is a call let through by allow, stamped with the period it was
+// allowed in
+type ticket struct {
+	period uint64
+}
+
+// New creates a closed Breaker with the default settings
+func New(name string) *Breaker {
+	return &Breaker{
+		Name:           name,
+		Window:         DefaultWindow,
+		MinRequests:    DefaultMinRequests,
+		FailureRate:    DefaultFailureRate,
+		Cooldown:       DefaultCooldown,
+		HalfOpenProbes: 1,
+		now:            time.Now,
+	}
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// State returns the current state, moving from open to half-open once the
+// cooldown has passed
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cool()
+	return b.state
+}
+
+// cool moves an open breaker to half-open after the cooldown. b.mu must be
+// held.
+func (b *Breaker) cool() {
+	if b.state == Open && b.clock().Sub(b.openedAt) >= b.Cooldown {
+		b.setState(HalfOpen)
+	}
+}
+
+// Allow reports whether a call may go through, returning ErrOpen if not.
+// Every allowed call must be followed by Record with its outcome.
+func (b *Breaker) Allow() error {
+	_, err := b.allow()
+	return err
+}
+
+func (b *Breaker) allow() (ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.allowLocked()
+}
+
+// allowLocked is Allow for callers that hold b.mu
+func (b *Breaker) allowLocked() (ticket, error) {
+	b.cool()
+	switch b.state {
+	case Open:
+		return ticket{}, fmt.Errorf("%w: %s", ErrOpen, b.Name)
+	case HalfOpen:
+		if b.probes >= max(b.HalfOpenProbes, 1) {
+			return ticket{}, fmt.Errorf("%w: %s", ErrOpen, b.Name)
+		}
+		b.probes++
+	}
+	return ticket{period: b.period}, nil
+}
+
+// Record reports the outcome of a call allowed by Allow
+func (b *Breaker) Record(err error) {
+	b.record(b.failed(err))
+}
+
+func (b *Breaker) failed(err error) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(err)
+	}
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recordLocked(failed)
+}
+
+// finish records the outcome of the call t. Outcomes of calls allowed
+// before the last state change are dropped, since they no longer hold a
+// probe and the breaker already moved on.
+func (b *Breaker) finish(t ticket, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.period == b.period {
+		b.recordLocked(failed)
+	}
+}
+
+// recordLocked is record for callers that hold b.mu
+func (b *Breaker) recordLocked(failed bool) {
+	now := b.clock()
+
+	if b.state == HalfOpen {
+		if b.probes > 0 {
+			b.probes--
+		}
+		if failed {
+			b.trip(now)
+		} else {
+			b.outcomes = b.outcomes[:0]
+			b.setState(Closed)
+		}
+		return
+	}
+	if b.state == Open {
+		// A call allowed before the breaker opened
+		return
+	}
+
+	b.outcomes = append(b.outcomes, outcome{at: now, failed: failed})
+	cutoff := now.Add(-b.Window)
+	drop := 0
+	for drop < len(b.outcomes) && b.outcomes[drop].at.Before(cutoff) {
+		drop++
+	}
+	b.outcomes = b.outcomes[drop:]
+
+	if !failed || len(b.outcomes) < b.MinRequests {
+		return
+	}
+	failures := 0
+	for _, o := range b.outcomes {
+		if o.failed {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(b.outcomes)) >= b.FailureRate {
+		b.trip(now)
+	}
+}
+
+// release gives back the half-open probe held by the call t, which never
+// finished, without recording an outcome
+func (b *Breaker) release(t ticket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releaseLocked(t)
+}
+
+// releaseLocked is release for callers that hold b.mu
+func (b *Breaker) releaseLocked(t ticket) {
+	if t.period == b.period && b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// allowNode is Allow for a call made by the node named node, whose outcome
+// is given to finishNode or releaseNode
+func (b *Breaker) allowNode(node string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.allowLocked()
+	if err != nil {
+		return err
+	}
+	if b.nodes == nil {
+		b.nodes = make(map[string][]ticket)
+	}
+	b.nodes[node] = append(b.nodes[node], t)
+	return nil
+}
+
+// takeNode removes the oldest call of node allowed by allowNode. b.mu must
+// be held.
+func (b *Breaker) takeNode(node string) (ticket, bool) {
+	pending := b.nodes[node]
+	if len(pending) == 0 {
+		return ticket{}, false
+	}
+	t := pending[0]
+	if len(pending) == 1 {
+		delete(b.nodes, node)
+	} else {
+		b.nodes[node] = pending[1:]
+	}
+	return t, true
+}
+
+// finishNode records the outcome of a call of node allowed by allowNode
+func (b *Breaker) finishNode(node string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.takeNode(node); ok && t.period == b.period {
+		b.recordLocked(failed)
+	}
+}
+
+// releaseNode gives back a call of node allowed by allowNode that ended
+// without an outcome
+func (b *Breaker) releaseNode(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.takeNode(node); ok {
+		b.releaseLocked(t)
+	}
+}
+
+// trip opens the breaker. b.mu must be held.
+func (b *Breaker) trip(now time.Time) {
+	b.openedAt = now
+	b.outcomes = b.outcomes[:0]
+	b.probes = 0
+	b.setState(Open)
+}
+
+// setState changes the state. b.mu must be held.
+func (b *Breaker) setState(to State) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.period++
+	if b.OnStateChange != nil {
+		b.OnStateChange(b.Name, from, to)
+	}
+}
+
+// Execute runs fn if the breaker allows it and records its outcome. A
+// panicking fn records no outcome but gives its probe back.
+func (b *Breaker) Execute(fn func() error) error {
+	t, err := b.allow()
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			b.release(t)
+		}
+	}()
+	err = fn()
+	done = true
+	b.finish(t, b.failed(err))
+	return err
+}
@@ -0,0 +1,226 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/llm"
+)
+
+var errDown = errors.New("service unavailable")
+
+// testBreaker returns a breaker with a controllable clock
+func testBreaker() (*Breaker, *time.Time) {
+	now := time.Unix(0, 0)
+	b := New("test")
+	b.MinRequests = 4
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	b, now := testBreaker()
+	var changes []string
+	b.OnStateChange = func(name string, from, to State) { changes = append(changes, from.String()+">"+to.String()) }
+
+	fail := func() error { return errDown }
+	b.Execute(func() error { return nil })
+	b.Execute(fail)
+	b.Execute(fail)
+	if b.State() != Closed {
+		t.Fatalf("state after 3 calls = %v, want closed below MinRequests", b.State())
+	}
+	b.Execute(fail)
+	if b.State() != Open {
+		t.Fatalf("state after 3 of 4 failures = %v, want open", b.State())
+	}
+
+	calls := 0
+	if err := b.Execute(func() error { calls++; return nil }); !errors.Is(err, ErrOpen) || calls != 0 {
+		t.Fatalf("open breaker ran the call: err = %v, calls = %d", err, calls)
+	}
+
+	*now = now.Add(DefaultCooldown)
+	if b.State() != HalfOpen {
+		t.Fatalf("state after cooldown = %v, want half-open", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the probe: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("half-open breaker allowed a second concurrent probe")
+	}
+	b.Record(nil)
+	if b.State() != Closed {
+		t.Fatalf("state after a successful probe = %v, want closed", b.State())
+	}
+
+	want := "closed>open open>half-open half-open>closed"
+	if got := strings.Join(changes, " "); got != want {
+		t.Errorf("state changes = %s, want %s", got, want)
+	}
+}
+
+func TestBreaker_WindowForgetsOldFailures(t *testing.T) {
+	b, now := testBreaker()
+	for i := 0; i < 3; i++ {
+		b.Execute(func() error { return errDown })
+	}
+	*now = now.Add(2 * DefaultWindow)
+	b.Execute(func() error { return errDown })
+	if b.State() != Closed {
+		t.Errorf("state = %v, want closed once old failures leave the window", b.State())
+	}
+	b.Execute(func() error { return context.Canceled })
+	if len(b.outcomes) != 2 || b.outcomes[1].failed {
+		t.Errorf("a canceled call counted as a failure")
+	}
+}
+
+func TestModel_ShortCircuits(t *testing.T) {
+	b, _ := testBreaker()
+	b.MinRequests = 1
+	calls := 0
+	m := Model(llm.ModelFunc(func(ctx context.Context, prompt string) (*llm.Response, error) {
+		calls++
+		return nil, errDown
+	}), b)
+
+	m.Generate(context.Background(), "hi")
+	if _, err := m.Generate(context.Background(), "hi"); !errors.Is(err, ErrOpen) {
+		t.Errorf("second call error = %v, want ErrOpen", err)
+	}
+	if calls != 1 {
+		t.Errorf("model called %d times, want 1", calls)
+	}
+}
+
+func TestTransport_CountsServerErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b, _ := testBreaker()
+	b.MinRequests = 2
+	client := &http.Client{Transport: Transport(nil, b)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrOpen) {
+		t.Errorf("request after two 503s error = %v, want ErrOpen", err)
+	}
+}
+
+// actionNode counts its runs and returns a fixed action
+type actionNode struct {
+	*agent.BaseNode
+	action interface{}
+	runs   int
+}
+
+func (n *actionNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	n.runs++
+	return n.action
+}
+
+func TestHook_RoutesToDegraded(t *testing.T) {
+	b, _ := testBreaker()
+	b.MinRequests = 1
+	search := &actionNode{BaseNode: agent.NewBaseNode(), action: "error"}
+	search.SetName("search")
+	fallback := &actionNode{BaseNode: agent.NewBaseNode(), action: "done"}
+	search.Next(fallback, DegradedAction)
+
+	hook := NewHook().Protect("search", b)
+	hook.FailureActions = []string{"error"}
+	flow := agent.NewFlow(search)
+	flow.Use(hook)
+
+	flow.Run(map[string]interface{}{})
+	if b.State() != Open || fallback.runs != 0 {
+		t.Fatalf("after a failed run: state = %v, fallback runs = %d", b.State(), fallback.runs)
+	}
+
+	shared := map[string]interface{}{}
+	flow.Run(shared)
+	if search.runs != 1 || fallback.runs != 1 || shared["degraded"] == nil {
+		t.Errorf("open breaker: search runs = %d, fallback runs = %d, degraded = %v", search.runs, fallback.runs, shared["degraded"])
+	}
+}
+
+func TestHook_ReleasesProbeOnSuspension(t *testing.T) {
+	b, now := testBreaker()
+	b.MinRequests = 1
+	b.Execute(func() error { return errDown })
+	*now = now.Add(DefaultCooldown)
+
+	review := &actionNode{BaseNode: agent.NewBaseNode(), action: &agent.Suspension{Reason: "needs review"}}
+	review.SetName("review")
+	hook := NewHook().Protect("review", b)
+	hook.FailureActions = []string{"error"}
+	flow := agent.NewFlow(review)
+	flow.Use(hook)
+
+	if _, ok := flow.Run(map[string]interface{}{}).(*agent.Suspension); !ok {
+		t.Fatalf("flow did not suspend")
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("probe still held after the node suspended: %v", err)
+	}
+}
+
+func TestBreaker_ExecuteReleasesProbeOnPanic(t *testing.T) {
+	b, now := testBreaker()
+	b.MinRequests = 1
+	b.Execute(func() error { return errDown })
+	*now = now.Add(DefaultCooldown)
+
+	func() {
+		defer func() { recover() }()
+		b.Execute(func() error { panic("broken client") })
+	}()
+	if b.State() != HalfOpen {
+		t.Fatalf("state after a panicking probe = %v, want half-open", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("probe still held after the call panicked: %v", err)
+	}
+}
+
+func TestHook_IgnoresCallsFromBeforeStateChange(t *testing.T) {
+	b, now := testBreaker()
+	b.MinRequests = 1
+	hook := NewHook().Protect("search", b)
+	hook.FailureActions = []string{"error"}
+	if action := hook.BeforeNode("search", map[string]interface{}{}); action != "" {
+		t.Fatalf("closed breaker skipped the node: %q", action)
+	}
+
+	// Another client of the breaker opens it, and a probe is let through
+	// after the cooldown while the node is still running
+	b.Execute(func() error { return errDown })
+	*now = now.Add(DefaultCooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open breaker rejected the probe: %v", err)
+	}
+
+	hook.AbortNode("search", map[string]interface{}{})
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("an aborted call from before the trip gave back the current probe")
+	}
+	hook.AfterNode("search", map[string]interface{}{}, "done")
+	if b.State() != HalfOpen {
+		t.Errorf("state after a call from before the trip = %v, want half-open", b.State())
+	}
+}
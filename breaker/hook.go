@@ -0,0 +1,100 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Hook is an agent.Hook that guards nodes with breakers. While a node's
+// breaker is open the node is skipped, the reason is stored in
+// shared["degraded"] and the flow transitions on Action, which the node
+// routes with Next, for example to an answer built from the information
+// gathered so far. A Hook may be shared by concurrent flows.
+type Hook struct {
+	// Action is the action taken instead of an open node; "degraded" by
+	// default
+	Action string
+	// FailureActions, when set, makes the hook record the outcome of each
+	// guarded node: returning one of these actions is a failure, any other
+	// action a success. Leave it empty when the breaker is fed by the
+	// node's clients through Model, Search or Transport.
+	FailureActions []string
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// DegradedAction is the default action of a Hook
+const DegradedAction = "degraded"
+
+// NewHook creates a Hook that routes open nodes to DegradedAction
+func NewHook() *Hook {
+	return &Hook{Action: DegradedAction, breakers: make(map[string]*Breaker)}
+}
+
+// Protect guards the node named node with b
+func (h *Hook) Protect(node string, b *Breaker) *Hook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.breakers[node] = b
+	return h
+}
+
+// BeforeNode implements agent.Hook
+func (h *Hook) BeforeNode(name string, shared map[string]interface{}) string {
+	h.mu.Lock()
+	b, ok := h.breakers[name]
+	h.mu.Unlock()
+	if !ok {
+		return ""
+	}
+	if len(h.FailureActions) == 0 {
+		if b.State() == Open {
+			return h.action(shared, name)
+		}
+		return ""
+	}
+	if err := b.allowNode(name); err != nil {
+		return h.action(shared, name)
+	}
+	return ""
+}
+
+func (h *Hook) action(shared map[string]interface{}, name string) string {
+	shared["degraded"] = fmt.Sprintf("%s skipped: %v", name, ErrOpen)
+	if h.Action == "" {
+		return DegradedAction
+	}
+	return h.Action
+}
+
+// AfterNode implements agent.Hook
+func (h *Hook) AfterNode(name string, shared map[string]interface{}, action string) string {
+	h.mu.Lock()
+	b, ok := h.breakers[name]
+	h.mu.Unlock()
+	if !ok || len(h.FailureActions) == 0 {
+		return action
+	}
+
+	failed := false
+	for _, a := range h.FailureActions {
+		if a == action {
+			failed = true
+		}
+	}
+	b.finishNode(name, failed)
+	return action
+}
+
+// AbortNode implements agent.AbortHook. A node that suspended its flow or
+// panicked has no outcome to record, so the call it was allowed is given
+// back instead.
+func (h *Hook) AbortNode(name string, shared map[string]interface{}) {
+	h.mu.Lock()
+	b, ok := h.breakers[name]
+	h.mu.Unlock()
+	if ok {
+		b.releaseNode(name)
+	}
+}
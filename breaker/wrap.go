@@ -0,0 +1,87 @@
+package breaker
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+type model struct {
+	model   llm.ChatModel
+	breaker *Breaker
+}
+
+// Model wraps m so that its calls go through b
+func Model(m llm.ChatModel, b *Breaker) llm.ChatModel {
+	return &model{model: m, breaker: b}
+}
+
+func (m *model) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	var resp *llm.Response
+	err := m.breaker.Execute(func() error {
+		var err error
+		resp, err = m.model.Generate(ctx, prompt)
+		return err
+	})
+	return resp, err
+}
+
+type provider struct {
+	search.Provider
+	breaker *Breaker
+}
+
+// Search wraps p so that its searches go through b
+func Search(p search.Provider, b *Breaker) search.Provider {
+	return &provider{Provider: p, breaker: b}
+}
+
+func (p *provider) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	var results []search.Result
+	err := p.breaker.Execute(func() error {
+		var err error
+		results, err = p.Provider.Search(ctx, query, limit)
+		return err
+	})
+	return results, err
+}
+
+type transport struct {
+	base    http.RoundTripper
+	breaker *Breaker
+}
+
+// Transport wraps base, or http.DefaultTransport when nil, so that requests
+// go through b. Responses with status 429 or 5xx count as failures.
+func Transport(base http.RoundTripper, b *Breaker) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, breaker: b}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tk, err := t.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	done := false
+	defer func() {
+		if !done {
+			t.breaker.release(tk)
+		}
+	}()
+	resp, err := t.base.RoundTrip(req)
+	done = true
+	switch {
+	case err != nil:
+		t.breaker.finish(tk, t.breaker.failed(err))
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		t.breaker.finish(tk, true)
+	default:
+		t.breaker.finish(tk, false)
+	}
+	return resp, err
+}
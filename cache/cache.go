@@ -0,0 +1,172 @@
+// Package cache reuses the results of deterministic work across runs, such
+// as node executions, LLM replies and web searches, so that running a flow
+// again on the same input does not repeat identical calls.
+//
+// Caching is opt-in. Results live in a Store: Memory keeps them in a
+// least-recently-used map, File keeps them in a file that survives restarts.
+// Exec caches the Exec results of chosen nodes, keyed on the node's name and
+// prep result, and is attached with Flow.Cache, which reports hits and misses
+// as CacheHit and CacheMiss events. Model and Search cache LLM replies and
+// search results, keyed on the prompt or query.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store holds cached values by key. A ttl of zero or less keeps a value
+// until it is evicted.
+type Store interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	Delete(key string)
+}
+
+// Key hashes parts into a cache key. Parts are compared by their JSON
+// encoding. Values that cannot be encoded, or encode as empty objects, such
+// as clients, count only by their type, and contexts are ignored, so that a
+// prep result holding an LLM client and a context still has a stable key.
+func Key(parts ...interface{}) string {
+	data, err := json.Marshal(normalize(parts))
+	if err != nil {
+		// normalize only returns encodable values
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case context.Context:
+		return "context.Context"
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			out[k] = normalize(item)
+		}
+		return out
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "{}" {
+		return fmt.Sprintf("%T", v)
+	}
+	return json.RawMessage(data)
+}
+
+// distinct reports whether Key tells v apart from other values of its type,
+// which it does not for contexts and for values that cannot be encoded or
+// encode as empty objects
+func distinct(v interface{}) bool {
+	switch v.(type) {
+	case nil, []interface{}, map[string]interface{}:
+		return true
+	case context.Context:
+		return false
+	}
+	data, err := json.Marshal(v)
+	return err == nil && string(data) != "{}"
+}
+
+// Memory is an in-memory least-recently-used Store
+type Memory struct {
+	max int
+	now func() time.Time
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// NewMemory creates a Store holding at most max values; zero means no limit
+func NewMemory(max int) *Memory {
+	return &Memory{
+		max:   max,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Store
+func (m *Memory) Get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !m.now().Before(entry.expires) {
+		m.order.Remove(el)
+		delete(m.items, key)
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// Set implements Store
+func (m *Memory) Set(key string, value interface{}, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := &memoryEntry{key: key, value: value, expires: expiry(m.now(), ttl)}
+	if el, ok := m.items[key]; ok {
+		el.Value = entry
+		m.order.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.order.PushFront(entry)
+	for m.max > 0 && m.order.Len() > m.max {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Delete implements Store
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.order.Remove(el)
+		delete(m.items, key)
+	}
+}
+
+// Len returns the number of values held, including expired ones that have
+// not been looked up since
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// expiry returns when a value set at now with ttl expires, or the zero time
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+type client struct {
+	conn int
+}
+
+func TestKey_IgnoresClientsAndContexts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := Key([]interface{}{"question", &client{conn: 1}, context.Background()})
+	b := Key([]interface{}{"question", &client{conn: 2}, ctx})
+	if a != b {
+		t.Fatalf("keys differ for the same data: %s, %s", a, b)
+	}
+	if c := Key([]interface{}{"other question", &client{}, ctx}); c == a {
+		t.Fatalf("key = %s for different data, want a different key", c)
+	}
+	if Key("x", 1) == Key("x", "1") {
+		t.Fatalf("keys of 1 and \"1\" are equal")
+	}
+}
+
+func TestMemory_EvictsAndExpires(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory(2)
+	m.now = func() time.Time { return now }
+
+	m.Set("a", 1, 0)
+	m.Set("b", 2, time.Minute)
+	m.Get("a")
+	m.Set("c", 3, 0)
+	if _, ok := m.Get("b"); ok {
+		t.Fatalf("b was not evicted as the least recently used value")
+	}
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v, want 1", v, ok)
+	}
+
+	m.Set("d", 4, time.Minute)
+	now = now.Add(time.Minute)
+	if _, ok := m.Get("d"); ok {
+		t.Fatalf("d was returned after its TTL")
+	}
+	m.Delete("a")
+	if m.Len() != 0 {
+		t.Fatalf("Len = %d, want 0", m.Len())
+	}
+}
+
+func TestFile_PersistsValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "values.jsonl")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Set("text", "answer", 0)
+	f.Set("map", map[string]interface{}{"action": "search", "n": 2}, 0)
+	f.Set("short", "gone", time.Millisecond)
+	f.Set("text", "new answer", 0)
+	f.Set("deleted", 1, 0)
+	f.Delete("deleted")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	f, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if v, ok := f.Get("text"); !ok || v != "new answer" {
+		t.Fatalf("Get(text) = %v, %v, want new answer", v, ok)
+	}
+	v, ok := f.Get("map")
+	if m, _ := v.(map[string]interface{}); !ok || m["action"] != "search" || m["n"] != 2 {
+		t.Fatalf("Get(map) = %#v, %v", v, ok)
+	}
+	for _, key := range []string{"short", "deleted"} {
+		if _, ok := f.Get(key); ok {
+			t.Fatalf("Get(%s) found a value, want none", key)
+		}
+	}
+	if f.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", f.Len())
+	}
+
+	// Stale records were dropped when the file was opened
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := countLines(data); lines != 2 {
+		t.Fatalf("file has %d records, want 2", lines)
+	}
+}
+
+func countLines(data []byte) int {
+	n := 0
+	for _, b := range data {
+		if b == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+type echoNode struct {
+	*agent.Node
+	calls int
+}
+
+func (n *echoNode) Prep(shared map[string]interface{}) interface{} {
+	return []interface{}{shared["question"], shared["ctx"]}
+}
+
+func (n *echoNode) Exec(prepRes interface{}) interface{} {
+	n.calls++
+	return "answer to " + prepRes.([]interface{})[0].(string)
+}
+
+func (n *echoNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["answer"] = execRes
+	return "done"
+}
+
+func TestExec_CachesNamedNodes(t *testing.T) {
+	answer := &echoNode{Node: agent.NewNode(1, 0)}
+	answer.SetName("answer")
+	other := &echoNode{Node: agent.NewNode(1, 0)}
+	other.SetName("other")
+	answer.Next(other, "done")
+
+	path := filepath.Join(t.TempDir(), "exec.jsonl")
+	store, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	flow := agent.NewFlow(answer)
+	exec := NewExec(store, time.Hour, "answer")
+	exec.Valid = func(node string, execRes interface{}) bool { return execRes != "answer to fail" }
+	flow.Cache(exec)
+
+	for _, question := range []string{"why", "why", "fail", "fail"} {
+		shared := map[string]interface{}{"question": question, "ctx": context.Background()}
+		flow.Run(shared)
+		if shared["answer"] != "answer to "+question {
+			t.Fatalf("answer = %v", shared["answer"])
+		}
+	}
+	if answer.calls != 3 || other.calls != 4 {
+		t.Fatalf("calls = %d, %d, want 3 for the cached node and 4 for the other", answer.calls, other.calls)
+	}
+}
+
+func TestExec_SkipsOpaquePrepResults(t *testing.T) {
+	exec := NewExec(NewMemory(0), 0, "answer")
+	if key := exec.Key("answer", []interface{}{"why", &client{conn: 1}}); key == "" {
+		t.Fatalf("Key = \"\" for a question next to a client, want a key")
+	}
+	for _, prepRes := range []interface{}{&client{conn: 1}, context.Background(), func() {}} {
+		if key := exec.Key("answer", prepRes); key != "" {
+			t.Errorf("Key(%T) = %q, want \"\" so that it is not cached", prepRes, key)
+		}
+	}
+}
+
+type stubModel struct {
+	calls int
+}
+
+func (m *stubModel) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	m.calls++
+	if prompt == "fail" {
+		return nil, errors.New("boom")
+	}
+	return &llm.Response{Text: "re: " + prompt, Model: "stub", Usage: llm.Usage{TotalTokens: 10}}, nil
+}
+
+func TestModel_CachesReplies(t *testing.T) {
+	stub := &stubModel{}
+	m := Model(stub, NewMemory(0), 0, "stub", 0.2)
+	ctx := context.Background()
+
+	first, err := m.Generate(ctx, "hi")
+	if err != nil || first.Cached {
+		t.Fatalf("first reply = %+v, %v, want an uncached reply", first, err)
+	}
+	second, err := m.Generate(ctx, "hi")
+	if err != nil || !second.Cached || second.Text != "re: hi" || second.Usage.TotalTokens != 0 {
+		t.Fatalf("second reply = %+v, %v, want a cached reply without usage", second, err)
+	}
+	m.Generate(ctx, "fail")
+	m.Generate(ctx, "fail")
+	if stub.calls != 3 {
+		t.Fatalf("calls = %d, want 3", stub.calls)
+	}
+}
+
+type stubSearch struct {
+	calls int
+}
+
+func (s *stubSearch) Name() string { return "stub" }
+
+func (s *stubSearch) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	s.calls++
+	return []search.Result{{Title: query, Rank: 1}}, nil
+}
+
+func TestSearch_CachesInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.jsonl")
+	stub := &stubSearch{}
+	for i := 0; i < 2; i++ {
+		store, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := Search(stub, store, time.Hour).Search(context.Background(), "go", 5)
+		store.Close()
+		if err != nil || len(results) != 1 || results[0].Title != "go" {
+			t.Fatalf("results = %+v, %v", results, err)
+		}
+	}
+	if stub.calls != 1 {
+		t.Fatalf("calls = %d, want 1", stub.calls)
+	}
+}
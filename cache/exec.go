@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"strings"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// Exec is an agent.ExecCache that caches the Exec results of the nodes it
+// names, keyed on the node's name and prep result. Only nodes whose Exec
+// depends on nothing but their prep result should be cached.
+type Exec struct {
+	Store Store
+	// TTL is how long results are kept; zero keeps them until evicted
+	TTL time.Duration
+	// Nodes are the names of the cached nodes, with an optional TTL each
+	// that overrides TTL
+	Nodes map[string]time.Duration
+	// Valid, when set, reports whether a result may be cached. Nodes that
+	// report failures as ordinary results use it to keep them out.
+	Valid func(node string, execRes interface{}) bool
+}
+
+var _ agent.ExecCache = (*Exec)(nil)
+
+// NewExec creates an Exec that caches the named nodes in store for ttl
+func NewExec(store Store, ttl time.Duration, nodes ...string) *Exec {
+	e := &Exec{Store: store, TTL: ttl, Nodes: make(map[string]time.Duration)}
+	for _, node := range nodes {
+		e.Nodes[node] = 0
+	}
+	return e
+}
+
+// Key implements agent.ExecCache. A prep result that cannot be encoded, or
+// encodes as an empty object, would share its key with every other value of
+// its type, so it is not cached.
+func (e *Exec) Key(node string, prepRes interface{}) string {
+	if _, ok := e.Nodes[node]; !ok || !distinct(prepRes) {
+		return ""
+	}
+	return "node:" + node + ":" + Key(node, prepRes)
+}
+
+// Get implements agent.ExecCache
+func (e *Exec) Get(key string) (interface{}, bool) {
+	return e.Store.Get(key)
+}
+
+// Set implements agent.ExecCache
+func (e *Exec) Set(key string, execRes interface{}) {
+	node := strings.TrimPrefix(key[:strings.LastIndex(key, ":")], "node:")
+	if e.Valid != nil && !e.Valid(node, execRes) {
+		return
+	}
+	e.Store.Set(key, execRes, e.ttl(node))
+}
+
+// ttl returns how long results of node are kept
+func (e *Exec) ttl(node string) time.Duration {
+	if ttl := e.Nodes[node]; ttl > 0 {
+		return ttl
+	}
+	return e.TTL
+}
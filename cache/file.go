@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+func init() {
+	// Types that node results and the wrapped clients commonly produce.
+	// Other types stored in a File must be registered with gob.Register.
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+	gob.Register(map[string]string{})
+	gob.Register(llm.Response{})
+	gob.Register([]search.Result{})
+}
+
+// File is a Store kept in a single append-only file, so that cached values
+// survive restarts. Values are encoded with encoding/gob; types other than
+// basic types, []interface{}, map[string]interface{}, map[string]string,
+// llm.Response and []search.Result must be registered with gob.Register.
+// Values that cannot be encoded are not cached.
+//
+// Every Set and Delete appends a record. Superseded and expired records are
+// dropped when the file is opened with any, and by Compact.
+type File struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]fileRecord
+}
+
+// fileRecord is one line of the file
+type fileRecord struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// gobValue wraps values so that gob records their concrete type
+type gobValue struct {
+	V interface{}
+}
+
+// OpenFile opens the File store at path, creating it if needed
+func OpenFile(path string) (*File, error) {
+	s := &File{path: path, now: time.Now, entries: make(map[string]fileRecord)}
+	stale, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		if err := s.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	if s.f, err = openAppend(path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openAppend opens path for appending, creating it and its directory
+func openAppend(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening cache file: %w", err)
+	}
+	return f, nil
+}
+
+// load reads the file's records and reports whether any of them are stale
+func (s *File) load() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading cache file: %w", err)
+	}
+
+	stale := false
+	now := s.now()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("Warning: skipping line %d of cache file %s: %v", line, s.path, err)
+			stale = true
+			continue
+		}
+		if _, ok := s.entries[rec.Key]; ok {
+			stale = true
+		}
+		if rec.Deleted || expired(rec, now) {
+			delete(s.entries, rec.Key)
+			stale = true
+			continue
+		}
+		s.entries[rec.Key] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("reading cache file: %w", err)
+	}
+	return stale, nil
+}
+
+func expired(rec fileRecord, now time.Time) bool {
+	return !rec.Expires.IsZero() && !now.Before(rec.Expires)
+}
+
+// Get implements Store
+func (s *File) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	rec, ok := s.entries[key]
+	if ok && expired(rec, s.now()) {
+		delete(s.entries, key)
+		ok = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	var v gobValue
+	if err := gob.NewDecoder(bytes.NewReader(rec.Value)).Decode(&v); err != nil {
+		log.Printf("Warning: decoding cached value %s: %v", key, err)
+		return nil, false
+	}
+	return v.V, true
+}
+
+// Set implements Store
+func (s *File) Set(key string, value interface{}, ttl time.Duration) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobValue{V: value}); err != nil {
+		log.Printf("Warning: not caching %s: %v", key, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := fileRecord{Key: key, Value: buf.Bytes(), Expires: expiry(s.now(), ttl)}
+	if err := s.append(rec); err != nil {
+		log.Printf("Warning: writing cache file %s: %v", s.path, err)
+		return
+	}
+	s.entries[key] = rec
+}
+
+// Delete implements Store
+func (s *File) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return
+	}
+	delete(s.entries, key)
+	if err := s.append(fileRecord{Key: key, Deleted: true}); err != nil {
+		log.Printf("Warning: writing cache file %s: %v", s.path, err)
+	}
+}
+
+// append writes a record to the end of the file. s.mu must be held.
+func (s *File) append(rec fileRecord) error {
+	if s.f == nil {
+		return errors.New("cache file is closed")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+// Len returns the number of values held
+func (s *File) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Compact rewrites the file with only the values that are still live
+func (s *File) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for key, rec := range s.entries {
+		if expired(rec, now) {
+			delete(s.entries, key)
+		}
+	}
+	if err := s.rewrite(); err != nil {
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+	f, err := openAppend(s.path)
+	s.f = f
+	return err
+}
+
+// rewrite atomically replaces the file with the current entries
+func (s *File) rewrite() error {
+	var buf bytes.Buffer
+	for _, rec := range s.entries {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replacing cache file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file. The store must not be used afterwards.
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
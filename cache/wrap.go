@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+type model struct {
+	model  llm.ChatModel
+	store  Store
+	ttl    time.Duration
+	params []interface{}
+}
+
+// Model wraps m so that its replies are cached in store for ttl, keyed on
+// the prompt and params. params should identify the model and the settings
+// that change its replies, such as its name and temperature. Cached replies
+// are marked Cached and report no usage, since no tokens were spent.
+func Model(m llm.ChatModel, store Store, ttl time.Duration, params ...interface{}) llm.ChatModel {
+	return &model{model: m, store: store, ttl: ttl, params: params}
+}
+
+func (m *model) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	key := "llm:" + Key(m.params, prompt)
+	if v, ok := m.store.Get(key); ok {
+		if resp, ok := v.(llm.Response); ok {
+			resp.Cached = true
+			resp.Usage = llm.Usage{}
+			resp.Fallbacks = nil
+			return &resp, nil
+		}
+	}
+	resp, err := m.model.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	m.store.Set(key, *resp, m.ttl)
+	return resp, nil
+}
+
+type provider struct {
+	search.Provider
+	store Store
+	ttl   time.Duration
+}
+
+// Search wraps p so that its results are cached in store for ttl, keyed on
+// the provider's name, the query and the limit
+func Search(p search.Provider, store Store, ttl time.Duration) search.Provider {
+	return &provider{Provider: p, store: store, ttl: ttl}
+}
+
+func (p *provider) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	key := "search:" + Key(p.Name(), query, limit)
+	if v, ok := p.store.Get(key); ok {
+		if results, ok := v.([]search.Result); ok {
+			return append([]search.Result(nil), results...), nil
+		}
+	}
+	results, err := p.Provider.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	p.store.Set(key, append([]search.Result(nil), results...), p.ttl)
+	return results, nil
+}
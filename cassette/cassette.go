@@ -0,0 +1,356 @@
+// Package cassette records HTTP interactions to a file and replays them, so
+// that tests and CI can exercise code that calls LLM and search APIs without
+// network access or API keys.
+//
+// A Recorder is an http.RoundTripper. In Record mode it sends every request
+// and stores it with its response; in Replay mode it answers from the
+// cassette and fails on any request that was not recorded; Auto replays what
+// it can and records the rest. Requests match on method, URL and body, after
+// API keys have been redacted from headers and query parameters:
+//
+//	rec, err := cassette.New("testdata/search.json", cassette.Replay)
+//	...
+//	provider := search.NewBrave("key")
+//	provider.Client = rec.Client()
+//	defer rec.Save()
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces secret values in a cassette
+const Redacted = "REDACTED"
+
+// Mode decides whether a Recorder sends requests or replays them
+type Mode int
+
+const (
+	// Replay answers from the cassette and fails on unrecorded requests
+	Replay Mode = iota
+	// Record sends every request and replaces the cassette with them
+	Record
+	// Auto replays recorded requests and records the others
+	Auto
+)
+
+// ParseMode parses "replay", "record" or "auto"
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "replay":
+		return Replay, nil
+	case "record":
+		return Record, nil
+	case "auto":
+		return Auto, nil
+	}
+	return Replay, fmt.Errorf("cassette: unknown mode %q", s)
+}
+
+// ErrUnrecorded is returned in Replay mode for a request the cassette does
+// not contain
+var ErrUnrecorded = errors.New("cassette: request not recorded")
+
+// DefaultRedactHeaders are the headers that carry API keys for common LLM
+// and search APIs
+var DefaultRedactHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "X-Subscription-Token", "Api-Key", "Cookie"}
+
+// DefaultRedactParams are the query parameters that carry API keys
+var DefaultRedactParams = []string{"key", "api_key", "apikey", "access_token", "token"}
+
+// Request is a recorded request
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Interaction is a request and the response it received
+type Interaction struct {
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Body is an HTTP body. It is stored as text when it is valid UTF-8, which
+// keeps JSON APIs readable in the cassette, and as base64 otherwise.
+type Body []byte
+
+type encodedBody struct {
+	Base64 []byte `json:"base64"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(encodedBody{Base64: b})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var enc encodedBody
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	*b = enc.Base64
+	return nil
+}
+
+// Recorder records and replays HTTP interactions. It is safe for concurrent
+// use.
+type Recorder struct {
+	Path string
+	Mode Mode
+	// Transport sends requests in Record and Auto modes; nil means
+	// http.DefaultTransport
+	Transport http.RoundTripper
+	// RedactHeaders and RedactParams name the headers and query parameters
+	// whose values are replaced with Redacted, both in the cassette and in
+	// live requests before they are matched
+	RedactHeaders []string
+	RedactParams  []string
+	// Match reports whether a recorded request answers req; nil means
+	// MatchRequest
+	Match func(req, recorded Request) bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	changed      bool
+}
+
+// New creates a Recorder for the cassette at path. The cassette is loaded
+// unless mode is Record; a missing cassette is empty.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		Path:          path,
+		Mode:          mode,
+		RedactHeaders: DefaultRedactHeaders,
+		RedactParams:  DefaultRedactParams,
+	}
+	if mode == Record {
+		r.interactions, r.changed = []*Interaction{}, true
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("loading cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Client returns an http.Client that sends its requests through r
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the recorded interactions
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Interaction, len(r.interactions))
+	for i, in := range r.interactions {
+		list[i] = *in
+	}
+	return list
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: reading request body: %w", err)
+		}
+	}
+	recorded := r.redact(req, body)
+
+	if r.Mode != Record {
+		if in := r.find(recorded); in != nil {
+			return replay(req, in), nil
+		}
+		if r.Mode == Replay {
+			return nil, fmt.Errorf("%w: %s %s", ErrUnrecorded, recorded.Method, recorded.URL)
+		}
+	}
+
+	live := req.Clone(req.Context())
+	live.Body = io.NopCloser(bytes.NewReader(body))
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(live)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: reading response body: %w", err)
+	}
+
+	header := resp.Header.Clone()
+	r.redactHeader(header)
+	r.mu.Lock()
+	r.interactions = append(r.interactions, &Interaction{
+		Request:    recorded,
+		Response:   Response{StatusCode: resp.StatusCode, Header: header, Body: respBody},
+		RecordedAt: time.Now().UTC(),
+	})
+	r.used = append(r.used, true)
+	r.changed = true
+	r.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// find returns the first unused interaction matching req, or else the last
+// used one, so that repeated identical requests replay in order
+func (r *Recorder) find(req Request) *Interaction {
+	match := r.Match
+	if match == nil {
+		match = MatchRequest
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reuse *Interaction
+	for i, in := range r.interactions {
+		if !match(req, in.Request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return in
+		}
+		reuse = in
+	}
+	return reuse
+}
+
+func replay(req *http.Request, in *Interaction) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}
+}
+
+// redact returns req as it is stored in the cassette
+func (r *Recorder) redact(req *http.Request, body []byte) Request {
+	u := *req.URL
+	if len(r.RedactParams) > 0 && u.RawQuery != "" {
+		q := u.Query()
+		for _, p := range r.RedactParams {
+			if q.Has(p) {
+				q.Set(p, Redacted)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	header := req.Header.Clone()
+	r.redactHeader(header)
+	return Request{Method: req.Method, URL: u.String(), Header: header, Body: body}
+}
+
+func (r *Recorder) redactHeader(h http.Header) {
+	for _, name := range r.RedactHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, Redacted)
+		}
+	}
+}
+
+// MatchRequest matches requests on method, URL and body. Query parameters
+// may come in any order, and JSON bodies match when they encode the same
+// value.
+func MatchRequest(req, recorded Request) bool {
+	return req.Method == recorded.Method && sameURL(req.URL, recorded.URL) && sameBody(req.Body, recorded.Body)
+}
+
+func sameURL(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	qa, qb := ua.Query(), ub.Query()
+	ua.RawQuery, ub.RawQuery = "", ""
+	return ua.String() == ub.String() && qa.Encode() == qb.Encode()
+}
+
+func sameBody(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+// Save writes the cassette if anything was recorded
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("saving cassette: %w", err)
+	}
+	if err := os.WriteFile(r.Path, data, 0o644); err != nil {
+		return fmt.Errorf("saving cassette: %w", err)
+	}
+	r.changed = false
+	return nil
+}
@@ -0,0 +1,119 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+func braveServer(t *testing.T, calls *int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if r.Header.Get("X-Subscription-Token") != "secret-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"web": {"results": [{"title": "Go", "url": "https://go.dev", "description": "The Go language"}]}}`)
+	}))
+}
+
+func TestRecorder_RecordThenReplay(t *testing.T) {
+	calls := 0
+	srv := braveServer(t, &calls)
+	path := filepath.Join(t.TempDir(), "brave.json")
+
+	rec, err := New(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brave := &search.Brave{APIKey: "secret-key", BaseURL: srv.URL, Client: rec.Client()}
+	if _, err := brave.Search(context.Background(), "golang", 3); err != nil {
+		t.Fatalf("recording Search error = %v", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-key") || !strings.Contains(string(data), Redacted) {
+		t.Fatalf("API key was not redacted:\n%s", data)
+	}
+
+	// The server is gone: replay must not touch the network
+	replay, err := New(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brave.Client = replay.Client()
+	brave.APIKey = "another-key"
+	results, err := brave.Search(context.Background(), "golang", 3)
+	if err != nil || len(results) != 1 || results[0].URL != "https://go.dev" {
+		t.Fatalf("replayed Search() = %v, %v", results, err)
+	}
+	if calls != 1 {
+		t.Errorf("server received %d requests, want 1", calls)
+	}
+
+	if _, err := brave.Search(context.Background(), "rust", 3); !errors.Is(err, ErrUnrecorded) {
+		t.Errorf("unrecorded Search error = %v, want ErrUnrecorded", err)
+	}
+}
+
+func TestRecorder_AutoRecordsNewRequests(t *testing.T) {
+	calls := 0
+	srv := braveServer(t, &calls)
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "brave.json")
+
+	rec, err := New(path, Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brave := &search.Brave{APIKey: "secret-key", BaseURL: srv.URL, Client: rec.Client()}
+	for i := 0; i < 3; i++ {
+		if _, err := brave.Search(context.Background(), "golang", 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 || len(rec.Interactions()) != 1 {
+		t.Errorf("server received %d requests with %d recorded, want 1", calls, len(rec.Interactions()))
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	a := Request{Method: "POST", URL: "https://api.example.com/v1?b=2&a=1", Body: Body(`{"prompt": "hi", "n": 1}`)}
+	b := Request{Method: "POST", URL: "https://api.example.com/v1?a=1&b=2", Body: Body(`{"n":1,"prompt":"hi"}`)}
+	if !MatchRequest(a, b) {
+		t.Error("equivalent requests did not match")
+	}
+	b.Body = Body(`{"n":2,"prompt":"hi"}`)
+	if MatchRequest(a, b) {
+		t.Error("requests with different bodies matched")
+	}
+}
+
+func TestBody_BinaryRoundTrip(t *testing.T) {
+	in := Body{0xff, 0x00, 0xfe}
+	data, err := in.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Body
+	if err := out.UnmarshalJSON(data); err != nil || string(out) != string(in) {
+		t.Errorf("round trip = %v, %v; want %v", out, err, in)
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+)
+
+// Checkpoint is a suspended run saved to a file so a later invocation can
+// resume it
+type Checkpoint struct {
+	// Flow is the registered name or YAML path of the flow
+	Flow string `json:"flow"`
+	// Node is the suspended node
+	Node string `json:"node"`
+	// Path names the nested flows that enclose Node, outermost first
+	Path []string `json:"path,omitempty"`
+	// Shared holds the values of the shared state that can be encoded as
+	// JSON; others, such as clients, are supplied again by Prepare
+	Shared    map[string]interface{} `json:"shared"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// SaveCheckpoint writes cp to path
+func SaveCheckpoint(path string, cp *Checkpoint) error {
+	saved := *cp
+	saved.Shared = state.Encodable(cp.Shared)
+	data, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	// Write then rename so a crash never leaves a half-written file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("loading checkpoint %s: %w", path, err)
+	}
+	if cp.Node == "" {
+		return nil, fmt.Errorf("loading checkpoint %s: no suspended node", path)
+	}
+	return &cp, nil
+}
+
+// checkpointName is the default checkpoint file of a flow
+func checkpointName(flow string) string {
+	base := strings.TrimSuffix(filepath.Base(flow), filepath.Ext(flow))
+	return base + ".checkpoint.json"
+}
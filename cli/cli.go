@@ -0,0 +1,472 @@
+// Package cli implements a command-line runner for flows.
+//
+// An App runs a flow registered in Go or defined in a YAML file (see package
+// flowdef) with shared input taken from flags, a JSON file or stdin. It
+// prints the run's events as they happen, can record them to a JSON Lines
+// trace, and prints the final shared state as JSON. A suspended run is saved
+// to a checkpoint file that a later invocation resumes. The exit code tells
+// how the run ended.
+//
+// The goagent command is an App with the built-in node types only; programs
+// with their own nodes and flows build their own:
+//
+//	app := &cli.App{Name: "research", Flows: map[string]func() *agent.Flow{
+//		"research": func() *agent.Flow { return CreateResearchAgent(nil) },
+//	}}
+//	os.Exit(app.Run(os.Args[1:]))
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/flowdef"
+	"github.com/utkarsh-cpu/go_agent/history"
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+	"github.com/utkarsh-cpu/go_agent/secrets"
+)
+
+// Exit codes returned by App.Run. An action mapped with --exit returns its
+// own code instead.
+const (
+	ExitOK          = 0
+	ExitFailed      = 1
+	ExitUsage       = 2
+	ExitSuspended   = 3
+	ExitInvalid     = 4
+	ExitInterrupted = 130
+)
+
+// DefaultContextKey is the shared key of a run's context
+const DefaultContextKey = "ctx"
+
+// App is a command-line runner for flows
+type App struct {
+	// Name is the program name shown in usage messages
+	Name string
+	// Flows are the flows that can be run by name
+	Flows map[string]func() *agent.Flow
+	// Nodes are the node types available to YAML flows; nil means
+	// flowdef.Builtins()
+	Nodes flowdef.Registry
+	// Prepare, when set, is called before every run to add values that
+	// cannot be given as JSON, such as LLM clients, to the shared input
+	Prepare func(ctx context.Context, flow string, shared map[string]interface{}) error
+	// ContextKey names the shared key that receives the run's context, which
+	// is canceled on interrupt; empty means DefaultContextKey
+	ContextKey string
+	// Secrets, when set, is checked for the secrets the flow's nodes
+	// require before the run, given to the nodes in
+	// shared[secrets.SharedKey], and redacted from the printed events, the
+	// trace, the output and checkpoints
+	Secrets *secrets.Store
+	// History, when set, records every run, after redacting its secrets
+	History history.Store
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// options are the parsed command-line flags
+type options struct {
+	flow       string
+	sets       keyValues
+	input      string
+	dryRun     bool
+	resume     string
+	action     string
+	checkpoint string
+	trace      string
+	output     string
+	quiet      bool
+	exits      keyValues
+}
+
+// keyValues collects repeated key=value flags
+type keyValues [][2]string
+
+func (kv *keyValues) String() string {
+	return fmt.Sprint(*kv)
+}
+
+func (kv *keyValues) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("%q is not key=value", s)
+	}
+	*kv = append(*kv, [2]string{k, v})
+	return nil
+}
+
+func (a *App) flagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(a.Name, flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	fs.Var(&opts.sets, "set", "set a shared `key=value`; the value is parsed as JSON when it can be (repeatable)")
+	fs.StringVar(&opts.input, "input", "", "read the shared input from a JSON `file`, or stdin with -")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "validate the flow and print it as a Mermaid chart without running it")
+	fs.StringVar(&opts.resume, "resume", "", "resume the suspended run saved in a checkpoint `file`")
+	fs.StringVar(&opts.action, "action", "default", "the `action` a resumed node continues with")
+	fs.StringVar(&opts.checkpoint, "checkpoint", "", "where to save a suspended run (default <flow>.checkpoint.json)")
+	fs.StringVar(&opts.trace, "trace", "", "record every event to a JSON Lines `file`")
+	fs.StringVar(&opts.output, "output", "", "print only this shared `key` instead of the whole shared state")
+	fs.BoolVar(&opts.quiet, "quiet", false, "do not print events")
+	fs.Var(&opts.exits, "exit", "exit with `action=code` when the flow ends on action (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(a.Stderr, "Usage: %s [flags] <flow name | flow.yaml>\n\n", a.Name)
+		if names := a.flowNames(); len(names) > 0 {
+			fmt.Fprintf(a.Stderr, "Flows: %s\n\n", strings.Join(names, ", "))
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse reads the flags before and after the flow argument
+func (a *App) parse(args []string) (*options, error) {
+	opts := &options{}
+	fs := a.flagSet(opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		opts.flow = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return nil, err
+		}
+		if fs.NArg() > 0 {
+			return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+		}
+	}
+	if opts.flow == "" && opts.resume == "" {
+		return nil, errors.New("no flow given")
+	}
+	return opts, nil
+}
+
+// Run runs the command with args, not including the program name, and returns
+// the exit code
+func (a *App) Run(args []string) int {
+	if a.Name == "" {
+		a.Name = "goagent"
+	}
+	if a.Stdin == nil {
+		a.Stdin = os.Stdin
+	}
+	if a.Stdout == nil {
+		a.Stdout = os.Stdout
+	}
+	if a.Stderr == nil {
+		a.Stderr = os.Stderr
+	}
+
+	opts, err := a.parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		fmt.Fprintf(a.Stderr, "%s: %v\n", a.Name, err)
+		return ExitUsage
+	}
+
+	var cp *Checkpoint
+	if opts.resume != "" {
+		if cp, err = LoadCheckpoint(opts.resume); err != nil {
+			return a.fail(ExitUsage, err)
+		}
+		if opts.flow == "" {
+			opts.flow = cp.Flow
+		}
+	}
+
+	flow, err := a.build(opts.flow)
+	if err != nil {
+		return a.fail(ExitInvalid, err)
+	}
+	if err := flow.Validate(); err != nil {
+		return a.fail(ExitInvalid, err)
+	}
+	if a.Secrets != nil {
+		if err := secrets.Check(flow, a.Secrets); err != nil {
+			return a.fail(ExitInvalid, err)
+		}
+	}
+	if opts.dryRun {
+		fmt.Fprintf(a.Stderr, "%s: flow %q is valid\n", a.Name, opts.flow)
+		fmt.Fprint(a.Stdout, flow.Graph().Mermaid())
+		return ExitOK
+	}
+
+	// A stale or edited checkpoint may name a node the flow no longer has
+	if cp != nil && flow.Locate(cp.Path, cp.Node) == nil {
+		return a.fail(ExitFailed, fmt.Errorf("checkpoint %s: node %q not found in flow %q", opts.resume, cp.Node, opts.flow))
+	}
+
+	shared := make(map[string]interface{})
+	if cp != nil {
+		for k, v := range cp.Shared {
+			shared[k] = v
+		}
+	}
+	if err := a.readInput(opts, shared); err != nil {
+		return a.fail(ExitUsage, err)
+	}
+	return a.execute(opts, flow, shared, cp)
+}
+
+// build returns the flow registered under name, or the flow defined in the
+// YAML file at name
+func (a *App) build(name string) (*agent.Flow, error) {
+	if factory, ok := a.Flows[name]; ok {
+		return factory(), nil
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".yaml" && ext != ".yml" {
+		return nil, fmt.Errorf("unknown flow %q; known flows: %s", name, strings.Join(a.flowNames(), ", "))
+	}
+	def, err := flowdef.LoadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	nodes := a.Nodes
+	if nodes == nil {
+		nodes = flowdef.Builtins()
+	}
+	flow, err := def.Build(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return flow, nil
+}
+
+func (a *App) flowNames() []string {
+	names := make([]string, 0, len(a.Flows))
+	for name := range a.Flows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readInput merges the JSON input and the --set flags into shared
+func (a *App) readInput(opts *options, shared map[string]interface{}) error {
+	if opts.input != "" {
+		var r io.Reader = a.Stdin
+		if opts.input != "-" {
+			f, err := os.Open(opts.input)
+			if err != nil {
+				return fmt.Errorf("reading input: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		var input map[string]interface{}
+		if err := json.NewDecoder(r).Decode(&input); err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+		for k, v := range input {
+			shared[k] = v
+		}
+	}
+	for _, kv := range opts.sets {
+		var v interface{}
+		if err := json.Unmarshal([]byte(kv[1]), &v); err != nil {
+			v = kv[1]
+		}
+		shared[kv[0]] = v
+	}
+	return nil
+}
+
+// execute runs or resumes the flow and reports how it ended
+func (a *App) execute(opts *options, flow *agent.Flow, shared map[string]interface{}, cp *Checkpoint) (code int) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctxKey := a.ContextKey
+	if ctxKey == "" {
+		ctxKey = DefaultContextKey
+	}
+	shared[ctxKey] = ctx
+	if a.Secrets != nil {
+		shared[secrets.SharedKey] = a.Secrets
+	}
+	if a.Prepare != nil {
+		if err := a.Prepare(ctx, opts.flow, shared); err != nil {
+			return a.fail(ExitFailed, err)
+		}
+	}
+
+	var trace *json.Encoder
+	if opts.trace != "" {
+		f, err := os.Create(opts.trace)
+		if err != nil {
+			return a.fail(ExitUsage, fmt.Errorf("creating trace: %w", err))
+		}
+		defer f.Close()
+		trace = json.NewEncoder(f)
+	}
+	var rec *history.Recorder
+	if a.History != nil {
+		input := shared
+		if a.Secrets != nil {
+			input = a.Secrets.RedactValue(shared).(map[string]interface{})
+		}
+		rec = history.NewRecorder(opts.flow, input)
+	}
+	var last agent.Event
+	flow.Observe(func(ev agent.Event) {
+		if a.Secrets != nil {
+			ev = a.Secrets.RedactEvent(ev)
+		}
+		last = ev
+		if rec != nil {
+			rec.Observe(ev)
+		}
+		if trace != nil {
+			if err := trace.Encode(ev); err != nil {
+				fmt.Fprintf(a.Stderr, "%s: writing trace: %v\n", a.Name, err)
+				trace = nil
+			}
+		}
+		if !opts.quiet {
+			printEvent(a.Stderr, ev)
+		}
+	})
+
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("flow panicked: %v", r)
+			if rec != nil {
+				out := state.Encodable(shared)
+				if a.Secrets != nil {
+					delete(out, secrets.SharedKey)
+					out = a.Secrets.RedactValue(out).(map[string]interface{})
+				}
+				a.record(rec, out, err)
+			}
+			code = a.fail(ExitFailed, err)
+		}
+	}()
+	var result interface{}
+	if cp != nil {
+		result = flow.ResumeSuspension(shared, &agent.Suspension{Node: cp.Node, Path: cp.Path}, opts.action)
+	} else {
+		result = flow.Run(shared)
+	}
+	delete(shared, ctxKey)
+	if a.Secrets != nil {
+		delete(shared, secrets.SharedKey)
+		shared = a.Secrets.RedactValue(shared).(map[string]interface{})
+	}
+	if rec != nil {
+		a.record(rec, shared, result)
+	}
+
+	if s, ok := result.(*agent.Suspension); ok {
+		path := opts.checkpoint
+		if path == "" {
+			path = checkpointName(opts.flow)
+		}
+		if err := SaveCheckpoint(path, &Checkpoint{Flow: opts.flow, Node: s.Node, Path: s.Path, Shared: shared, CreatedAt: time.Now()}); err != nil {
+			return a.fail(ExitFailed, err)
+		}
+		fmt.Fprintf(a.Stderr, "%s: run suspended at %q; resume with --resume %s --action <action>\n", a.Name, s.Node, path)
+		return ExitSuspended
+	}
+
+	if err := a.writeOutput(opts, shared); err != nil {
+		return a.fail(ExitFailed, err)
+	}
+	if ctx.Err() != nil {
+		return ExitInterrupted
+	}
+	for _, kv := range opts.exits {
+		if kv[0] == last.Action {
+			if code, err := strconv.Atoi(kv[1]); err == nil {
+				return code
+			}
+		}
+	}
+	if last.Type == agent.FlowFailed {
+		return ExitFailed
+	}
+	return ExitOK
+}
+
+// record saves the run followed by rec to a.History. A failure to save is
+// reported but does not fail the run.
+func (a *App) record(rec *history.Recorder, shared map[string]interface{}, result interface{}) {
+	run := rec.Finish(shared, result)
+	if err := a.History.Save(context.Background(), run); err != nil {
+		a.fail(0, fmt.Errorf("recording run: %w", err))
+	}
+}
+
+// writeOutput prints shared[opts.output], or the whole shared state, as JSON
+func (a *App) writeOutput(opts *options, shared map[string]interface{}) error {
+	if opts.output != "" {
+		if s, ok := shared[opts.output].(string); ok {
+			_, err := fmt.Fprintln(a.Stdout, s)
+			return err
+		}
+		return writeJSON(a.Stdout, shared[opts.output])
+	}
+	return writeJSON(a.Stdout, state.Encodable(shared))
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+func (a *App) fail(code int, err error) int {
+	msg := err.Error()
+	if a.Secrets != nil {
+		msg = a.Secrets.Redact(msg)
+	}
+	fmt.Fprintf(a.Stderr, "%s: %s\n", a.Name, msg)
+	return code
+}
+
+// printEvent writes one line per event
+func printEvent(w io.Writer, ev agent.Event) {
+	line := fmt.Sprintf("%s %-15s", ev.Time.Format("15:04:05.000"), ev.Type)
+	switch ev.Type {
+	case agent.NodeStarted:
+		line += " " + ev.Node
+	case agent.ExecAttempt:
+		line += fmt.Sprintf(" %s attempt %d", ev.Node, ev.Attempt)
+	case agent.RetryScheduled:
+		line += fmt.Sprintf(" %s in %s: %s", ev.Node, ev.Wait, ev.Error)
+	case agent.ExecFailed:
+		line += fmt.Sprintf(" %s attempt %d: %s", ev.Node, ev.Attempt, ev.Error)
+	case agent.NodeCompleted:
+		line += fmt.Sprintf(" %s -> %q", ev.Node, ev.Action)
+		if ev.Skipped {
+			line += " (skipped)"
+		}
+	case agent.Transition:
+		line += fmt.Sprintf(" %s -[%s]-> %s", ev.Node, ev.Action, ev.Next)
+	case agent.FlowCompleted:
+		line += fmt.Sprintf(" %q", ev.Action)
+	case agent.FlowFailed:
+		line += " " + ev.Error
+	}
+	fmt.Fprintln(w, line)
+}
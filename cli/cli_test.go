@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/history"
+	"github.com/utkarsh-cpu/go_agent/secrets"
+)
+
+const triage = `
+name: triage
+start: classify
+nodes:
+  classify:
+    type: route
+    params: {key: kind, default: other}
+    next: {bug: file_bug}
+  file_bug:
+    type: set
+    params:
+      values: {status: filed}
+      action: filed
+`
+
+func writeFlow(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "triage.yaml")
+	if err := os.WriteFile(path, []byte(triage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func run(app *App, args ...string) (int, string, string) {
+	var stdout, stderr strings.Builder
+	app.Stdout, app.Stderr = &stdout, &stderr
+	code := app.Run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_YAMLFlow(t *testing.T) {
+	flow := writeFlow(t)
+	trace := filepath.Join(t.TempDir(), "trace.jsonl")
+
+	code, stdout, stderr := run(&App{}, "--set", "kind=bug", "--set", "count=3", flow, "--trace", trace)
+	if code != ExitOK {
+		t.Fatalf("exit code = %d, want %d; stderr:\n%s", code, ExitOK, stderr)
+	}
+	var shared map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &shared); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if shared["status"] != "filed" || shared["count"] != 3.0 {
+		t.Errorf("shared = %v", shared)
+	}
+	if !strings.Contains(stderr, "node_started") || !strings.Contains(stderr, "file_bug") {
+		t.Errorf("events not printed:\n%s", stderr)
+	}
+
+	f, err := os.Open(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var types []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev agent.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("trace line %q: %v", scanner.Text(), err)
+		}
+		types = append(types, string(ev.Type))
+	}
+	if len(types) == 0 || types[0] != "flow_started" || types[len(types)-1] != "flow_completed" {
+		t.Errorf("trace = %v", types)
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	flow := writeFlow(t)
+
+	if code, _, _ := run(&App{}, "--quiet", "--set", "kind=bug", "--exit", "filed=7", flow); code != 7 {
+		t.Errorf("mapped action exit code = %d, want 7", code)
+	}
+	if code, _, _ := run(&App{}, "--bogus", flow); code != ExitUsage {
+		t.Errorf("unknown flag exit code = %d, want %d", code, ExitUsage)
+	}
+	if code, _, _ := run(&App{}, "missing"); code != ExitInvalid {
+		t.Errorf("unknown flow exit code = %d, want %d", code, ExitInvalid)
+	}
+
+	app := &App{Flows: map[string]func() *agent.Flow{
+		"fail": func() *agent.Flow { return agent.NewFlow(&actionNode{BaseNode: agent.NewBaseNode(), action: "error"}) },
+	}}
+	if code, _, _ := run(app, "--quiet", "fail"); code != ExitFailed {
+		t.Errorf("error action exit code = %d, want %d", code, ExitFailed)
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	code, stdout, stderr := run(&App{}, "--dry-run", writeFlow(t))
+	if code != ExitOK {
+		t.Fatalf("exit code = %d; stderr:\n%s", code, stderr)
+	}
+	if !strings.Contains(stdout, "flowchart TD") || !strings.Contains(stdout, "-->|bug|") {
+		t.Errorf("chart = %s", stdout)
+	}
+	if strings.Contains(stderr, "node_started") {
+		t.Error("dry run executed the flow")
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.yaml")
+	os.WriteFile(bad, []byte("start: a\nnodes:\n  a: {type: llm}\n"), 0o644)
+	if code, _, stderr := run(&App{}, "--dry-run", bad); code != ExitInvalid || !strings.Contains(stderr, `unknown type "llm"`) {
+		t.Errorf("invalid flow exit code = %d, stderr = %s", code, stderr)
+	}
+}
+
+// actionNode ends with a fixed action
+type actionNode struct {
+	*agent.BaseNode
+	action string
+}
+
+func (n *actionNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	return n.action
+}
+
+// approvalNode suspends the flow to wait for a decision
+type approvalNode struct {
+	*agent.BaseNode
+}
+
+func (n *approvalNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["asked"] = true
+	return &agent.Suspension{Reason: "approval"}
+}
+
+func TestRun_SuspendAndResume(t *testing.T) {
+	app := &App{Flows: map[string]func() *agent.Flow{
+		"approve": func() *agent.Flow {
+			ask := &approvalNode{BaseNode: agent.NewBaseNode()}
+			ask.SetName("ask")
+			ask.Next(&actionNode{BaseNode: agent.NewBaseNode(), action: "sent"}, "approve")
+			return agent.NewFlow(ask)
+		},
+	}}
+	checkpoint := filepath.Join(t.TempDir(), "run.json")
+
+	code, _, stderr := run(app, "--quiet", "--checkpoint", checkpoint, "--set", "draft=hi", "approve")
+	if code != ExitSuspended {
+		t.Fatalf("exit code = %d, want %d; stderr:\n%s", code, ExitSuspended, stderr)
+	}
+	cp, err := LoadCheckpoint(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Flow != "approve" || cp.Node != "ask" || cp.Shared["draft"] != "hi" {
+		t.Errorf("checkpoint = %+v", cp)
+	}
+	if _, ok := cp.Shared[DefaultContextKey]; ok {
+		t.Error("the run's context was saved in the checkpoint")
+	}
+
+	code, stdout, stderr := run(app, "--quiet", "--resume", checkpoint, "--action", "approve", "--exit", "sent=0")
+	if code != ExitOK {
+		t.Fatalf("resume exit code = %d; stderr:\n%s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"draft": "hi"`) {
+		t.Errorf("resumed shared state = %s", stdout)
+	}
+
+	// A checkpoint naming a node the flow does not have fails the run
+	cp.Node = "removed"
+	if err := SaveCheckpoint(checkpoint, cp); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr = run(app, "--quiet", "--resume", checkpoint, "--action", "approve")
+	if code != ExitFailed || stdout != "" || !strings.Contains(stderr, `node "removed" not found`) {
+		t.Errorf("resume of a stale checkpoint = %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
+
+// keyNode reads an API key and echoes it, as a careless node might
+type keyNode struct {
+	*agent.BaseNode
+}
+
+func (n *keyNode) RequiredSecrets() []string {
+	return []string{"API_KEY"}
+}
+
+func (n *keyNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	key, err := secrets.Get(shared, "API_KEY")
+	if err != nil {
+		return err
+	}
+	shared["debug"] = "called with " + key
+	return &agent.Suspension{Reason: "approval"}
+}
+
+func TestRun_Secrets(t *testing.T) {
+	flows := map[string]func() *agent.Flow{
+		"keyed": func() *agent.Flow { return agent.NewFlow(&keyNode{BaseNode: agent.NewBaseNode()}) },
+	}
+
+	app := &App{Flows: flows, Secrets: secrets.NewStore(secrets.Map{})}
+	code, _, stderr := run(app, "--dry-run", "keyed")
+	if code != ExitInvalid || !strings.Contains(stderr, "API_KEY") {
+		t.Fatalf("exit code = %d, want %d for a missing secret; stderr:\n%s", code, ExitInvalid, stderr)
+	}
+
+	app = &App{Flows: flows, Secrets: secrets.NewStore(secrets.Map{"API_KEY": "sk-12345"})}
+	checkpoint := filepath.Join(t.TempDir(), "run.json")
+	code, _, stderr = run(app, "--quiet", "--checkpoint", checkpoint, "keyed")
+	if code != ExitSuspended {
+		t.Fatalf("exit code = %d, want %d; stderr:\n%s", code, ExitSuspended, stderr)
+	}
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-12345") || !strings.Contains(string(data), "called with [REDACTED:API_KEY]") {
+		t.Errorf("checkpoint does not redact the secret:\n%s", data)
+	}
+}
+
+func TestRun_History(t *testing.T) {
+	flows := map[string]func() *agent.Flow{
+		"keyed": func() *agent.Flow { return agent.NewFlow(&keyNode{BaseNode: agent.NewBaseNode()}) },
+	}
+	store := history.NewMemory()
+	app := &App{Flows: flows, Secrets: secrets.NewStore(secrets.Map{"API_KEY": "sk-12345"}), History: store}
+	run(app, "--quiet", "--checkpoint", filepath.Join(t.TempDir(), "run.json"), "keyed")
+	run(&App{Flows: map[string]func() *agent.Flow{}, History: store}, "--quiet", "--set", "kind=bug", writeFlow(t))
+
+	runs, err := store.Query(context.Background(), history.Filter{})
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("Query = %d runs, %v, want 2", len(runs), err)
+	}
+	triage, keyed := runs[0], runs[1]
+	if keyed.Flow != "keyed" || keyed.Status != history.Suspended || keyed.Output["debug"] != "called with [REDACTED:API_KEY]" {
+		t.Fatalf("keyed run = %+v", keyed)
+	}
+	if triage.Status != history.Succeeded || triage.Action != "filed" || triage.Input["kind"] != "bug" ||
+		strings.Join(triage.Path, ",") != "classify,file_bug" {
+		t.Fatalf("triage run = %+v", triage)
+	}
+}
@@ -0,0 +1,19 @@
+// Command goagent runs flows defined in YAML with the built-in node types.
+//
+// Usage:
+//
+//	goagent [flags] flow.yaml
+//
+// Run goagent -h for the flags. See package cli for building a runner with
+// your own nodes and flows.
+package main
+
+import (
+	"os"
+
+	"github.com/utkarsh-cpu/go_agent/cli"
+)
+
+func main() {
+	os.Exit((&cli.App{Name: "goagent"}).Run(os.Args[1:]))
+}
@@ -0,0 +1,156 @@
+// Package contextbudget keeps prompts inside a model's context window.
+//
+// A Manager splits a token budget across named sections (for example the
+// question, the conversation history and fresh search results) and applies
+// each section's Strategy to shrink it to its share.
+package contextbudget
+
+import (
+	"context"
+	"fmt"
+)
+
+// Section is one part of the context window
+type Section struct {
+	Name string
+	// Chunks are ordered oldest first
+	Chunks []Chunk
+	// Weight is the section's share of the budget relative to the other
+	// sections. Sections with no weight only get budget left over by others.
+	Weight float64
+	// Strategy shrinks the section when it exceeds its share. TruncateOldest
+	// is used when nil.
+	Strategy Strategy
+	// Separator joins chunks when rendering; "\n\n" when empty
+	Separator string
+}
+
+// Manager allocates a token budget across sections
+type Manager struct {
+	Tokenizer Tokenizer
+	// MaxTokens is the size of the context window available for sections
+	MaxTokens int
+	// Reserve is subtracted from MaxTokens for the prompt template and the
+	// model's answer
+	Reserve int
+}
+
+// New creates a Manager for maxTokens using the heuristic tokenizer
+func New(maxTokens int) *Manager {
+	return &Manager{
+		Tokenizer: HeuristicTokenizer{},
+		MaxTokens: maxTokens,
+	}
+}
+
+// Fitted holds the sections after they have been shrunk to their budgets
+type Fitted struct {
+	Sections map[string]Section
+	Budgets  map[string]int
+	Used     int
+}
+
+// Text renders the named section, or "" if it does not exist
+func (f *Fitted) Text(name string) string {
+	s, ok := f.Sections[name]
+	if !ok {
+		return ""
+	}
+	sep := s.Separator
+	if sep == "" {
+		sep = "\n\n"
+	}
+	return Join(s.Chunks, sep)
+}
+
+// Count returns the number of tokens in text
+func (m *Manager) Count(text string) int {
+	return m.tokenizer().Count(text)
+}
+
+// Allocate computes each section's token budget. Budget is handed out in
+// proportion to weight; whatever a section does not need is redistributed to
+// the sections that still want more.
+func (m *Manager) Allocate(sections []Section) map[string]int {
+	tok := m.tokenizer()
+	remaining := m.MaxTokens - m.Reserve
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	need := make(map[string]int, len(sections))
+	budgets := make(map[string]int, len(sections))
+	open := make(map[string]float64)
+	for _, s := range sections {
+		need[s.Name] = total(s.Chunks, tok)
+		open[s.Name] = s.Weight
+	}
+
+	for remaining > 0 && len(open) > 0 {
+		weightSum := 0.0
+		for _, w := range open {
+			weightSum += w
+		}
+
+		handed := 0
+		for _, s := range sections {
+			w, ok := open[s.Name]
+			if !ok {
+				continue
+			}
+			var share int
+			if weightSum > 0 {
+				share = int(float64(remaining) * w / weightSum)
+			} else {
+				// Only unweighted sections are left; split evenly
+				share = remaining / len(open)
+			}
+			if want := need[s.Name] - budgets[s.Name]; share >= want {
+				share = want
+				delete(open, s.Name)
+			}
+			budgets[s.Name] += share
+			handed += share
+		}
+		if handed == 0 {
+			break
+		}
+		remaining -= handed
+	}
+	return budgets
+}
+
+// Fit allocates the budget and applies each section's strategy
+func (m *Manager) Fit(ctx context.Context, sections ...Section) (*Fitted, error) {
+	tok := m.tokenizer()
+	budgets := m.Allocate(sections)
+
+	fitted := &Fitted{
+		Sections: make(map[string]Section, len(sections)),
+		Budgets:  budgets,
+	}
+	for _, s := range sections {
+		budget := budgets[s.Name]
+		if total(s.Chunks, tok) > budget {
+			strategy := s.Strategy
+			if strategy == nil {
+				strategy = TruncateOldest{}
+			}
+			chunks, err := strategy.Fit(ctx, s.Chunks, budget, tok)
+			if err != nil {
+				return nil, fmt.Errorf("fitting section %q: %w", s.Name, err)
+			}
+			s.Chunks = chunks
+		}
+		fitted.Sections[s.Name] = s
+		fitted.Used += total(s.Chunks, tok)
+	}
+	return fitted, nil
+}
+
+func (m *Manager) tokenizer() Tokenizer {
+	if m.Tokenizer == nil {
+		return HeuristicTokenizer{}
+	}
+	return m.Tokenizer
+}
@@ -0,0 +1,130 @@
+package contextbudget
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// wordTokenizer counts one token per whitespace separated word
+var wordTokenizer = TokenizerFunc(func(text string) int {
+	return len(strings.Fields(text))
+})
+
+func TestHeuristicTokenizer(t *testing.T) {
+	tok := HeuristicTokenizer{}
+	if got := tok.Count(""); got != 0 {
+		t.Fatalf("Expected 0 tokens for empty text, got %d", got)
+	}
+	if got := tok.Count("abcdefgh"); got != 2 {
+		t.Fatalf("Expected 2 tokens for 8 chars, got %d", got)
+	}
+	if got := tok.Count("a b c d e"); got != 5 {
+		t.Fatalf("Expected word count floor of 5, got %d", got)
+	}
+}
+
+func TestTruncate_KeepsRunesIntact(t *testing.T) {
+	text := strings.Repeat("héllo wörld ", 50)
+	tok := HeuristicTokenizer{}
+
+	head := Truncate(text, 10, tok)
+	tail := TruncateStart(text, 10, tok)
+	for _, s := range []string{head, tail} {
+		if !utf8.ValidString(s) {
+			t.Fatalf("Truncation produced invalid UTF-8: %q", s)
+		}
+		if tok.Count(s) > 10 {
+			t.Fatalf("Truncation exceeded budget: %d tokens", tok.Count(s))
+		}
+	}
+	if !strings.HasPrefix(tail, "...") {
+		t.Fatalf("Expected TruncateStart to mark dropped text, got %q", tail)
+	}
+}
+
+func TestTruncateOldest(t *testing.T) {
+	chunks := []Chunk{{Text: "one two three"}, {Text: "four five"}, {Text: "six"}}
+	kept, err := TruncateOldest{}.Fit(context.Background(), chunks, 4, wordTokenizer)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	if got := Join(kept, "|"); got != "...three|four five|six" {
+		t.Fatalf("Unexpected chunks: %q", got)
+	}
+}
+
+func TestKeepRelevant_PreservesOrder(t *testing.T) {
+	chunks := ScoreKeywords("paris population", []Chunk{
+		{Text: "Paris has a population of two million"},
+		{Text: "Cookie banner text here"},
+		{Text: "The population grew"},
+	})
+	kept, err := KeepRelevant{}.Fit(context.Background(), chunks, 10, wordTokenizer)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	if got := Join(kept, "|"); got != "Paris has a population of two million|The population grew" {
+		t.Fatalf("Unexpected chunks: %q", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var summarized string
+	s := Summarize{Summarizer: func(ctx context.Context, text string, maxTokens int) (string, error) {
+		summarized = text
+		return "short summary", nil
+	}}
+
+	chunks := []Chunk{{Text: "a b c d e f"}, {Text: "g h i j"}, {Text: "latest"}}
+	kept, err := s.Fit(context.Background(), chunks, 6, wordTokenizer)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	if summarized != "a b c d e f\n\ng h i j" {
+		t.Fatalf("Expected older chunks to be summarized, got %q", summarized)
+	}
+	if got := Join(kept, "|"); got != "short summary|latest" {
+		t.Fatalf("Unexpected chunks: %q", got)
+	}
+
+	failing := Summarize{Summarizer: func(ctx context.Context, text string, maxTokens int) (string, error) {
+		return "", errors.New("llm down")
+	}}
+	if _, err := failing.Fit(context.Background(), chunks, 6, wordTokenizer); err == nil {
+		t.Fatalf("Expected summarizer error to propagate")
+	}
+}
+
+func TestManager_AllocateRedistributes(t *testing.T) {
+	m := &Manager{Tokenizer: wordTokenizer, MaxTokens: 22, Reserve: 2}
+	sections := []Section{
+		{Name: "question", Chunks: []Chunk{{Text: "one two"}}, Weight: 1},
+		{Name: "history", Chunks: []Chunk{{Text: strings.Repeat("h ", 30)}}, Weight: 1},
+		{Name: "results", Chunks: []Chunk{{Text: strings.Repeat("r ", 30)}}, Weight: 2},
+	}
+
+	budgets := m.Allocate(sections)
+	if budgets["question"] != 2 {
+		t.Fatalf("Expected question to get only what it needs, got %d", budgets["question"])
+	}
+	if sum := budgets["question"] + budgets["history"] + budgets["results"]; sum != 20 {
+		t.Fatalf("Expected the whole budget to be allocated, got %d (%v)", sum, budgets)
+	}
+	if budgets["results"] <= budgets["history"] {
+		t.Fatalf("Expected results to get the larger share, got %v", budgets)
+	}
+
+	fitted, err := m.Fit(context.Background(), sections...)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	if fitted.Used > 20 {
+		t.Fatalf("Fitted sections exceed budget: %d", fitted.Used)
+	}
+	if fitted.Text("question") != "one two" {
+		t.Fatalf("Question should be untouched, got %q", fitted.Text("question"))
+	}
+}
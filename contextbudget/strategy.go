@@ -0,0 +1,180 @@
+package contextbudget
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Chunk is a unit of content that is kept or dropped as a whole
+type Chunk struct {
+	Text      string
+	Relevance float64
+}
+
+// Strategy shrinks a section's chunks to fit a token budget. Chunks are
+// ordered oldest first.
+type Strategy interface {
+	Fit(ctx context.Context, chunks []Chunk, budget int, tok Tokenizer) ([]Chunk, error)
+}
+
+// TruncateOldest drops the oldest chunks until the rest fit. If the newest
+// chunk alone is too large, its beginning is cut off.
+type TruncateOldest struct{}
+
+// Fit implements Strategy
+func (TruncateOldest) Fit(ctx context.Context, chunks []Chunk, budget int, tok Tokenizer) ([]Chunk, error) {
+	used := 0
+	start := len(chunks)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		n := tok.Count(chunks[i].Text)
+		if used+n > budget {
+			break
+		}
+		used += n
+		start = i
+	}
+
+	kept := append([]Chunk(nil), chunks[start:]...)
+	if start > 0 && used < budget {
+		// Keep the tail of the next-oldest chunk in the space that is left
+		partial := chunks[start-1]
+		partial.Text = TruncateStart(partial.Text, budget-used, tok)
+		if partial.Text != "" {
+			kept = append([]Chunk{partial}, kept...)
+		}
+	}
+	return kept, nil
+}
+
+// KeepRelevant keeps the chunks with the highest Relevance that fit in the
+// budget, preserving their original order
+type KeepRelevant struct{}
+
+// Fit implements Strategy
+func (KeepRelevant) Fit(ctx context.Context, chunks []Chunk, budget int, tok Tokenizer) ([]Chunk, error) {
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return chunks[order[a]].Relevance > chunks[order[b]].Relevance
+	})
+
+	keep := make([]bool, len(chunks))
+	used := 0
+	for _, i := range order {
+		n := tok.Count(chunks[i].Text)
+		if used+n > budget {
+			continue
+		}
+		used += n
+		keep[i] = true
+	}
+
+	var kept []Chunk
+	for i, c := range chunks {
+		if keep[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// SummarizeFunc condenses text into at most maxTokens tokens, usually by
+// asking an LLM
+type SummarizeFunc func(ctx context.Context, text string, maxTokens int) (string, error)
+
+// Summarize replaces the oldest chunks with a summary when the section is over
+// budget. The newest chunk is kept verbatim if it fits in half the budget.
+type Summarize struct {
+	Summarizer SummarizeFunc
+}
+
+// Fit implements Strategy
+func (s Summarize) Fit(ctx context.Context, chunks []Chunk, budget int, tok Tokenizer) ([]Chunk, error) {
+	if total(chunks, tok) <= budget {
+		return chunks, nil
+	}
+	if s.Summarizer == nil {
+		return TruncateOldest{}.Fit(ctx, chunks, budget, tok)
+	}
+
+	older := chunks
+	var newest []Chunk
+	if n := len(chunks); n > 1 && tok.Count(chunks[n-1].Text) <= budget/2 {
+		older, newest = chunks[:n-1], chunks[n-1:]
+	}
+
+	summaryBudget := budget - total(newest, tok)
+	summary, err := s.Summarizer(ctx, Join(older, "\n\n"), summaryBudget)
+	if err != nil {
+		return nil, fmt.Errorf("summarizing context: %w", err)
+	}
+	// Models do not always respect the requested length
+	summary = Truncate(summary, summaryBudget, tok)
+
+	return append([]Chunk{{Text: summary}}, newest...), nil
+}
+
+// SplitParagraphs splits text on blank lines into chunks
+func SplitParagraphs(text string) []Chunk {
+	var chunks []Chunk
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			chunks = append(chunks, Chunk{Text: p})
+		}
+	}
+	return chunks
+}
+
+// ScoreKeywords sets each chunk's Relevance to the fraction of query terms it
+// contains, a cheap stand-in for embedding similarity
+func ScoreKeywords(query string, chunks []Chunk) []Chunk {
+	terms := words(query)
+	if len(terms) == 0 {
+		return chunks
+	}
+	for i := range chunks {
+		present := words(chunks[i].Text)
+		hits := 0
+		for t := range terms {
+			if present[t] {
+				hits++
+			}
+		}
+		chunks[i].Relevance = float64(hits) / float64(len(terms))
+	}
+	return chunks
+}
+
+// Join concatenates chunk texts with sep
+func Join(chunks []Chunk, sep string) string {
+	parts := make([]string, len(chunks))
+	for i, c := range chunks {
+		parts[i] = c.Text
+	}
+	return strings.Join(parts, sep)
+}
+
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(w) > 2 {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+func total(chunks []Chunk, tok Tokenizer) int {
+	n := 0
+	for _, c := range chunks {
+		n += tok.Count(c.Text)
+	}
+	return n
+}
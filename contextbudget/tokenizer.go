@@ -0,0 +1,89 @@
+package contextbudget
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a piece of text
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// TokenizerFunc adapts a plain function to the Tokenizer interface
+type TokenizerFunc func(text string) int
+
+// Count calls f(text)
+func (f TokenizerFunc) Count(text string) int {
+	return f(text)
+}
+
+// HeuristicTokenizer estimates token counts without a model vocabulary. It
+// assumes CharsPerToken runes per token (4 when unset), which is close enough
+// for English text on common LLM tokenizers, and never reports fewer tokens
+// than there are words.
+type HeuristicTokenizer struct {
+	CharsPerToken float64
+}
+
+// Count estimates the number of tokens in text
+func (h HeuristicTokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	per := h.CharsPerToken
+	if per <= 0 {
+		per = 4
+	}
+	byChars := int(math.Ceil(float64(utf8.RuneCountInString(text)) / per))
+	byWords := len(strings.Fields(text))
+	if byWords > byChars {
+		return byWords
+	}
+	return byChars
+}
+
+// Truncate returns the longest prefix of text that fits in maxTokens. It
+// never splits a UTF-8 sequence.
+func Truncate(text string, maxTokens int, tok Tokenizer) string {
+	return cut(text, maxTokens, tok, false)
+}
+
+// TruncateStart returns the longest suffix of text that fits in maxTokens,
+// prefixed with "..." when anything was dropped
+func TruncateStart(text string, maxTokens int, tok Tokenizer) string {
+	return cut(text, maxTokens, tok, true)
+}
+
+// cut binary-searches the number of runes to keep from either end of text
+func cut(text string, maxTokens int, tok Tokenizer, keepEnd bool) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if tok.Count(text) <= maxTokens {
+		return text
+	}
+
+	runes := []rune(text)
+	piece := func(n int) string {
+		if keepEnd {
+			return "..." + string(runes[len(runes)-n:])
+		}
+		return string(runes[:n])
+	}
+
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if tok.Count(piece(mid)) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return ""
+	}
+	return piece(lo)
+}
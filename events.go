@@ -0,0 +1,191 @@
+package go_agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventType identifies what happened in a flow run
+type EventType string
+
+// Event types, in the order they occur during a run
+const (
+	FlowStarted    EventType = "flow_started"
+	NodeStarted    EventType = "node_started"
+	CacheHit       EventType = "cache_hit"
+	CacheMiss      EventType = "cache_miss"
+	ExecAttempt    EventType = "exec_attempt"
+	RetryScheduled EventType = "retry_scheduled"
+	ExecFailed     EventType = "exec_failed"
+	NodeCompleted  EventType = "node_completed"
+	Transition     EventType = "transition"
+	FlowCompleted  EventType = "flow_completed"
+	FlowFailed     EventType = "flow_failed"
+)
+
+// Event describes one step of a flow run. Only the fields relevant to its
+// Type are set.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Flow is the name of the flow
+	Flow string `json:"flow,omitempty"`
+	// Node is the node the event is about
+	Node string `json:"node,omitempty"`
+	// Attempt counts Exec attempts from 1
+	Attempt int `json:"attempt,omitempty"`
+	// Action is the action a node returned, or the final action of a flow
+	Action string `json:"action,omitempty"`
+	// Next is the node a transition leads to
+	Next string `json:"next,omitempty"`
+	// Wait is the delay before a scheduled retry
+	Wait time.Duration `json:"wait,omitempty"`
+	// Skipped is set on NodeCompleted when a hook skipped the node
+	Skipped bool `json:"skipped,omitempty"`
+	// Error describes a failed attempt or a failed flow
+	Error string `json:"error,omitempty"`
+	// Result is the flow's result on FlowCompleted and FlowFailed
+	Result interface{} `json:"-"`
+}
+
+// Backpressure decides what RunStream does when the event channel is full
+type Backpressure int
+
+const (
+	// Block makes the flow wait for the consumer; no event is lost
+	Block Backpressure = iota
+	// DropNewest discards events that do not fit in the buffer
+	DropNewest
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest
+)
+
+// StreamOptions configures RunStream
+type StreamOptions struct {
+	// Buffer is the capacity of the event channel
+	Buffer int
+	// Backpressure applies when the buffer is full
+	Backpressure Backpressure
+}
+
+// observer is a callback registered with Observe
+type observer struct {
+	fn func(Event)
+}
+
+// Observe registers fn to receive the events of every run of the flow until
+// the returned function is called. fn is called synchronously, so it should
+// return quickly.
+func (f *Flow) Observe(fn func(Event)) (cancel func()) {
+	o := &observer{fn: fn}
+	f.observers = append(f.observers, o)
+	return func() {
+		// Build a new slice so that a run delivering events is not disturbed
+		observers := make([]*observer, 0, len(f.observers))
+		for _, other := range f.observers {
+			if other != o {
+				observers = append(observers, other)
+			}
+		}
+		f.observers = observers
+	}
+}
+
+// emit stamps an event and delivers it to the flow's observers
+func (f *Flow) emit(ev Event) {
+	if len(f.observers) == 0 && f.stream == nil {
+		return
+	}
+	ev.Time = time.Now()
+	ev.Flow = NodeName(f)
+	for _, o := range f.observers {
+		o.fn(ev)
+	}
+	if f.stream != nil {
+		f.stream(ev)
+	}
+}
+
+// RunStream runs the flow in a new goroutine and publishes its events on the
+// returned channel. The last event is FlowCompleted, or FlowFailed when the
+// flow ends on an error or an "error" action, or a node panics; its Result
+// holds what Run would have returned. The channel is closed after it.
+//
+// The flow must not be run concurrently with itself.
+func (f *Flow) RunStream(shared map[string]interface{}, opts StreamOptions) <-chan Event {
+	events := make(chan Event, opts.Buffer)
+	send := func(ev Event) {
+		switch opts.Backpressure {
+		case DropNewest:
+			select {
+			case events <- ev:
+			default:
+			}
+		case DropOldest:
+			for {
+				select {
+				case events <- ev:
+					return
+				default:
+				}
+				select {
+				case <-events:
+				default:
+				}
+			}
+		default:
+			events <- ev
+		}
+	}
+
+	f.stream = send
+	go func() {
+		defer close(events)
+		// Stop publishing to this stream once the run is over
+		defer func() { f.stream = nil }()
+		defer func() {
+			if r := recover(); r != nil {
+				err := fmt.Errorf("flow panicked: %v", r)
+				f.emit(Event{Type: FlowFailed, Error: err.Error(), Result: err})
+			}
+		}()
+		f.Run(shared)
+	}()
+	return events
+}
+
+// finished emits FlowCompleted or FlowFailed for a run's result on shared
+func (f *Flow) finished(shared map[string]interface{}, result interface{}) {
+	action, err := Outcome(result, shared)
+	if s, ok := result.(*Suspension); ok {
+		f.emit(Event{Type: FlowCompleted, Node: s.Node, Action: action, Result: result})
+		return
+	}
+	if err != nil {
+		f.emit(Event{Type: FlowFailed, Action: action, Error: err.Error(), Result: result})
+		return
+	}
+	f.emit(Event{Type: FlowCompleted, Action: action, Result: result})
+}
+
+// Outcome interprets the result of Flow.Run on shared. It returns the name
+// of the final action, "suspended" for a Suspension, and why the run failed,
+// if it did: the error the flow returned, or shared["error"] when the flow
+// ended on the "error" action.
+func Outcome(result interface{}, shared map[string]interface{}) (action string, err error) {
+	switch r := result.(type) {
+	case *Suspension:
+		return "suspended", nil
+	case error:
+		return "", r
+	}
+	action = actionName(result)
+	if action != "error" {
+		return action, nil
+	}
+	if msg := shared["error"]; msg != nil && msg != "" {
+		return action, fmt.Errorf("%v", msg)
+	}
+	return action, errors.New("flow ended on action \"error\"")
+}
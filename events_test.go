@@ -0,0 +1,195 @@
+package go_agent
+
+import (
+	"fmt"
+	"testing"
+)
+
+// panicNode panics in Post, outside the retried Exec
+type panicNode struct {
+	*BaseNode
+}
+
+func (p *panicNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	panic("broken post")
+}
+
+func TestFlow_RunStreamPublishesEvents(t *testing.T) {
+	calls := 0
+	first := &countingNode{Node: NewNode(2, 0), action: "next", calls: &calls}
+	second := &countingNode{Node: NewNode(1, 0), action: "done", calls: &calls}
+	first.SetName("first")
+	second.SetName("second")
+	first.Next(second, "next")
+
+	var got []string
+	for ev := range NewFlow(first).RunStream(map[string]interface{}{"count": 0}, StreamOptions{}) {
+		s := string(ev.Type)
+		switch ev.Type {
+		case NodeStarted:
+			s += ":" + ev.Node
+		case ExecAttempt, RetryScheduled:
+			s += fmt.Sprintf(":%s#%d", ev.Node, ev.Attempt)
+		case NodeCompleted, FlowCompleted:
+			s += ":" + ev.Action
+		case Transition:
+			s += ":" + ev.Node + "->" + ev.Next
+		}
+		got = append(got, s)
+	}
+
+	want := []string{
+		"flow_started",
+		"node_started:first", "exec_attempt:first#1", "retry_scheduled:first#1", "exec_attempt:first#2",
+		"node_completed:next", "transition:first->second",
+		"node_started:second", "exec_attempt:second#1", "node_completed:done",
+		"flow_completed:done",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Unexpected events:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestFlow_RunStreamReportsPanics(t *testing.T) {
+	var last Event
+	for ev := range NewFlow(&panicNode{BaseNode: NewBaseNode()}).RunStream(nil, StreamOptions{Buffer: 16}) {
+		last = ev
+	}
+	if last.Type != FlowFailed {
+		t.Fatalf("Expected the stream to end with FlowFailed, got %v", last.Type)
+	}
+	if _, ok := last.Result.(error); !ok || last.Error == "" {
+		t.Fatalf("Expected an error result, got %v", last.Result)
+	}
+}
+
+// failNode ends the flow on "error" with a reason in shared
+type failNode struct {
+	*BaseNode
+}
+
+func (n *failNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["error"] = "quota exceeded"
+	return "error"
+}
+
+func TestFlow_FlowFailedCarriesSharedError(t *testing.T) {
+	var last Event
+	for ev := range NewFlow(&failNode{BaseNode: NewBaseNode()}).RunStream(map[string]interface{}{}, StreamOptions{Buffer: 16}) {
+		last = ev
+	}
+	if last.Type != FlowFailed || last.Error != "quota exceeded" {
+		t.Fatalf("Expected FlowFailed with the shared error, got %v %q", last.Type, last.Error)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	if action, err := Outcome(&Suspension{Node: "review"}, nil); action != "suspended" || err != nil {
+		t.Fatalf("Expected a suspension to be \"suspended\" without an error, got %q, %v", action, err)
+	}
+	if action, err := Outcome("done", nil); action != "done" || err != nil {
+		t.Fatalf("Expected \"done\" without an error, got %q, %v", action, err)
+	}
+	if _, err := Outcome(fmt.Errorf("boom"), nil); err == nil || err.Error() != "boom" {
+		t.Fatalf("Expected the returned error, got %v", err)
+	}
+	if _, err := Outcome("error", map[string]interface{}{"error": "no answer"}); err == nil || err.Error() != "no answer" {
+		t.Fatalf("Expected shared[\"error\"] as the error, got %v", err)
+	}
+	if _, err := Outcome("error", nil); err == nil || err.Error() != "flow ended on action \"error\"" {
+		t.Fatalf("Expected a generic error for the error action, got %v", err)
+	}
+}
+
+func TestFlow_RunStreamDropNewest(t *testing.T) {
+	calls := 0
+	node := &countingNode{Node: NewNode(1, 0), action: "done", calls: &calls}
+	flow := NewFlow(node)
+	done := make(chan struct{})
+	flow.Observe(func(ev Event) {
+		if ev.Type == FlowCompleted {
+			close(done)
+		}
+	})
+
+	events := flow.RunStream(map[string]interface{}{"count": 0}, StreamOptions{Buffer: 1, Backpressure: DropNewest})
+	// Nothing is read until the run is over, so only the first event fits
+	<-done
+	var got []EventType
+	for ev := range events {
+		got = append(got, ev.Type)
+	}
+	if len(got) == 0 || len(got) > 2 || got[0] != FlowStarted {
+		t.Fatalf("Expected the full buffer to drop events, got %v", got)
+	}
+}
+
+func TestFlow_ObserveSeesEveryRun(t *testing.T) {
+	wait := &suspendNode{BaseNode: NewBaseNode()}
+	flow := NewFlow(wait)
+	var types []EventType
+	cancel := flow.Observe(func(ev Event) { types = append(types, ev.Type) })
+
+	flow.Run(nil)
+	if types[len(types)-1] != FlowCompleted {
+		t.Fatalf("Expected a suspended run to complete, got %v", types)
+	}
+
+	seen := len(types)
+	cancel()
+	flow.Run(nil)
+	if len(types) != seen || len(flow.observers) != 0 {
+		t.Fatalf("Expected no events after cancel, got %d more", len(types)-seen)
+	}
+}
+
+// mapCache is an ExecCache keyed on the node name and its prep result
+type mapCache map[string]interface{}
+
+func (c mapCache) Key(node string, prepRes interface{}) string {
+	return fmt.Sprintf("%s/%v", node, prepRes)
+}
+
+func (c mapCache) Get(key string) (interface{}, bool) {
+	v, ok := c[key]
+	return v, ok
+}
+
+func (c mapCache) Set(key string, execRes interface{}) {
+	c[key] = execRes
+}
+
+func TestFlow_CacheReusesExecResults(t *testing.T) {
+	calls := 0
+	node := &countingNode{Node: NewNode(2, 0), action: "done", calls: &calls}
+	node.SetName("count")
+	flow := NewFlow(node)
+	cache := mapCache{}
+	flow.Cache(cache)
+
+	var got []string
+	flow.Observe(func(ev Event) {
+		switch ev.Type {
+		case CacheHit, CacheMiss, ExecAttempt:
+			got = append(got, string(ev.Type))
+		}
+	})
+
+	for run := 0; run < 2; run++ {
+		shared := map[string]interface{}{"count": 1}
+		flow.Run(shared)
+		if shared["count"] != 2 {
+			t.Fatalf("Expected count 2 on run %d, got %v", run, shared["count"])
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Expected Exec to run only on the first run, got %d calls", calls)
+	}
+	want := []string{"cache_miss", "exec_attempt", "exec_attempt", "cache_hit"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Unexpected events:\n got %v\nwant %v", got, want)
+	}
+	if cache["count/1"] != 2 {
+		t.Fatalf("Expected the result to be cached under count/1, got %v", cache)
+	}
+}
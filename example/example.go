@@ -1,14 +1,37 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/breaker"
+	"github.com/utkarsh-cpu/go_agent/cache"
+	"github.com/utkarsh-cpu/go_agent/cassette"
+	"github.com/utkarsh-cpu/go_agent/cli"
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+	"github.com/utkarsh-cpu/go_agent/guard"
+	"github.com/utkarsh-cpu/go_agent/history"
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/memory"
+	"github.com/utkarsh-cpu/go_agent/queue"
+	"github.com/utkarsh-cpu/go_agent/schedule"
+	"github.com/utkarsh-cpu/go_agent/search"
+	"github.com/utkarsh-cpu/go_agent/secrets"
+	"github.com/utkarsh-cpu/go_agent/server"
+	"github.com/utkarsh-cpu/go_agent/team"
+	"github.com/utkarsh-cpu/go_agent/usage"
+	"github.com/utkarsh-cpu/go_agent/vectorstore"
+	"google.golang.org/api/option"
 	"gopkg.in/yaml.v2"
 )
 
@@ -37,107 +60,54 @@ func (d *DecideAction) Prep(shared map[string]interface{}) interface{} {
 		return nil // Important: Return nil to signal an error in Prep
 	}
 
-	return []interface{}{question, contextStr}
+	// Exec only sees the prep result, so hand it the model and context too
+	return []interface{}{question, contextStr, shared["llm"], shared["llmCtx"], conversation(shared)}
 }
 
 // Exec calls the LLM to decide whether to search or answer
-func (d *DecideAction) Exec(prepRes interface{}, shared map[string]interface{}) interface{} {
+func (d *DecideAction) Exec(prepRes interface{}) interface{} {
 	if prepRes == nil {
 		log.Println("DecideAction.Exec: prepRes is nil, likely an error in Prep")
 		return map[string]interface{}{"action": "error", "reason": "Error during preparation"}
 	}
 
 	inputs, ok := prepRes.([]interface{})
-	if !ok || len(inputs) != 2 {
+	if !ok || len(inputs) != 5 {
 		log.Println("DecideAction.Exec: Invalid prepRes format")
 		return map[string]interface{}{"action": "error", "reason": "Invalid preparation result"}
 	}
 
 	question, _ := inputs[0].(string)
 	contextStr, _ := inputs[1].(string)
+	conversationStr, _ := inputs[4].(string)
 
-	model, ok := shared["llmModel"].(*genai.GenerativeModel)
+	model, ok := inputs[2].(llm.ChatModel)
 	if !ok {
 		log.Println("DecideAction.Exec: LLM model not found in shared context")
 		return map[string]interface{}{"action": "error", "reason": "LLM model configuration missing"}
 	}
-	ctx, ok := shared["llmCtx"].(context.Context)
+	ctx, ok := inputs[3].(context.Context)
 	if !ok {
 		log.Println("DecideAction.Exec: LLM context not found in shared context")
 		return map[string]interface{}{"action": "error", "reason": "LLM context configuration missing"}
 	}
 
-	fmt.Println("🤔 Agent deciding what to do next...")
-
-	// MORE ROBUST PROMPT - Crucial for reliable YAML output
-	// Reconstruct the prompt template by concatenating raw strings with regular strings for backtick parts,
-	// as raw string literals cannot contain literal backtick characters.
-	promptTemplatePart1 := `
-### CONTEXT
-You are a research assistant that can search the web to find relevant information and provide accurate answers.
-Question: %s
-Previous Research: %s
-
-### INSTRUCTIONS
-1.  Analyze the question and the available research.
-2.  Decide whether you have enough information to answer the question accurately.
-3.  If you need more information, choose to search the web.
-4.  If you have enough information, choose to answer the question.
-
-### ACTION SPACE
-Here are the actions you can take:
-
-#### Action 1: search
-Description: Look up more information on the web
-Parameters:
-  query (str): What to search for
-
-#### Action 2: answer
-Description: Answer the question with current knowledge
-Parameters:
-  answer (str): Final answer to the question
-
-### RESPONSE FORMAT
-Respond with a YAML block that specifies your decision:
-` // End of raw string part 1. Note the newline before concatenation.
-
-	promptTemplatePart2 := `
-thinking: |
-  <your step-by-step reasoning process>
-action: search | answer  # Choose either 'search' or 'answer'
-reason: <why you chose this action>
-answer: |  # Only include if action is 'answer'
-  <your final answer here>
-search_query: <specific search query if action is 'search'>
-` // End of raw string part 2. Note the newline before concatenation.
-
-	promptTemplatePart3 := `
-
-**IMPORTANT:**
-*   Always return a valid YAML block enclosed in triple backticks (` // End of raw string part 3
-
-	promptTemplatePart4 := `).
-*   Use proper indentation (2 spaces) for multi-line fields.
-*   The 'action' field MUST be either 'search' or 'answer'.
-*   If the action is 'search', the 'search_query' field MUST be present and contain a specific search query.
-*   If the action is 'answer', the 'answer' field MUST be present and contain the answer.
-*   The 'thinking' and 'reason' fields are VERY IMPORTANT for explaining your decision. Be detailed.
-
-NOW, WHAT IS YOUR DECISION?
-` // End of raw string part 4
-
-	promptText := fmt.Sprintf(
-		promptTemplatePart1+"```yaml"+promptTemplatePart2+"```"+promptTemplatePart3+"```yaml ... ```"+promptTemplatePart4,
-		question, contextStr,
-	)
-
-	prompt := []genai.Part{genai.Text(promptText)}
-	response := SentLlmPrompt(model, ctx, prompt)
+	promptText, err := prompts.Render("decide_action", map[string]interface{}{
+		"Question":     question,
+		"Context":      contextStr,
+		"Conversation": conversationStr,
+	})
+	if err != nil {
+		log.Printf("DecideAction.Exec: Error rendering prompt: %v", err)
+		return map[string]interface{}{"action": "error", "reason": fmt.Sprintf("Failed to render prompt: %v", err)}
+	}
 
-	if response == "" {
-		log.Println("DecideAction.Exec: Received empty response from LLM")
+	resp, err := model.Generate(ctx, promptText)
+	if err != nil || resp.Text == "" {
+		log.Printf("DecideAction.Exec: No response from LLM: %v", err)
 		return map[string]interface{}{"action": "error", "reason": "LLM communication failed"}
 	}
+	response := resp.Text
 
 	// Extract YAML block
 	yamlStr := ""
@@ -153,7 +123,7 @@ NOW, WHAT IS YOUR DECISION?
 	yamlStr = strings.TrimSpace(yamlStr)
 
 	var decision map[string]interface{}
-	err := yaml.Unmarshal([]byte(yamlStr), &decision)
+	err = yaml.Unmarshal([]byte(yamlStr), &decision)
 	if err != nil {
 		log.Printf("DecideAction.Exec: Error parsing YAML: %v\nYAML content:\n---\n%s\n---\n", err, yamlStr)
 		return map[string]interface{}{"action": "error", "reason": fmt.Sprintf("Failed to parse LLM response YAML: %v", err)}
@@ -223,6 +193,20 @@ func (d *DecideAction) Post(shared map[string]interface{}, prepRes interface{},
 	return action
 }
 
+// maxContextTokens is the context window, in tokens, the research prompt may
+// use; contextReserveTokens of it are kept free for the template and answer
+const (
+	maxContextTokens     = 4000
+	contextReserveTokens = 1000
+)
+
+// contextBudget divides the context window between the question and research
+var contextBudget = &contextbudget.Manager{
+	Tokenizer: contextbudget.HeuristicTokenizer{},
+	MaxTokens: maxContextTokens,
+	Reserve:   contextReserveTokens,
+}
+
 // SearchWebNode searches the web for information
 type SearchWebNode struct {
 	*agent.Node
@@ -242,7 +226,7 @@ func (s *SearchWebNode) Prep(shared map[string]interface{}) interface{} {
 		log.Println("SearchWebNode.Prep: Search query not found in shared context")
 		return nil // Signal error in Prep
 	}
-	return searchQuery
+	return []interface{}{searchQuery, shared["search"], shared["llmCtx"]}
 }
 
 // Exec searches the web for the given query
@@ -252,14 +236,28 @@ func (s *SearchWebNode) Exec(prepRes interface{}) interface{} {
 		return "Error: No search query provided."
 	}
 
-	searchQuery, ok := prepRes.(string)
+	inputs, ok := prepRes.([]interface{})
+	if !ok || len(inputs) != 3 {
+		log.Println("SearchWebNode.Exec: Invalid prepRes format")
+		return "Error: Invalid search query provided."
+	}
+	searchQuery, ok := inputs[0].(string)
 	if !ok || searchQuery == "" {
 		log.Println("SearchWebNode.Exec: Invalid or empty search query from Prep")
 		return "Error: Invalid search query provided."
 	}
+	provider, ok := inputs[1].(search.Provider)
+	if !ok {
+		log.Println("SearchWebNode.Exec: Search provider not found in shared context")
+		return "Error: Search provider configuration missing."
+	}
+	ctx, ok := inputs[2].(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
 
 	fmt.Printf("🌐 Searching the web for: %s\n", searchQuery)
-	results := SearchWeb(searchQuery)
+	results := SearchWeb(ctx, provider, searchQuery)
 	if results == "" {
 		log.Println("SearchWebNode.Exec: Web search returned empty results.")
 		return "Search completed, but no results were found."
@@ -277,20 +275,123 @@ func (s *SearchWebNode) Post(shared map[string]interface{}, prepRes interface{},
 	}
 
 	searchQuery, _ := shared["search_query"].(string)
-
-	previousContext, _ := shared["context"].(string)
-	newContext := previousContext + "\n\nSEARCH: " + searchQuery + "\nRESULTS:\n" + results
-	maxContextLen := 3000
-	if len(newContext) > maxContextLen {
-		newContext = "..." + newContext[len(newContext)-maxContextLen:]
+	if err := addResearch(shared, "SEARCH", searchQuery, results); err != nil {
+		log.Printf("SearchWebNode.Post: Error fitting context budget: %v", err)
+		shared["error"] = "Internal error: Could not fit search results into context."
+		return "error"
 	}
-	shared["context"] = newContext
 
 	fmt.Println("📚 Found information, analyzing results...")
 
 	return "decide"
 }
 
+// addResearch adds the results of a lookup to the research history and
+// rebuilds shared["context"] within the context budget
+func addResearch(shared map[string]interface{}, label, searchQuery, results string) error {
+	question, _ := shared["question"].(string)
+	history, _ := shared["research"].([]string)
+
+	ctx, ok := shared["llmCtx"].(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
+	model, _ := shared["llm"].(llm.ChatModel)
+
+	historyChunks := make([]contextbudget.Chunk, len(history))
+	for i, h := range history {
+		historyChunks[i] = contextbudget.Chunk{Text: h}
+	}
+
+	// Share the context window between the question, earlier research and
+	// the new results. Old research is summarized rather than cut off, and
+	// only the most relevant paragraphs of the new results are kept.
+	fitted, err := contextBudget.Fit(ctx,
+		contextbudget.Section{
+			Name:   "question",
+			Chunks: []contextbudget.Chunk{{Text: question}},
+			Weight: 1,
+		},
+		contextbudget.Section{
+			Name:     "history",
+			Chunks:   historyChunks,
+			Weight:   2,
+			Strategy: summarizeOrTruncate{contextbudget.Summarize{Summarizer: LlmSummarizer(model)}},
+		},
+		contextbudget.Section{
+			Name:      "results",
+			Chunks:    contextbudget.ScoreKeywords(searchQuery, contextbudget.SplitParagraphs(results)),
+			Weight:    3,
+			Strategy:  contextbudget.KeepRelevant{},
+			Separator: "\n",
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	history = history[:0]
+	for _, c := range fitted.Sections["history"].Chunks {
+		history = append(history, c.Text)
+	}
+	history = append(history, label+": "+searchQuery+"\nRESULTS:\n"+fitted.Text("results"))
+	shared["research"] = history
+	shared["context"] = strings.Join(history, "\n\n")
+	return nil
+}
+
+// summarizeOrTruncate summarizes old research, and cuts the oldest research
+// off instead when the summary fails, so that a failing model call never
+// aborts a search
+type summarizeOrTruncate struct {
+	contextbudget.Summarize
+}
+
+func (s summarizeOrTruncate) Fit(ctx context.Context, chunks []contextbudget.Chunk, budget int, tok contextbudget.Tokenizer) ([]contextbudget.Chunk, error) {
+	kept, err := s.Summarize.Fit(ctx, chunks, budget, tok)
+	if err != nil {
+		log.Printf("Warning: %v; truncating earlier research instead", err)
+		return contextbudget.TruncateOldest{}.Fit(ctx, chunks, budget, tok)
+	}
+	return kept, nil
+}
+
+// RetrieveDocsNode looks the search query up in local documents instead of
+// on the web
+type RetrieveDocsNode struct {
+	*vectorstore.RetrieveNode
+}
+
+// NewRetrieveDocsNode creates a RetrieveDocsNode over store
+func NewRetrieveDocsNode(store *vectorstore.Store) *RetrieveDocsNode {
+	retrieve := vectorstore.NewRetrieveNode(store, docsResultLimit)
+	retrieve.CtxKey = "llmCtx"
+	return &RetrieveDocsNode{RetrieveNode: retrieve}
+}
+
+// Post adds the retrieved passages to the research within the context budget
+func (r *RetrieveDocsNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if _, failed := execRes.(error); failed {
+		return r.RetrieveNode.Post(shared, prepRes, execRes)
+	}
+	hits, _ := execRes.([]vectorstore.Hit)
+	searchQuery, _ := shared["search_query"].(string)
+
+	results := vectorstore.FormatHits(hits)
+	if results == "" {
+		results = "No matching passages were found in the documents."
+	}
+	if err := addResearch(shared, "DOCUMENTS", searchQuery, results); err != nil {
+		log.Printf("RetrieveDocsNode.Post: Error fitting context budget: %v", err)
+		shared["error"] = "Internal error: Could not fit retrieved passages into context."
+		return "error"
+	}
+
+	fmt.Printf("📚 Retrieved %d passages from local documents...\n", len(hits))
+
+	return "decide"
+}
+
 // AnswerQuestion node generates the final answer
 type AnswerQuestion struct {
 	*agent.Node
@@ -315,7 +416,7 @@ func (a *AnswerQuestion) Prep(shared map[string]interface{}) interface{} {
 	answer, ok := shared["answer"].(string)
 	if ok && answer != "" {
 		log.Println("AnswerQuestion.Prep: Found direct answer in shared context")
-		return []interface{}{question, answer} // Use the direct answer immediately
+		return []interface{}{question, answer, shared["llm"], shared["llmCtx"], conversation(shared)} // Use the direct answer immediately
 	}
 
 	// Fallback to context if no direct answer
@@ -324,58 +425,54 @@ func (a *AnswerQuestion) Prep(shared map[string]interface{}) interface{} {
 		contextStr = "No context available."
 	}
 
-	return []interface{}{question, contextStr}
+	return []interface{}{question, contextStr, shared["llm"], shared["llmCtx"], conversation(shared)}
 }
 
 // Exec calls the LLM to generate a final answer
-func (a *AnswerQuestion) Exec(prepRes interface{}, shared map[string]interface{}) interface{} {
+func (a *AnswerQuestion) Exec(prepRes interface{}) interface{} {
 	if prepRes == nil {
 		log.Println("AnswerQuestion.Exec: prepRes is nil, likely an error in Prep")
 		return "Error: No data to generate an answer."
 	}
 
 	inputs, ok := prepRes.([]interface{})
-	if !ok || len(inputs) != 2 {
+	if !ok || len(inputs) != 5 {
 		log.Println("AnswerQuestion.Exec: Invalid prepRes format")
 		return "Error: Internal error preparing to answer question."
 	}
 
 	question, _ := inputs[0].(string)
 	contextStr, _ := inputs[1].(string)
+	conversationStr, _ := inputs[4].(string)
 
-	model, ok := shared["llmModel"].(*genai.GenerativeModel)
+	model, ok := inputs[2].(llm.ChatModel)
 	if !ok {
 		log.Println("AnswerQuestion.Exec: LLM model not found in shared context")
 		return "Error: LLM model configuration missing."
 	}
-	ctx, ok := shared["llmCtx"].(context.Context)
+	ctx, ok := inputs[3].(context.Context)
 	if !ok {
 		log.Println("AnswerQuestion.Exec: LLM context not found in shared context")
 		return "Error: LLM context configuration missing."
 	}
 
-	fmt.Println("✍️ Crafting final answer...")
-
-	// Enhanced prompt for final answer generation
-	promptText := fmt.Sprintf(`
-### CONTEXT
-Based on the following information, answer the question comprehensively.  If the context doesn't contain the information needed to directly answer the question, state that you are unable to answer based on the available information.
-Question: %s
-Research & Context: %s
-
-## YOUR ANSWER:
-Provide a detailed and accurate answer based *only* on the provided Research & Context. If the context is insufficient, state that.
-`, question, contextStr)
-
-	prompt := []genai.Part{genai.Text(promptText)}
-	answer := SentLlmPrompt(model, ctx, prompt)
+	promptText, err := prompts.Render("answer_question", map[string]interface{}{
+		"Question":     question,
+		"Context":      contextStr,
+		"Conversation": conversationStr,
+	})
+	if err != nil {
+		log.Printf("AnswerQuestion.Exec: Error rendering prompt: %v", err)
+		return "Error: Failed to render answer prompt."
+	}
 
-	if answer == "" {
-		log.Println("AnswerQuestion.Exec: Received empty response from LLM during answer generation")
+	resp, err := model.Generate(ctx, promptText)
+	if err != nil || resp.Text == "" {
+		log.Printf("AnswerQuestion.Exec: No response from LLM during answer generation: %v", err)
 		return "Error: Failed to generate answer due to LLM communication issue."
 	}
 
-	answer = strings.TrimSpace(answer)
+	answer := strings.TrimSpace(resp.Text)
 	if strings.HasPrefix(answer, "```") && strings.Contains(answer, "\n") {
 		firstLineEnd := strings.Index(answer, "\n")
 		if firstLineEnd != -1 {
@@ -404,53 +501,310 @@ func (a *AnswerQuestion) Post(shared map[string]interface{}, prepRes interface{}
 
 	shared["answer"] = answer
 
+	// Remember the exchange so follow-up questions can refer to it
+	if mem, ok := memory.From(shared); ok {
+		question, _ := shared["question"].(string)
+		ctx, _ := shared["llmCtx"].(context.Context)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := mem.Append(ctx, memory.User(question), memory.Assistant(answer)); err != nil {
+			log.Printf("AnswerQuestion.Post: Error updating memory: %v", err)
+		}
+	}
+
 	fmt.Println("✅ Answer generated successfully")
 
 	return "done"
 }
 
-// CreateResearchAgent creates a research agent flow
-func CreateResearchAgent() *agent.Flow {
+// CreateResearchAgent creates a research agent flow. When docs is not nil the
+// agent looks things up in those documents instead of on the web.
+func CreateResearchAgent(docs *vectorstore.Store) *agent.Flow {
 	decideAction := NewDecideAction()
-	searchWeb := NewSearchWebNode()
 	answerQuestion := NewAnswerQuestion()
 
+	// The lookup node finds information on the web, or in local documents
+	var searchWeb interface {
+		agent.Runnable
+		Next(node interface{}, action string) interface{}
+	} = NewSearchWebNode()
+	if docs != nil {
+		searchWeb = NewRetrieveDocsNode(docs)
+	}
+
 	flow := agent.NewFlow(decideAction)
 
 	decideAction.Next(searchWeb, "search")
 	decideAction.Next(answerQuestion, "answer")
 	searchWeb.Next(decideAction, "decide")
 
+	// Once the run's token budget is spent, answer with what we have
+	decideAction.Next(answerQuestion, usage.DefaultExceededAction)
+	searchWeb.Next(answerQuestion, usage.DefaultExceededAction)
+
+	// Scraped pages may try to instruct the LLM, and answers must not repeat
+	// personal data found along the way
+	flow.Use(guard.New().
+		After(agent.NodeName(searchWeb), "context", guard.Redact, guard.PromptInjection()).
+		After(agent.NodeName(searchWeb), "research", guard.Redact, guard.PromptInjection()).
+		After(agent.NodeName(answerQuestion), "answer", guard.Redact, guard.PII()))
+
+	// While web search is down, skip it and answer with what we have
+	if docs == nil {
+		searchWeb.Next(answerQuestion, breaker.DegradedAction)
+		flow.Use(breaker.NewHook().Protect(agent.NodeName(searchWeb), searchBreaker))
+	}
+
 	return flow
 }
 
-// RunResearchAgent runs the research agent with a question
-func RunResearchAgent(question string) string {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		log.Println("Warning: GEMINI_API_KEY environment variable not set. Using dummy values.")
-		apiKey = "dummy-key"
+// maxRunTokens caps the tokens a single research run may spend
+const maxRunTokens = 200000
+
+// docsResultLimit is the number of passages retrieved from local documents
+const docsResultLimit = 5
+
+// maxMemoryTokens is the share of the conversation kept verbatim; older
+// turns are summarized
+const maxMemoryTokens = 1500
+
+// conversation renders the session's memory for a prompt
+func conversation(shared map[string]interface{}) string {
+	mem, ok := memory.From(shared)
+	if !ok {
+		return "No earlier conversation."
+	}
+	msgs := mem.Messages()
+	if len(msgs) == 0 {
+		return "No earlier conversation."
+	}
+	return memory.Format(msgs)
+}
+
+// ResearchSession answers a series of questions with one LLM client and a
+// shared conversation memory, so that follow-up questions can build on
+// earlier answers
+type ResearchSession struct {
+	Memory *memory.SummaryBuffer
+	// Docs, when set, replaces web search with retrieval from local documents
+	Docs *vectorstore.Store
+
+	client    *genai.Client
+	model     *genai.GenerativeModel
+	modelName string
+	ctx       context.Context
+	// httpClient carries the search and page requests; nil means
+	// http.DefaultClient
+	httpClient *http.Client
+	cassette   *cassette.Recorder
+	// secrets holds the API keys and redacts them from logs and saved runs
+	secrets *secrets.Store
+	// cache, when set, keeps LLM replies and searches for cacheTTL
+	cache    *cache.File
+	cacheTTL time.Duration
+	// history, when set, records every run
+	history *history.File
+	// llm is the metered model of the current run, also used to summarize
+	// the memory
+	llm llm.ChatModel
+}
+
+// NewResearchSession sets up the LLM client and an empty memory
+func NewResearchSession() (*ResearchSession, error) {
+	keys, err := OpenSecrets()
+	if err != nil {
+		return nil, err
 	}
+	// Keep the keys out of the logs
+	log.SetOutput(keys.Writer(os.Stderr))
 	modelName := "gemini-2.0-flash"
 
-	client, model, ctx, err := SetLlmApi(modelName, apiKey)
+	// Record or replay every HTTP call when a cassette is configured
+	rec, err := OpenCassette()
 	if err != nil {
-		log.Printf("Failed to initialize LLM API in RunResearchAgent: %v", err)
-		return fmt.Sprintf("Error initializing agent: %v", err)
+		return nil, err
+	}
+
+	apiKey, err := keys.Lookup("GEMINI_API_KEY")
+	if err != nil {
+		if rec == nil || rec.Mode != cassette.Replay {
+			return nil, fmt.Errorf("the Gemini API key is required: %w", err)
+		}
+		// Replayed responses need no key
+		apiKey = "replay-key"
+	}
+	var opts []option.ClientOption
+	var httpClient *http.Client
+	if rec != nil {
+		rec.Transport = apiKeyTransport{key: apiKey, base: http.DefaultTransport}
+		httpClient = rec.Client()
+		opts = append(opts, option.WithHTTPClient(httpClient))
+		pageFetcher.Client = httpClient
+	}
+
+	store, cacheTTL, err := OpenCache()
+	if err != nil {
+		return nil, err
 	}
-	defer client.Close()
 
-	researchAgent := CreateResearchAgent()
+	client, model, ctx, err := SetLlmApi(modelName, apiKey, opts...)
+	if err != nil {
+		if store != nil {
+			store.Close()
+		}
+		return nil, err
+	}
+
+	session := &ResearchSession{client: client, model: model, modelName: modelName, ctx: ctx, httpClient: httpClient, cassette: rec, cache: store, cacheTTL: cacheTTL, secrets: keys}
+	session.Memory = memory.NewSummaryBuffer(maxMemoryTokens, func(ctx context.Context, text string, maxTokens int) (string, error) {
+		return LlmSummarizer(session.llm)(ctx, text, maxTokens)
+	})
+
+	if dir := os.Getenv("DOCS_DIR"); dir != "" {
+		docs, err := LoadDocsStore(ctx, NewGeminiEmbedder(client), dir, os.Getenv("DOCS_INDEX"))
+		if err != nil {
+			if store != nil {
+				store.Close()
+			}
+			client.Close()
+			return nil, err
+		}
+		session.Docs = docs
+	}
+
+	if session.history, err = OpenHistory(); err != nil {
+		if store != nil {
+			store.Close()
+		}
+		client.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// chatModel returns the session's model, falling back on the models listed
+// in GEMINI_FALLBACK_MODELS, separated by commas, when it fails. Its replies
+// are cached when the session has a cache.
+func (s *ResearchSession) chatModel() llm.ChatModel {
+	var fallbacks []string
+	for _, name := range strings.Split(os.Getenv("GEMINI_FALLBACK_MODELS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			fallbacks = append(fallbacks, name)
+		}
+	}
+	model := NewGeminiChain(s.client, s.modelName, fallbacks)
+	if s.cache == nil {
+		return model
+	}
+	return cache.Model(model, s.cache, s.cacheTTL, s.modelName, fallbacks)
+}
+
+// newAgent builds the research flow, reusing earlier web searches when the
+// session has a cache
+func (s *ResearchSession) newAgent() *agent.Flow {
+	flow := CreateResearchAgent(s.Docs)
+	if s.cache != nil {
+		searches := cache.NewExec(s.cache, s.cacheTTL, "SearchWebNode")
+		// Failed searches come back as text; keep them out of the cache
+		searches.Valid = func(node string, execRes interface{}) bool {
+			text, _ := execRes.(string)
+			return !strings.HasPrefix(text, "Error")
+		}
+		flow.Cache(searches)
+	}
+	return flow
+}
+
+// Close saves the cassette, if any, closes the cache and the run history
+// and releases the LLM client
+func (s *ResearchSession) Close() error {
+	if s.cassette != nil {
+		if err := s.cassette.Save(); err != nil {
+			log.Printf("Warning: could not save cassette: %v", err)
+		}
+	}
+	if s.cache != nil {
+		if err := s.cache.Close(); err != nil {
+			log.Printf("Warning: could not close cache: %v", err)
+		}
+	}
+	if s.history != nil {
+		if err := s.history.Close(); err != nil {
+			log.Printf("Warning: could not close run history: %v", err)
+		}
+	}
+	return s.client.Close()
+}
+
+// printEvent reports the progress of a research run on the terminal
+func printEvent(ev agent.Event) {
+	switch ev.Type {
+	case agent.NodeStarted:
+		switch ev.Node {
+		case "DecideAction":
+			fmt.Println("🤔 Agent deciding what to do next...")
+		case "AnswerQuestion":
+			fmt.Println("✍️ Crafting final answer...")
+		}
+	case agent.CacheHit:
+		fmt.Printf("♻️ Reusing cached result of %s\n", ev.Node)
+	case agent.RetryScheduled:
+		fmt.Printf("⏳ %s failed (%s), retrying in %s...\n", ev.Node, ev.Error, ev.Wait)
+	case agent.FlowFailed:
+		fmt.Printf("❌ Agent flow failed: %s\n", ev.Error)
+	}
+}
+
+// Ask runs the research agent on a question, with the session's earlier
+// questions and answers as conversation context
+func (s *ResearchSession) Ask(question string) string {
+	// Account for every LLM call of this run and cap its total size
+	tracker := usage.NewTracker(usage.DefaultPrices, usage.Limits{MaxTokens: maxRunTokens})
+	s.llm = usage.Meter(s.chatModel(), tracker)
+
+	researchAgent := s.newAgent()
+	researchAgent.Use(tracker)
 
 	shared := map[string]interface{}{
-		"question": question,
-		"llmModel": model,
-		"llmCtx":   ctx,
-		"context":  "", // Initialize the context
+		"question":       question,
+		"llm":            s.llm,
+		"llmCtx":         s.ctx,
+		"search":         NewSearchProvider(s.httpClient, s.secrets),
+		"context":        "", // Initialize the context
+		"research":       []string{},
+		memory.SharedKey: s.Memory,
+	}
+
+	// Record the run, without its secrets, when a history is configured
+	var rec *history.Recorder
+	if s.history != nil {
+		rec = history.NewRecorder("research", s.secrets.RedactValue(shared).(map[string]interface{}))
+		rec.Usage = tracker
+		researchAgent.Observe(func(ev agent.Event) { rec.Observe(s.secrets.RedactEvent(ev)) })
 	}
 
 	fmt.Println("🔄 Starting agent flow...")
-	outcome := researchAgent.Run(shared)
+	var outcome interface{}
+	for ev := range researchAgent.RunStream(shared, agent.StreamOptions{Buffer: 16}) {
+		printEvent(ev)
+		if ev.Type == agent.FlowCompleted || ev.Type == agent.FlowFailed {
+			outcome = ev.Result
+		}
+	}
+
+	if rec != nil {
+		run := rec.Finish(s.secrets.RedactValue(shared).(map[string]interface{}), outcome)
+		if err := s.history.Save(s.ctx, run); err != nil {
+			log.Printf("Warning: could not record run: %v", err)
+		} else {
+			fmt.Printf("\n📜 Run recorded as %s (%s in %s)\n", run.ID, run.Status, run.Duration.Round(time.Millisecond))
+		}
+	}
+
+	report := tracker.Report()
+	shared["usage"] = report
+	fmt.Printf("\n💰 Usage: %s\n", report)
 
 	fmt.Println("\n🔍 Final Shared Context:")
 	for k, v := range shared {
@@ -463,23 +817,288 @@ func RunResearchAgent(question string) string {
 
 	if errVal, ok := shared["error"]; ok {
 		log.Printf("Agent flow finished with error: %v", errVal)
-		return fmt.Sprintf("Agent encountered an error: %v", errVal)
+		return fmt.Sprintf("Agent encountered an error: %v\nUsage: %s", errVal, report)
 	}
 
 	answer, ok := shared["answer"].(string)
 	if !ok || answer == "" {
 		log.Println("Agent flow completed, but no valid answer was found in shared context.")
-		return "Agent finished, but no answer was generated."
+		return fmt.Sprintf("Agent finished, but no answer was generated.\nUsage: %s", report)
+	}
+
+	// Also return the outcome of the flow and what it cost
+	return fmt.Sprintf("%s\nFlow Outcome: %v\nUsage: %s", answer, outcome, report)
+}
+
+// RunResearchAgent runs the research agent with a single question
+func RunResearchAgent(question string) string {
+	session, err := NewResearchSession()
+	if err != nil {
+		log.Printf("Failed to initialize LLM API in RunResearchAgent: %v", err)
+		return fmt.Sprintf("Error initializing agent: %v", err)
+	}
+	defer session.Close()
+	return session.Ask(question)
+}
+
+// prepareRun adds the session's clients to the JSON input of a run started
+// through the HTTP server or the command line
+func (s *ResearchSession) prepareRun(ctx context.Context, flow string, shared map[string]interface{}) error {
+	if q, _ := shared["question"].(string); strings.TrimSpace(q) == "" {
+		return fmt.Errorf("a question is required")
+	}
+	shared["llm"] = s.chatModel()
+	shared["search"] = NewSearchProvider(s.httpClient, s.secrets)
+	if _, ok := shared["context"]; !ok {
+		shared["context"] = ""
 	}
+	if _, ok := shared["research"]; !ok {
+		shared["research"] = []string{}
+	}
+	return nil
+}
 
-	// Also return the outcome of the flow
-	return fmt.Sprintf("%s\nFlow Outcome: %v", answer, outcome)
+// RunResearchCLI runs the research agent as the "research" flow of a
+// command-line runner, for example
+//
+//	go run . --set question="What is Go?" --trace run.jsonl research
+//
+// and returns the exit code.
+func RunResearchCLI(args []string) int {
+	session, err := NewResearchSession()
+	if err != nil {
+		log.Printf("Failed to initialize LLM API: %v", err)
+		return cli.ExitFailed
+	}
+	defer session.Close()
+
+	app := &cli.App{
+		Name:       "research",
+		Flows:      map[string]func() *agent.Flow{"research": session.newAgent},
+		Prepare:    session.prepareRun,
+		ContextKey: "llmCtx",
+		Secrets:    session.secrets,
+	}
+	if session.history != nil {
+		app.History = session.history
+	}
+	return app.Run(args)
+}
+
+// ServeResearchAgent serves the research agent over HTTP as the "research"
+// flow. A run's JSON input must contain the question.
+func ServeResearchAgent(addr string) error {
+	session, err := NewResearchSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	srv := server.New()
+	// Nodes read the run's context, canceled with the run, as the LLM context
+	srv.ContextKey = "llmCtx"
+	srv.Prepare = session.prepareRun
+	srv.Register("research", session.newAgent)
+
+	log.Printf("Serving the research agent on %s", addr)
+	return http.ListenAndServe(addr, srv)
+}
+
+// WorkResearchQueue answers research jobs kept in dir, with
+// AGENT_QUEUE_WORKERS workers (default 1), until interrupted. Each
+// question is first submitted as a new job.
+func WorkResearchQueue(dir string, questions []string) error {
+	store, err := queue.OpenStore(dir)
+	if err != nil {
+		return err
+	}
+	session, err := NewResearchSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	q := queue.New(store)
+	q.ContextKey = "llmCtx"
+	q.Prepare = session.prepareRun
+	if n, err := strconv.Atoi(os.Getenv("AGENT_QUEUE_WORKERS")); err == nil && n > 0 {
+		q.Concurrency = n
+	}
+	q.Register("research", session.newAgent)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, question := range questions {
+		job, err := q.Submit(ctx, "research", map[string]interface{}{"question": question})
+		if err != nil {
+			return err
+		}
+		log.Printf("Submitted job %s: %s", job.ID, question)
+	}
+
+	log.Printf("Working the queue in %s with %d workers", dir, q.Concurrency)
+	q.Work(ctx)
+	return nil
+}
+
+// defaultDigestQuestion is the question of the scheduled research digest
+const defaultDigestQuestion = `What were the most important developments in the Go programming language as of {{.Time.Format "January 2, 2006"}}?`
+
+// RunResearchDigest answers question on the given schedule, for example
+// "0 8 * * *" for every morning, and prints each answer until interrupted.
+// The question may use the run time, e.g. {{.Time.Format "Jan 2"}}. The
+// last run is remembered in AGENT_DIGEST_STATE (default digest-state.json),
+// so a digest missed while the program was down is made up at start.
+func RunResearchDigest(spec, question string) error {
+	when, err := schedule.Parse(spec)
+	if err != nil {
+		return err
+	}
+	statePath := os.Getenv("AGENT_DIGEST_STATE")
+	if statePath == "" {
+		statePath = "digest-state.json"
+	}
+	sched, err := schedule.New(statePath)
+	if err != nil {
+		return err
+	}
+	session, err := NewResearchSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	sched.ContextKey = "llmCtx"
+	sched.Prepare = session.prepareRun
+	sched.OnFinish = func(name string, shared map[string]interface{}, err error) {
+		if err != nil {
+			return // already logged by the scheduler
+		}
+		fmt.Println("--- Research Digest ---")
+		fmt.Printf("Question: %s\n", shared["question"])
+		fmt.Println(shared["answer"])
+		fmt.Println("-------------------- ")
+	}
+	if err := sched.Add(schedule.Entry{
+		Name:    "digest",
+		Spec:    when,
+		Flow:    session.newAgent,
+		Input:   map[string]interface{}{"question": question},
+		CatchUp: true,
+	}); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if st, ok := sched.State("digest"); ok && !st.LastStarted.IsZero() {
+		log.Printf("Last digest ran at %s", st.LastStarted.Format(time.RFC1123))
+	}
+	log.Printf("Running the research digest on %q", spec)
+	sched.Run(ctx)
+	return nil
+}
+
+// RunResearchTeam answers a broad question with a team of agents: a
+// supervisor splits it into focused questions, hands each to the research
+// agent as a worker and writes the final answer from their findings
+func RunResearchTeam(question string) (string, error) {
+	session, err := NewResearchSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	planner := team.NewModelPlanner(session.chatModel())
+	planner.Instructions = "Give the researcher one focused factual question per task. Combine the researcher's answers into a complete final answer, and say what could not be found."
+	sup := team.NewSupervisor(planner, 2)
+	sup.GoalKey = "question"
+	sup.CtxKey = "llmCtx"
+	sup.MaxRounds = 4
+	sup.OnMessage = func(msg team.Message) {
+		if msg.Kind == team.Task {
+			fmt.Printf("📨 %s\n", msg)
+		} else {
+			fmt.Printf("📨 [%s] %s: [%d chars]\n", msg.Kind, msg.From, len(msg.Content))
+		}
+	}
+	researcher := sup.Delegate("researcher", "Searches the web to answer one factual question", session.newAgent())
+	researcher.TaskKey = "question"
+	researcher.ResultKey = "answer"
+	researcher.Reads("llm", "llmCtx", "search").
+		With("context", "").
+		With("research", []string{})
+
+	shared := map[string]interface{}{
+		"question": question,
+		"llm":      session.chatModel(),
+		"llmCtx":   session.ctx,
+		"search":   NewSearchProvider(session.httpClient, session.secrets),
+	}
+	if action := agent.NewFlow(sup).Run(shared); action != team.DoneAction {
+		return "", fmt.Errorf("team ended on %v: %v", action, shared["error"])
+	}
+	answer, ok := shared["answer"].(string)
+	if !ok || answer == "" {
+		return "", fmt.Errorf("team finished without an answer")
+	}
+	return answer, nil
 }
 
 // Remove global LLM variables as they are now handled within RunResearchAgent
 
 // --- Main Function ---
 func main() {
+	// Serve the agent over HTTP instead of answering a single question
+	if addr := os.Getenv("AGENT_HTTP_ADDR"); addr != "" {
+		if err := ServeResearchAgent(addr); err != nil {
+			log.Fatalf("Server failed: %v", err)
+		}
+		return
+	}
+
+	// Work through a queue of questions instead of answering one
+	if dir := os.Getenv("AGENT_QUEUE_DIR"); dir != "" {
+		question := strings.Join(os.Args[1:], " ")
+		var questions []string
+		if question != "" {
+			questions = append(questions, question)
+		}
+		if err := WorkResearchQueue(dir, questions); err != nil {
+			log.Fatalf("Queue failed: %v", err)
+		}
+		return
+	}
+
+	// Answer a question on a schedule instead of once
+	if spec := os.Getenv("AGENT_DIGEST_SCHEDULE"); spec != "" {
+		question := defaultDigestQuestion
+		if len(os.Args) > 1 {
+			question = strings.Join(os.Args[1:], " ")
+		}
+		if err := RunResearchDigest(spec, question); err != nil {
+			log.Fatalf("Digest failed: %v", err)
+		}
+		return
+	}
+
+	// Split a broad question among research agents instead of answering
+	// it with one
+	if os.Getenv("AGENT_TEAM") != "" && len(os.Args) > 1 {
+		answer, err := RunResearchTeam(strings.Join(os.Args[1:], " "))
+		if err != nil {
+			log.Fatalf("Team failed: %v", err)
+		}
+		fmt.Println("--- Team Answer ---")
+		fmt.Println(answer)
+		return
+	}
+
+	// Flags select the command-line runner, e.g. --dry-run or --resume
+	if len(os.Args) > 1 && strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(RunResearchCLI(os.Args[1:]))
+	}
+
 	// --- Get Question ---
 	question := "What is the capital of France and what is its population?" // Example question
 	if len(os.Args) > 1 {
@@ -491,12 +1110,40 @@ func main() {
 	fmt.Println("-------------------- ")
 
 	// --- Run Agent ---
-	// LLM setup is now inside RunResearchAgent
-	finalAnswer := RunResearchAgent(question)
+	session, err := NewResearchSession()
+	if err != nil {
+		log.Fatalf("Failed to initialize LLM API: %v", err)
+	}
+	defer session.Close()
 
-	// --- Output ---
-	fmt.Println("-------------------- ")
-	fmt.Println("Final Answer:")
-	fmt.Println(finalAnswer)
-	fmt.Println("-------------------- ")
+	// Optionally carry the conversation over from an earlier session
+	memoryFile := os.Getenv("AGENT_MEMORY_FILE")
+	if memoryFile != "" {
+		if err := memory.LoadFile(session.Memory, memoryFile); err != nil {
+			log.Printf("Warning: could not load memory: %v", err)
+		}
+	}
+
+	input := bufio.NewScanner(os.Stdin)
+	for {
+		finalAnswer := session.Ask(question)
+
+		// --- Output ---
+		fmt.Println("-------------------- ")
+		fmt.Println("Final Answer:")
+		fmt.Println(finalAnswer)
+		fmt.Println("-------------------- ")
+
+		fmt.Print("Follow-up question (empty to quit): ")
+		if !input.Scan() || strings.TrimSpace(input.Text()) == "" {
+			break
+		}
+		question = strings.TrimSpace(input.Text())
+	}
+
+	if memoryFile != "" {
+		if err := memory.SaveFile(session.Memory, memoryFile); err != nil {
+			log.Printf("Warning: could not save memory: %v", err)
+		}
+	}
 }
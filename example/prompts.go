@@ -0,0 +1,15 @@
+package main
+
+import (
+	"embed"
+
+	"github.com/utkarsh-cpu/go_agent/prompt"
+)
+
+//go:embed prompts
+var promptFS embed.FS
+
+// prompts holds the versioned prompt templates used by the research agent.
+// Templates live in prompts/<name>.v<N>.tmpl; shared sections such as the
+// ACTION SPACE are partials under prompts/partials.
+var prompts = prompt.MustLoad(promptFS, "prompts")
@@ -3,21 +3,30 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/google/generative-ai-go/genai"
+	"github.com/utkarsh-cpu/go_agent/breaker"
+	"github.com/utkarsh-cpu/go_agent/cache"
+	"github.com/utkarsh-cpu/go_agent/cassette"
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+	"github.com/utkarsh-cpu/go_agent/fetch"
+	"github.com/utkarsh-cpu/go_agent/history"
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+	"github.com/utkarsh-cpu/go_agent/secrets"
+	"github.com/utkarsh-cpu/go_agent/vectorstore"
 	"google.golang.org/api/option"
 )
 
-func SetLlmApi(llm string, apiKey string) (*genai.Client, *genai.GenerativeModel, context.Context, error) {
+func SetLlmApi(llm string, apiKey string, opts ...option.ClientOption) (*genai.Client, *genai.GenerativeModel, context.Context, error) {
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	client, err := genai.NewClient(ctx, append([]option.ClientOption{option.WithAPIKey(apiKey)}, opts...)...)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("error creating genai client: %w", err)
 	}
@@ -31,54 +40,159 @@ const (
 	retryDelay = 30 * time.Second // Delay between retry attempts
 )
 
+// geminiBreaker stops LLM calls, retries included, while Gemini keeps
+// failing, and searchBreaker does the same for web search.
+var (
+	geminiBreaker = breaker.New("gemini")
+	searchBreaker = breaker.New("search")
+)
+
 // SentLlmPrompt sends a prompt to the LLM with retries.
 // It now accepts the model and context directly.
 func SentLlmPrompt(model *genai.GenerativeModel, ctx context.Context, prompt []genai.Part) string {
+	resp, err := generateWithRetries(model, ctx, prompt, maxRetries, false)
+	if err != nil {
+		return "" // Return empty string indicating an error
+	}
+	return responseText(resp)
+}
+
+// generateWithRetries sends a prompt to the LLM, retrying rate limits and
+// server errors up to retries times. With handOver set, errors that another
+// model may not hit, such as rate limits, are returned at once instead.
+func generateWithRetries(model *genai.GenerativeModel, ctx context.Context, prompt []genai.Part, retries int, handOver bool) (*genai.GenerateContentResponse, error) {
 	if model == nil || ctx == nil {
 		log.Println("SentLlmPrompt: Received nil model or context")
-		return "" // Return empty string indicating an error
+		return nil, fmt.Errorf("nil model or context")
 	}
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+	for attempt := 0; attempt <= retries; attempt++ {
 		fmt.Printf("Sending prompt to LLM, attempt %d...\n", attempt+1)
+		if err := geminiBreaker.Allow(); err != nil {
+			fmt.Printf("Gemini is unavailable (%v). Aborting LLM call.\n", err)
+			return nil, err
+		}
 		startTime := time.Now()
 		resp, err := model.GenerateContent(ctx, prompt...)
+		geminiBreaker.Record(err)
 		if err == nil {
 			duration := time.Since(startTime)
 			fmt.Printf("LLM response received in %v.\n", duration)
-			var llmResponse strings.Builder // Use strings.Builder for efficiency
-			for _, c := range resp.Candidates {
-				if c.Content != nil {
-					for _, part := range c.Content.Parts {
-						if text, ok := part.(genai.Text); ok {
-							llmResponse.WriteString(string(text))
-						}
-					}
-				}
-			}
-			fmt.Printf("LLM prompt processed.\n")
-			return llmResponse.String()
+			return resp, nil
 		}
 
 		log.Printf("Error generating content (attempt %d): %v\n", attempt+1, err)
+		if handOver && llm.ClassifyError(err) == llm.Switch {
+			fmt.Printf("Handing the prompt over to the next model.\n")
+			return nil, err
+		}
 
 		// Check if the error is retryable (e.g., rate limit, temporary server issue)
 		// This is a basic check; more specific error handling might be needed based on the genai library's errors.
 		if strings.Contains(err.Error(), "rate limit") || strings.Contains(err.Error(), "server error") {
-			if attempt < maxRetries {
+			if attempt < retries {
 				fmt.Printf("Retrying in %v...\n", retryDelay)
 				time.Sleep(retryDelay)
 			} else {
 				fmt.Printf("Max retries reached for retryable error. Aborting LLM call.\n")
-				return "" // Return empty string if max retries reached
+				return nil, err
 			}
 		} else {
 			// Non-retryable error
 			fmt.Printf("Non-retryable error encountered. Aborting LLM call.\n")
-			return "" // Return empty string for non-retryable errors
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("max retries reached") // Should not reach here, but added for completeness
+}
+
+// responseText concatenates the text parts of all candidates.
+func responseText(resp *genai.GenerateContentResponse) string {
+	var llmResponse strings.Builder // Use strings.Builder for efficiency
+	for _, c := range resp.Candidates {
+		if c.Content != nil {
+			for _, part := range c.Content.Parts {
+				if text, ok := part.(genai.Text); ok {
+					llmResponse.WriteString(string(text))
+				}
+			}
+		}
+	}
+	fmt.Printf("LLM prompt processed.\n")
+	return llmResponse.String()
+}
+
+// GeminiModel adapts a Gemini model to llm.ChatModel, reporting token usage
+// from the response metadata.
+type GeminiModel struct {
+	model *genai.GenerativeModel
+	name  string
+	// retries is the number of retries after a rate limit or server error
+	retries int
+	// handOver returns rate limits and other errors a fallback model may
+	// avoid at once, without retrying
+	handOver bool
+}
+
+// NewGeminiModel wraps a Gemini model created with the given name.
+func NewGeminiModel(model *genai.GenerativeModel, name string) *GeminiModel {
+	return &GeminiModel{model: model, name: name, retries: maxRetries}
+}
+
+// NewGeminiChain returns the Gemini model called name, followed by the
+// fallback models that take over when it fails. Every model retries server
+// errors; only the last one waits and retries on rate limits, the others
+// hand over at once.
+func NewGeminiChain(client *genai.Client, name string, fallbacks []string) llm.ChatModel {
+	if len(fallbacks) == 0 {
+		return NewGeminiModel(client.GenerativeModel(name), name)
+	}
+	chain := llm.NewFallback()
+	for i, n := range append([]string{name}, fallbacks...) {
+		model := NewGeminiModel(client.GenerativeModel(n), n)
+		if i < len(fallbacks) {
+			model.handOver = true
+		}
+		chain.Candidates = append(chain.Candidates, llm.Candidate{Name: n, Model: model})
+	}
+	return chain
+}
+
+// Generate sends the prompt with the same retry policy as SentLlmPrompt.
+func (g *GeminiModel) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	resp, err := generateWithRetries(g.model, ctx, []genai.Part{genai.Text(prompt)}, g.retries, g.handOver)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &llm.Response{Text: responseText(resp), Model: g.name}
+	if resp.UsageMetadata != nil {
+		out.Usage = llm.Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+			TotalTokens:      int(resp.UsageMetadata.TotalTokenCount),
 		}
 	}
-	return "" // Should not reach here, but added for completeness
+	return out, nil
+}
+
+// LlmSummarizer returns a summarizer for the context budget that condenses
+// earlier research with the given model.
+func LlmSummarizer(model llm.ChatModel) contextbudget.SummarizeFunc {
+	return func(ctx context.Context, text string, maxTokens int) (string, error) {
+		if model == nil {
+			return "", fmt.Errorf("no LLM model available for summarization")
+		}
+		promptText := fmt.Sprintf("Summarize the following research notes in at most %d words. Keep names, numbers and sources.\n\n%s", maxTokens*3/4, text)
+		resp, err := model.Generate(ctx, promptText)
+		if err != nil {
+			return "", err
+		}
+		if resp.Text == "" {
+			return "", fmt.Errorf("LLM returned an empty summary")
+		}
+		return strings.TrimSpace(resp.Text), nil
+	}
 }
 
 // ParseHtmlToMarkdown converts HTML content to Markdown format.
@@ -92,93 +206,255 @@ func ParseHtmlToMarkdown(htmlContent string) (string, error) {
 	return markdown, nil
 }
 
-// SearchWeb performs a web search for the given query using Google and Brave.
-// Note: Scraping search engine results pages is generally discouraged, may violate terms of service,
-// and is prone to breaking due to website structure changes. Consider using official search APIs if available.
-func SearchWeb(query string) string {
-	fmt.Printf("Performing web search for: %s\n", query)
+// searchResultLimit is the number of results requested from each provider.
+const searchResultLimit = 8
 
-	var results strings.Builder
-	client := &http.Client{Timeout: 15 * time.Second} // Add a timeout
+const (
+	// pagesToFetch is the number of top results whose pages are downloaded.
+	pagesToFetch = 3
+	// maxPageTokens caps the extracted text kept from each page.
+	maxPageTokens = 1500
+)
 
-	// --- Google Search ---
-	googleURL := fmt.Sprintf("https://www.google.com/search?q=%s&hl=en", url.QueryEscape(query)) // Added hl=en for consistency
-	fmt.Printf("Searching Google: %s\n", googleURL)
-	reqGoogle, err := http.NewRequest("GET", googleURL, nil)
-	if err != nil {
-		log.Printf("Error creating Google request: %v\n", err)
-		results.WriteString(fmt.Sprintf("Error creating Google request: %v\n", err))
-	} else {
-		// Mimic a common browser User-Agent
-		reqGoogle.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		googleResp, errResp := client.Do(reqGoogle)
-		if errResp != nil {
-			log.Printf("Error searching Google: %v\n", errResp)
-			results.WriteString(fmt.Sprintf("Error searching Google: %v\n", errResp))
-		} else {
-			defer googleResp.Body.Close()
-			if googleResp.StatusCode != http.StatusOK {
-				log.Printf("Google search returned non-OK status: %s\n", googleResp.Status)
-				results.WriteString(fmt.Sprintf("Google search failed with status: %s\n", googleResp.Status))
-			} else {
-				bodyBytes, errRead := io.ReadAll(googleResp.Body)
-				if errRead != nil {
-					log.Printf("Error reading Google response body: %v\n", errRead)
-					results.WriteString(fmt.Sprintf("Error reading Google response: %v\n", errRead))
-				} else {
-					markdown, errParse := ParseHtmlToMarkdown(string(bodyBytes))
-					if errParse != nil {
-						results.WriteString(fmt.Sprintf("--- Google Results (Error parsing HTML: %v) ---\n", errParse))
-					} else {
-						results.WriteString("--- Google Results ---\n")
-						results.WriteString(markdown)
-						results.WriteString("\n----------------------\n")
-					}
-				}
-			}
+// pageFetcher downloads result pages; it is shared so its cache and
+// robots.txt rules persist across searches.
+var pageFetcher = fetch.New()
+
+// OpenCassette opens the HTTP cassette named by AGENT_CASSETTE, in the mode
+// named by AGENT_CASSETTE_MODE ("record", "replay" or "auto", the default),
+// so that LLM and search calls can be recorded once and replayed offline. It
+// returns nil when no cassette is configured.
+func OpenCassette() (*cassette.Recorder, error) {
+	path := os.Getenv("AGENT_CASSETTE")
+	if path == "" {
+		return nil, nil
+	}
+	mode := cassette.Auto
+	if name := os.Getenv("AGENT_CASSETTE_MODE"); name != "" {
+		var err error
+		if mode, err = cassette.ParseMode(name); err != nil {
+			return nil, err
+		}
+	}
+	return cassette.New(path, mode)
+}
+
+// OpenSecrets gathers the API keys from, in order: the environment, the
+// dotenv file named by AGENT_DOTENV (default ".env", if it exists), the
+// directory of secret files named by AGENT_SECRETS_DIR, and the encrypted
+// vault named by AGENT_VAULT, unlocked with AGENT_VAULT_PASSPHRASE.
+func OpenSecrets() (*secrets.Store, error) {
+	providers := []secrets.Provider{secrets.Env{}}
+
+	dotenv := os.Getenv("AGENT_DOTENV")
+	if dotenv == "" {
+		if _, err := os.Stat(".env"); err == nil {
+			dotenv = ".env"
+		}
+	}
+	if dotenv != "" {
+		values, err := secrets.LoadDotenv(dotenv)
+		if err != nil {
+			return nil, err
 		}
+		providers = append(providers, values)
 	}
+	if dir := os.Getenv("AGENT_SECRETS_DIR"); dir != "" {
+		providers = append(providers, secrets.Files{Dir: dir})
+	}
+	if path := os.Getenv("AGENT_VAULT"); path != "" {
+		vault, err := secrets.OpenVault(path, os.Getenv("AGENT_VAULT_PASSPHRASE"))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, vault)
+	}
+	return secrets.NewStore(providers...), nil
+}
 
-	results.WriteString("\n")
+// defaultCacheTTL is how long cached replies and searches are kept when
+// AGENT_CACHE_TTL is not set.
+const defaultCacheTTL = 24 * time.Hour
 
-	// --- Brave Search ---
-	// Note: Brave Search might have stricter anti-scraping measures.
-	braveURL := fmt.Sprintf("https://search.brave.com/search?q=%s", url.QueryEscape(query))
-	fmt.Printf("Searching Brave: %s\n", braveURL)
-	reqBrave, err := http.NewRequest("GET", braveURL, nil)
+// OpenCache opens the response cache file named by AGENT_CACHE, so that
+// asking the same question again reuses earlier LLM replies and searches.
+// Entries expire after AGENT_CACHE_TTL, a duration such as "2h". It returns
+// nil when no cache is configured.
+func OpenCache() (*cache.File, time.Duration, error) {
+	path := os.Getenv("AGENT_CACHE")
+	if path == "" {
+		return nil, 0, nil
+	}
+	ttl := defaultCacheTTL
+	if value := os.Getenv("AGENT_CACHE_TTL"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return nil, 0, fmt.Errorf("invalid AGENT_CACHE_TTL: %w", err)
+		}
+	}
+	store, err := cache.OpenFile(path)
 	if err != nil {
-		log.Printf("Error creating Brave request: %v\n", err)
-		results.WriteString(fmt.Sprintf("Error creating Brave request: %v\n", err))
-	} else {
-		reqBrave.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-		braveResp, err := client.Do(reqBrave)
+		return nil, 0, err
+	}
+	return store, ttl, nil
+}
+
+// OpenHistory opens the run history file named by AGENT_HISTORY, which
+// records every run with its input, answer, path, errors and token usage.
+// It returns nil when no history is configured.
+func OpenHistory() (*history.File, error) {
+	path := os.Getenv("AGENT_HISTORY")
+	if path == "" {
+		return nil, nil
+	}
+	return history.OpenFile(path)
+}
+
+// geminiHost serves the Gemini API
+const geminiHost = "generativelanguage.googleapis.com"
+
+// apiKeyTransport adds the Gemini API key to requests for the Gemini API. The
+// genai client only adds it itself when it creates the HTTP client. Other
+// requests, such as searches and page downloads, are sent unchanged so the
+// key never leaves for another host.
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == geminiHost {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Goog-Api-Key", t.key)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// NewSearchProvider builds the search provider: the BRAVE_API_KEY secret
+// enables the Brave Search API and the SEARXNG_URL environment variable a
+// SearXNG instance. When both are set they are queried in parallel. A nil
+// client means http.DefaultClient. Searches go through searchBreaker.
+func NewSearchProvider(client *http.Client, keys secrets.Provider) search.Provider {
+	var providers []search.Provider
+	if key, err := keys.Lookup("BRAVE_API_KEY"); err == nil {
+		brave := search.NewBrave(key)
+		brave.Client = client
+		providers = append(providers, brave)
+	}
+	if base := os.Getenv("SEARXNG_URL"); base != "" {
+		searx := search.NewSearXNG(base)
+		searx.Client = client
+		providers = append(providers, searx)
+	}
+	if len(providers) == 0 {
+		log.Println("Warning: Neither BRAVE_API_KEY nor SEARXNG_URL is set. Web search will fail.")
+	}
+	if len(providers) == 1 {
+		return breaker.Search(providers[0], searchBreaker)
+	}
+	return breaker.Search(search.NewFanOut(providers...), searchBreaker)
+}
+
+// SearchWeb performs a web search for the given query and formats the
+// results, followed by the main content of the top pages, as plain text for
+// the LLM.
+func SearchWeb(ctx context.Context, provider search.Provider, query string) string {
+	fmt.Printf("Performing web search for: %s (%s)\n", query, provider.Name())
+
+	results, err := provider.Search(ctx, query, searchResultLimit)
+	if err != nil {
+		log.Printf("Error searching the web: %v\n", err)
+		return fmt.Sprintf("Error searching the web: %v", err)
+	}
+
+	fmt.Printf("Web search completed with %d results.\n", len(results))
+	return search.Format(results) + FetchResultPages(ctx, results)
+}
+
+// FetchResultPages downloads the top search results, extracts their main
+// content and returns it as Markdown, one section per page. Pages that
+// cannot be fetched are logged and skipped.
+func FetchResultPages(ctx context.Context, results []search.Result) string {
+	urls := make([]string, 0, pagesToFetch)
+	for _, r := range results {
+		if len(urls) == pagesToFetch {
+			break
+		}
+		urls = append(urls, r.URL)
+	}
+
+	var sb strings.Builder
+	for _, res := range pageFetcher.FetchAll(ctx, urls, pagesToFetch) {
+		if res.Err != nil {
+			log.Printf("Warning: skipping page %s: %v\n", res.URL, res.Err)
+			continue
+		}
+		article, err := fetch.Extract(res.Page.Body)
 		if err != nil {
-			log.Printf("Error searching Brave: %v\n", err)
-			results.WriteString(fmt.Sprintf("Error searching Brave: %v\n", err))
-		} else {
-			defer braveResp.Body.Close()
-			if braveResp.StatusCode != http.StatusOK {
-				log.Printf("Brave search returned non-OK status: %s\n", braveResp.Status)
-				results.WriteString(fmt.Sprintf("Brave search failed with status: %s\n", braveResp.Status))
-			} else {
-				bodyBytes, err := io.ReadAll(braveResp.Body)
-				if err != nil {
-					log.Printf("Error reading Brave response body: %v\n", err)
-					results.WriteString(fmt.Sprintf("Error reading Brave response: %v\n", err))
-				} else {
-					markdown, err := ParseHtmlToMarkdown(string(bodyBytes))
-					if err != nil {
-						results.WriteString(fmt.Sprintf("--- Brave Results (Error parsing HTML: %v) ---\n", err))
-					} else {
-						results.WriteString("--- Brave Results ---\n")
-						results.WriteString(markdown)
-						results.WriteString("\n---------------------\n")
-					}
-				}
+			log.Printf("Warning: could not extract %s: %v\n", res.URL, err)
+			continue
+		}
+		markdown, err := ParseHtmlToMarkdown(article.HTML)
+		if err != nil {
+			continue
+		}
+		markdown = contextbudget.Truncate(strings.TrimSpace(markdown), maxPageTokens, contextbudget.HeuristicTokenizer{})
+		fmt.Fprintf(&sb, "\n\n## %s\nSource: %s\n\n%s", article.Title, res.URL, markdown)
+	}
+	return sb.String()
+}
+
+// embeddingModelName is the Gemini model used to embed local documents.
+const embeddingModelName = "text-embedding-004"
+
+// NewGeminiEmbedder adapts a Gemini embedding model to vectorstore.Embedder.
+func NewGeminiEmbedder(client *genai.Client) vectorstore.Embedder {
+	em := client.EmbeddingModel(embeddingModelName)
+	return vectorstore.EmbedderFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+		batch := em.NewBatch()
+		for _, t := range texts {
+			batch.AddContent(genai.Text(t))
+		}
+		resp, err := em.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("embedding with %s: %w", embeddingModelName, err)
+		}
+		vecs := make([][]float32, len(resp.Embeddings))
+		for i, e := range resp.Embeddings {
+			vecs[i] = e.Values
+		}
+		return vecs, nil
+	})
+}
+
+// LoadDocsStore builds a vector store from the Markdown and text files in
+// dir. When indexPath names an existing file the store is loaded from it
+// instead, and a freshly built store is saved there for the next run.
+func LoadDocsStore(ctx context.Context, embedder vectorstore.Embedder, dir, indexPath string) (*vectorstore.Store, error) {
+	store := vectorstore.NewStore(embedder, vectorstore.NewHNSW())
+	if indexPath != "" {
+		if _, err := os.Stat(indexPath); err == nil {
+			if err := store.LoadFile(indexPath); err != nil {
+				return nil, err
 			}
+			fmt.Printf("Loaded %d document chunks from %s\n", store.Len(), indexPath)
+			return store, nil
 		}
 	}
 
-	fmt.Println("Web search completed.")
-	return results.String()
+	docs, err := vectorstore.ReadDocuments(os.DirFS(dir), "*.md", "*.txt")
+	if err != nil {
+		return nil, err
+	}
+	if err := store.AddDocuments(ctx, docs...); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Indexed %d chunks from %d documents in %s\n", store.Len(), len(docs), dir)
+
+	if indexPath != "" {
+		if err := store.SaveFile(indexPath); err != nil {
+			log.Printf("Warning: could not save document index: %v\n", err)
+		}
+	}
+	return store, nil
 }
@@ -0,0 +1,64 @@
+package fetch
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache stores fetched pages by URL
+type Cache interface {
+	Get(url string) (*Page, bool)
+	Set(url string, page *Page)
+}
+
+// MemoryCache is an in-memory least-recently-used Cache
+type MemoryCache struct {
+	max int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	url  string
+	page *Page
+}
+
+// NewMemoryCache creates a cache holding at most max pages
+func NewMemoryCache(max int) *MemoryCache {
+	return &MemoryCache{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache
+func (c *MemoryCache) Get(url string) (*Page, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[url]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).page, true
+}
+
+// Set implements Cache
+func (c *MemoryCache) Set(url string, page *Page) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[url]; ok {
+		el.Value.(*cacheEntry).page = page
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[url] = c.order.PushFront(&cacheEntry{url: url, page: page})
+	for c.max > 0 && c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).url)
+	}
+}
@@ -0,0 +1,224 @@
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// minArticleChars is the amount of text below which a candidate is not
+// considered the main content
+const minArticleChars = 140
+
+var (
+	// boilerplateTags never contain article text
+	boilerplateTags = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+		atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+		atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Template: true,
+		atom.Object: true, atom.Embed: true, atom.Select: true, atom.Input: true,
+	}
+	// unlikelyClass matches class or id values of navigation, ads and widgets
+	unlikelyClass = regexp.MustCompile(`(?i)\b(nav|navbar|menu|breadcrumbs?|sidebar|footer|masthead|comments?|advert\w*|ads?|ad-\w+|sponsor\w*|promo\w*|banner|cookie\w*|consent|social|share|related|subscribe|newsletter|popup|modal)\b`)
+	// likelyClass matches class or id values of article containers
+	likelyClass = regexp.MustCompile(`(?i)\b(article|content|post|entry|main|story|text|body)\b`)
+)
+
+// Article is the main content of a page
+type Article struct {
+	Title string
+	// HTML is the cleaned markup of the main content, suitable for an
+	// HTML-to-Markdown converter
+	HTML string
+	// Text is the plain text of the main content
+	Text string
+}
+
+// Extract finds the main article in an HTML document, in the spirit of
+// Readability: boilerplate elements are removed, then the element whose
+// paragraphs hold the most text, with the fewest links, is chosen.
+func Extract(doc []byte) (*Article, error) {
+	root, err := html.Parse(bytes.NewReader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("parsing html: %w", err)
+	}
+
+	article := &Article{Title: strings.TrimSpace(textOf(findFirst(root, atom.Title)))}
+	prune(root)
+
+	best := bestCandidate(root)
+	if best == nil {
+		best = findFirst(root, atom.Body)
+	}
+	if best == nil {
+		best = root
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, best); err != nil {
+		return nil, fmt.Errorf("rendering article: %w", err)
+	}
+	article.HTML = buf.String()
+	article.Text = collapseSpace(textOf(best))
+	return article, nil
+}
+
+// prune removes boilerplate elements from the tree
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateTags[n.DataAtom] {
+		return true
+	}
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Html || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	if attr(n, "aria-hidden") == "true" || attr(n, "hidden") != "" || attr(n, "role") == "navigation" {
+		return true
+	}
+	marker := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyClass.MatchString(marker) && !likelyClass.MatchString(marker)
+}
+
+// bestCandidate scores the parents of text blocks and returns the best one
+func bestCandidate(root *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+
+	add := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			order = append(order, n)
+			scores[n] = classWeight(n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.P, atom.Pre, atom.Td, atom.Blockquote, atom.Li:
+				text := collapseSpace(textOf(n))
+				if len(text) >= 25 {
+					score := 1 + float64(strings.Count(text, ",")) + float64(min(len(text)/100, 3))
+					add(n.Parent, score)
+					if n.Parent != nil {
+						add(n.Parent.Parent, score/2)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range order {
+		text := collapseSpace(textOf(n))
+		if len(text) < minArticleChars {
+			continue
+		}
+		score := scores[n] * (1 - linkDensity(n, len(text)))
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		weight += 10
+	}
+	marker := attr(n, "class") + " " + attr(n, "id")
+	if likelyClass.MatchString(marker) {
+		weight += 5
+	}
+	return weight
+}
+
+// linkDensity is the share of a node's text that sits inside links
+func linkDensity(n *html.Node, textLen int) float64 {
+	if textLen == 0 {
+		return 0
+	}
+	linkLen := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linkLen += len(collapseSpace(textOf(n)))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(linkLen) / float64(textLen)
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textOf(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
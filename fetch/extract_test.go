@@ -0,0 +1,55 @@
+package fetch
+
+import (
+	"strings"
+	"testing"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html>
+<head><title> Bees and Flowers </title><script>var tracking = 1;</script></head>
+<body>
+  <header><a href="/">Home</a> <a href="/news">News</a></header>
+  <nav class="menu"><ul><li><a href="/a">Section A, with a long enough label</a></li></ul></nav>
+  <div class="sidebar-ads">Buy now, limited offer, sale, discount, everything must go!</div>
+  <div id="content" class="post-body">
+    <h1>Bees and Flowers</h1>
+    <p>Bees visit flowers to collect nectar and pollen, which they use as food for the colony.</p>
+    <p>While doing so, they transfer pollen between flowers, which allows many plants to reproduce.</p>
+    <p>Without pollinators, yields of fruit, nuts and seeds would fall sharply, according to researchers.</p>
+  </div>
+  <div class="comments"><p>First! Great article, thanks for sharing, loved it.</p></div>
+  <footer>Copyright, all rights reserved, 2024, and some more footer text here.</footer>
+</body>
+</html>`
+
+func TestExtract_FindsMainContent(t *testing.T) {
+	article, err := Extract([]byte(articlePage))
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	if article.Title != "Bees and Flowers" {
+		t.Errorf("Title = %q", article.Title)
+	}
+	if !strings.Contains(article.Text, "transfer pollen between flowers") {
+		t.Errorf("Text is missing the article body: %q", article.Text)
+	}
+	if !strings.Contains(article.HTML, "<p>") {
+		t.Errorf("HTML should keep paragraph markup: %q", article.HTML)
+	}
+	for _, junk := range []string{"tracking", "Buy now", "Section A", "First!", "Copyright"} {
+		if strings.Contains(article.Text, junk) {
+			t.Errorf("Text should not contain %q: %q", junk, article.Text)
+		}
+	}
+}
+
+func TestExtract_FallsBackToBody(t *testing.T) {
+	article, err := Extract([]byte("<html><body><span>short page</span></body></html>"))
+	if err != nil {
+		t.Fatalf("Extract error = %v", err)
+	}
+	if article.Text != "short page" {
+		t.Errorf("Text = %q, want %q", article.Text, "short page")
+	}
+}
@@ -0,0 +1,212 @@
+// Package fetch downloads web pages politely and extracts their main content.
+//
+// A Fetcher bounds every download by time and size, honours robots.txt and
+// caches pages by URL, revalidating them with ETag and Last-Modified so an
+// unchanged page is not downloaded twice. Extract then reduces a page to its
+// main article, dropping navigation, ads and other boilerplate.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a single download
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxBytes caps the size of a downloaded body
+	DefaultMaxBytes = 2 << 20
+	// DefaultUserAgent identifies the fetcher to sites and robots.txt
+	DefaultUserAgent = "go_agent-fetch/1.0 (+https://github.com/utkarsh-cpu/go_agent)"
+)
+
+// ErrDisallowed is returned when robots.txt forbids fetching a URL
+var ErrDisallowed = errors.New("fetch: disallowed by robots.txt")
+
+// Page is a downloaded web page
+type Page struct {
+	URL          string
+	StatusCode   int
+	ContentType  string
+	Body         []byte
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+	// Truncated is set when the body was cut at the fetcher's size cap
+	Truncated bool
+	// FromCache is set when the page was served from the cache, either
+	// because it was still valid or because the server answered 304
+	FromCache bool
+}
+
+// Fetcher downloads pages. The zero value is not usable; create one with New.
+type Fetcher struct {
+	Client    *http.Client
+	Timeout   time.Duration
+	MaxBytes  int64
+	UserAgent string
+	// IgnoreRobots disables robots.txt checks
+	IgnoreRobots bool
+	// Cache stores pages for revalidation; nil disables caching
+	Cache Cache
+
+	mu     sync.Mutex
+	robots map[string]*robotsRules
+}
+
+// New creates a Fetcher with default limits and an in-memory cache
+func New() *Fetcher {
+	return &Fetcher{
+		Client:    &http.Client{},
+		Timeout:   DefaultTimeout,
+		MaxBytes:  DefaultMaxBytes,
+		UserAgent: DefaultUserAgent,
+		Cache:     NewMemoryCache(256),
+		robots:    make(map[string]*robotsRules),
+	}
+}
+
+// Fetch downloads rawURL, or revalidates the cached copy
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("fetch: unsupported scheme %q", u.Scheme)
+	}
+
+	if !f.IgnoreRobots && !f.allowed(ctx, u) {
+		return nil, fmt.Errorf("%w: %s", ErrDisallowed, rawURL)
+	}
+
+	var cached *Page
+	if f.Cache != nil {
+		cached, _ = f.Cache.Get(rawURL)
+	}
+
+	headers := http.Header{}
+	if cached != nil {
+		if cached.ETag != "" {
+			headers.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			headers.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, body, truncated, err := f.get(ctx, rawURL, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		page := *cached
+		page.FromCache = true
+		page.FetchedAt = time.Now()
+		f.Cache.Set(rawURL, &page)
+		return &page, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+
+	page := &Page{
+		URL:          rawURL,
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+		Truncated:    truncated,
+	}
+	if f.Cache != nil && (page.ETag != "" || page.LastModified != "") {
+		f.Cache.Set(rawURL, page)
+	}
+	return page, nil
+}
+
+// Result is the outcome of fetching one URL with FetchAll
+type Result struct {
+	URL  string
+	Page *Page
+	Err  error
+}
+
+// FetchAll downloads urls with at most concurrency requests in flight and
+// returns the results in the order of urls
+func (f *Fetcher) FetchAll(ctx context.Context, urls []string, concurrency int) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]Result, len(urls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			page, err := f.Fetch(ctx, u)
+			results[i] = Result{URL: u, Page: page, Err: err}
+		}(i, u)
+	}
+	wg.Wait()
+	return results
+}
+
+// get performs a GET bounded by the fetcher's timeout and size cap
+func (f *Fetcher) get(ctx context.Context, rawURL string, headers http.Header) (*http.Response, []byte, bool, error) {
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("fetch: %w", err)
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	// Read one byte past the cap to tell a full body from a truncated one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("fetch %s: reading body: %w", rawURL, err)
+	}
+	truncated := int64(len(body)) > maxBytes
+	if truncated {
+		body = body[:maxBytes]
+	}
+	return resp, body, truncated, nil
+}
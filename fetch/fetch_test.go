@@ -0,0 +1,188 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetch_RespectsRobots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\nAllow: /private/ok\n"))
+		default:
+			w.Write([]byte("<p>hello</p>"))
+		}
+	}))
+	defer srv.Close()
+
+	f := New()
+	if _, err := f.Fetch(context.Background(), srv.URL+"/private/secret"); !errors.Is(err, ErrDisallowed) {
+		t.Fatalf("Fetch(/private/secret) error = %v, want ErrDisallowed", err)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/private/ok"); err != nil {
+		t.Fatalf("Fetch(/private/ok) error = %v", err)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/public"); err != nil {
+		t.Fatalf("Fetch(/public) error = %v", err)
+	}
+
+	f.IgnoreRobots = true
+	if _, err := f.Fetch(context.Background(), srv.URL+"/private/secret"); err != nil {
+		t.Fatalf("Fetch with IgnoreRobots error = %v", err)
+	}
+}
+
+func TestParseRobots_SpecificGroupWins(t *testing.T) {
+	data := []byte(`
+User-agent: *
+Disallow: /
+
+User-agent: go_agent-fetch
+Disallow: /tmp$
+`)
+	rules := parseRobots(data, DefaultUserAgent)
+	if !rules.allows("/page") {
+		t.Error("specific group should allow /page")
+	}
+	if rules.allows("/tmp") {
+		t.Error("specific group should disallow /tmp")
+	}
+	if !rules.allows("/tmp/file") {
+		t.Error("$ anchor should only disallow /tmp exactly")
+	}
+
+	other := parseRobots(data, "otherbot/2.0")
+	if other.allows("/page") {
+		t.Error("wildcard group should disallow everything for otherbot")
+	}
+}
+
+func TestFetch_DisallowsWhileRobotsUnreachable(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/robots.txt":
+			w.Write([]byte("<p>hello</p>"))
+		case down.Load():
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := New()
+	if _, err := f.Fetch(context.Background(), srv.URL+"/page"); !errors.Is(err, ErrDisallowed) {
+		t.Fatalf("Fetch with robots.txt failing = %v, want ErrDisallowed", err)
+	}
+	// The outage is not remembered; a missing robots.txt allows everything
+	down.Store(false)
+	if _, err := f.Fetch(context.Background(), srv.URL+"/page"); err != nil {
+		t.Fatalf("Fetch with robots.txt missing = %v", err)
+	}
+}
+
+func TestFetch_TruncatesAtSizeCap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	f := New()
+	f.MaxBytes = 10
+	page, err := f.Fetch(context.Background(), srv.URL+"/big")
+	if err != nil {
+		t.Fatalf("Fetch error = %v", err)
+	}
+	if len(page.Body) != 10 || !page.Truncated {
+		t.Errorf("got %d bytes, truncated=%v; want 10 bytes, truncated", len(page.Body), page.Truncated)
+	}
+}
+
+func TestFetch_RevalidatesWithETag(t *testing.T) {
+	var full, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	f := New()
+	first, err := f.Fetch(context.Background(), srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("first Fetch error = %v", err)
+	}
+	if first.FromCache {
+		t.Error("first fetch should not come from cache")
+	}
+
+	second, err := f.Fetch(context.Background(), srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("second Fetch error = %v", err)
+	}
+	if !second.FromCache || string(second.Body) != "body" {
+		t.Errorf("second fetch = %+v, want cached body", second)
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("full=%d notModified=%d, want 1 and 1", full, notModified)
+	}
+}
+
+func TestFetchAll_KeepsOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" || r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	urls := []string{srv.URL + "/a", srv.URL + "/missing", srv.URL + "/c"}
+	results := New().FetchAll(context.Background(), urls, 2)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if string(results[0].Page.Body) != "/a" || string(results[2].Page.Body) != "/c" {
+		t.Errorf("results out of order: %q, %q", results[0].Page.Body, results[2].Page.Body)
+	}
+	if results[1].Err == nil {
+		t.Error("expected an error for /missing")
+	}
+}
+
+func TestMemoryCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", &Page{URL: "a"})
+	c.Set("b", &Page{URL: "b"})
+	c.Get("a")
+	c.Set("c", &Page{URL: "c"})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a should still be cached")
+	}
+}
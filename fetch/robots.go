@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// robotsRules are the Allow and Disallow lines that apply to our user agent
+type robotsRules struct {
+	rules []robotsRule
+	// disallowAll is set when robots.txt could not be reached
+	disallowAll bool
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// allowed reports whether robots.txt on u's host permits fetching u
+func (f *Fetcher) allowed(ctx context.Context, u *url.URL) bool {
+	host := u.Scheme + "://" + u.Host
+
+	f.mu.Lock()
+	if f.robots == nil {
+		f.robots = make(map[string]*robotsRules)
+	}
+	rules, ok := f.robots[host]
+	f.mu.Unlock()
+
+	if !ok {
+		var transient bool
+		rules, transient = f.loadRobots(ctx, host)
+		// Ask again next time rather than remember an outage
+		if !transient {
+			f.mu.Lock()
+			f.robots[host] = rules
+			f.mu.Unlock()
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rules.allows(path)
+}
+
+// loadRobots downloads and parses robots.txt. As RFC 9309 specifies, a
+// file that does not exist (a 4xx status) allows everything, while a file
+// that cannot be reached (a 5xx status or a network error) disallows
+// everything. The latter is reported as transient.
+func (f *Fetcher) loadRobots(ctx context.Context, host string) (rules *robotsRules, transient bool) {
+	resp, body, _, err := f.get(ctx, host+"/robots.txt", nil)
+	switch {
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		return &robotsRules{disallowAll: true}, true
+	case resp.StatusCode != http.StatusOK:
+		return &robotsRules{}, false
+	}
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return parseRobots(body, userAgent), false
+}
+
+// parseRobots extracts the rules for userAgent, falling back to the "*"
+// group when no group names it
+func parseRobots(data []byte, userAgent string) *robotsRules {
+	token := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+	var specific, wildcard []robotsRule
+	var agents []string
+	inRules := false
+	matched, matchedWildcard := false, false
+	foundSpecific := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				// A user-agent line after rules starts a new group
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+			matched, matchedWildcard = false, false
+			for _, a := range agents {
+				if a == "*" {
+					matchedWildcard = true
+				} else if strings.Contains(token, a) {
+					matched = true
+					foundSpecific = true
+				}
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // an empty Disallow allows everything
+			}
+			rule := robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)}
+			if matched {
+				specific = append(specific, rule)
+			} else if matchedWildcard {
+				wildcard = append(wildcard, rule)
+			}
+		}
+	}
+
+	if foundSpecific {
+		return &robotsRules{rules: specific}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// robotsPattern compiles a robots.txt path pattern, supporting the "*" and
+// "$" wildcards
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	parts := strings.Split(p, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allows applies the longest matching rule; Allow wins ties
+func (r *robotsRules) allows(path string) bool {
+	if r.disallowAll {
+		return false
+	}
+	best := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best = rule.length
+			allow = rule.allow
+		}
+	}
+	return allow
+}
@@ -0,0 +1,72 @@
+package flowdef
+
+import (
+	"fmt"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// Builtins returns a Registry with the generic node types:
+//
+//   - set writes params.values into the shared map and returns params.action
+//   - route returns the value of shared[params.key] as its action, or
+//     params.default when the key is missing
+//
+// The returned Registry is a new map that callers may extend.
+func Builtins() Registry {
+	return Registry{
+		"set":   newSetNode,
+		"route": newRouteNode,
+	}
+}
+
+// setNode writes fixed values into the shared map
+type setNode struct {
+	*agent.BaseNode
+	values map[string]interface{}
+	action string
+}
+
+func newSetNode(def NodeDef) (agent.Runnable, error) {
+	n := &setNode{BaseNode: agent.NewBaseNode()}
+	if v, ok := def.Params["values"]; ok {
+		values, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("set: values must be a map, got %T", v)
+		}
+		n.values = values
+	}
+	n.action, _ = def.Params["action"].(string)
+	return n, nil
+}
+
+func (n *setNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	for k, v := range n.values {
+		shared[k] = v
+	}
+	return n.action
+}
+
+// routeNode branches on a shared value
+type routeNode struct {
+	*agent.BaseNode
+	key      string
+	fallback string
+}
+
+func newRouteNode(def NodeDef) (agent.Runnable, error) {
+	key, _ := def.Params["key"].(string)
+	if key == "" {
+		return nil, fmt.Errorf("route: params.key is required")
+	}
+	fallback, _ := def.Params["default"].(string)
+	return &routeNode{BaseNode: agent.NewBaseNode(), key: key, fallback: fallback}, nil
+}
+
+func (n *routeNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	v, ok := shared[n.key]
+	if !ok || v == nil {
+		return n.fallback
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,201 @@
+// Package flowdef builds flows from YAML definitions.
+//
+// A definition names its nodes, gives each a type and parameters, and lists
+// the transitions between them:
+//
+//	name: triage
+//	start: classify
+//	nodes:
+//	  classify:
+//	    type: route
+//	    params: {key: kind}
+//	    next: {bug: file_bug, question: reply}
+//	  file_bug:
+//	    type: set
+//	    params:
+//	      values: {status: filed}
+//	  reply:
+//	    type: set
+//	    params:
+//	      values: {status: answered}
+//
+// Node types are looked up in a Registry of factories, so a program makes its
+// own Go nodes available to definitions by registering them next to the
+// Builtins.
+package flowdef
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"gopkg.in/yaml.v2"
+)
+
+// Definition describes a flow
+type Definition struct {
+	Name        string              `yaml:"name"`
+	Description string              `yaml:"description"`
+	Start       string              `yaml:"start"`
+	Nodes       map[string]*NodeDef `yaml:"nodes"`
+}
+
+// NodeDef describes one node of a flow
+type NodeDef struct {
+	// Name is the node's key in Definition.Nodes
+	Name   string                 `yaml:"-"`
+	Type   string                 `yaml:"type"`
+	Params map[string]interface{} `yaml:"params"`
+	// Retries and Wait configure retries for node types that support them
+	Retries int           `yaml:"retries"`
+	Wait    time.Duration `yaml:"wait"`
+	// Next maps actions to the names of the nodes they lead to
+	Next map[string]string `yaml:"next"`
+}
+
+// NodeFactory creates a node from its definition
+type NodeFactory func(def NodeDef) (agent.Runnable, error)
+
+// Registry maps node types to factories
+type Registry map[string]NodeFactory
+
+// Parse decodes a YAML definition. Nested maps in parameters are decoded with
+// string keys, so that they can be stored in the shared map and encoded as
+// JSON.
+func Parse(data []byte) (*Definition, error) {
+	var def Definition
+	if err := yaml.UnmarshalStrict(data, &def); err != nil {
+		return nil, fmt.Errorf("parsing flow definition: %w", err)
+	}
+	for name, node := range def.Nodes {
+		if node == nil {
+			node = &NodeDef{}
+			def.Nodes[name] = node
+		}
+		node.Name = name
+		for k, v := range node.Params {
+			node.Params[k] = normalize(v)
+		}
+	}
+	return &def, nil
+}
+
+// LoadFile reads and parses a YAML definition
+func LoadFile(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading flow definition: %w", err)
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// normalize converts the map[interface{}]interface{} values produced by the
+// YAML decoder into map[string]interface{}
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Validate checks that the definition can be built with reg: the start node
+// exists, every node has a registered type and every transition leads to a
+// defined node
+func (d *Definition) Validate(reg Registry) error {
+	var errs []error
+	if len(d.Nodes) == 0 {
+		errs = append(errs, errors.New("no nodes defined"))
+	}
+	if d.Start == "" {
+		errs = append(errs, errors.New("no start node"))
+	} else if _, ok := d.Nodes[d.Start]; !ok {
+		errs = append(errs, fmt.Errorf("start node %q is not defined", d.Start))
+	}
+	for _, name := range d.names() {
+		node := d.Nodes[name]
+		if node.Type == "" {
+			errs = append(errs, fmt.Errorf("node %q has no type", name))
+		} else if _, ok := reg[node.Type]; !ok {
+			errs = append(errs, fmt.Errorf("node %q has unknown type %q", name, node.Type))
+		}
+		for _, action := range sortedKeys(node.Next) {
+			if _, ok := d.Nodes[node.Next[action]]; !ok {
+				errs = append(errs, fmt.Errorf("node %q: %q leads to undefined node %q", name, action, node.Next[action]))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Build validates the definition and creates its flow. The flow and every
+// node are named after the definition.
+func (d *Definition) Build(reg Registry) (*agent.Flow, error) {
+	if err := d.Validate(reg); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]agent.Runnable, len(d.Nodes))
+	for _, name := range d.names() {
+		node, err := reg[d.Nodes[name].Type](*d.Nodes[name])
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", name, err)
+		}
+		if n, ok := node.(interface{ SetName(string) }); ok {
+			n.SetName(name)
+		}
+		nodes[name] = node
+	}
+	for _, name := range d.names() {
+		from, ok := nodes[name].(interface {
+			Next(node interface{}, action string) interface{}
+		})
+		if !ok {
+			return nil, fmt.Errorf("node %q cannot have successors", name)
+		}
+		for _, action := range sortedKeys(d.Nodes[name].Next) {
+			from.Next(nodes[d.Nodes[name].Next[action]], action)
+		}
+	}
+
+	flow := agent.NewFlow(nodes[d.Start])
+	if d.Name != "" {
+		flow.SetName(d.Name)
+	}
+	return flow, nil
+}
+
+func (d *Definition) names() []string {
+	names := make([]string, 0, len(d.Nodes))
+	for name := range d.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
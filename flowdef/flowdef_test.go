@@ -0,0 +1,83 @@
+package flowdef
+
+import (
+	"strings"
+	"testing"
+)
+
+const triage = `
+name: triage
+start: classify
+nodes:
+  classify:
+    type: route
+    params: {key: kind, default: other}
+    next: {bug: file_bug, other: reply}
+  file_bug:
+    type: set
+    params:
+      values: {status: filed, labels: {area: core}}
+  reply:
+    type: set
+    params:
+      values: {status: answered}
+`
+
+func TestBuild_RunsDefinition(t *testing.T) {
+	def, err := Parse([]byte(triage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := def.Build(Builtins())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.Name() != "triage" {
+		t.Errorf("flow name = %q", flow.Name())
+	}
+
+	shared := map[string]interface{}{"kind": "bug"}
+	flow.Run(shared)
+	if shared["status"] != "filed" {
+		t.Errorf("status = %v, want filed", shared["status"])
+	}
+	labels, ok := shared["labels"].(map[string]interface{})
+	if !ok || labels["area"] != "core" {
+		t.Errorf("labels = %#v, want a map with string keys", shared["labels"])
+	}
+
+	shared = map[string]interface{}{}
+	flow.Run(shared)
+	if shared["status"] != "answered" {
+		t.Errorf("status without a kind = %v, want answered", shared["status"])
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	def, err := Parse([]byte(`
+start: missing
+nodes:
+  a:
+    type: llm
+    next: {done: nowhere}
+  b: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = def.Validate(Builtins())
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{`start node "missing"`, `unknown type "llm"`, `undefined node "nowhere"`, `node "b" has no type`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestParse_RejectsUnknownFields(t *testing.T) {
+	if _, err := Parse([]byte("start: a\nnodez: {}\n")); err == nil {
+		t.Error("Parse() accepted an unknown field")
+	}
+}
@@ -2,3 +2,7 @@ module github.com/utkarsh-cpu/go_agent
 
 go 1.24.2
 
+require (
+	golang.org/x/net v0.37.0
+	gopkg.in/yaml.v2 v2.4.0
+)
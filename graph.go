@@ -0,0 +1,126 @@
+package go_agent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Edge is a transition from one node of a flow to another
+type Edge struct {
+	From   string
+	Action string
+	To     string
+}
+
+// Graph describes the nodes reachable from a flow's start node and the
+// transitions between them. Nested flows appear as single nodes.
+type Graph struct {
+	Start string
+	// Nodes are listed in breadth-first order from Start
+	Nodes []string
+	Edges []Edge
+}
+
+// Graph returns the structure of the flow
+func (f *Flow) Graph() Graph {
+	var g Graph
+	f.visit(func(node Runnable) {
+		name := NodeName(node)
+		if g.Start == "" {
+			g.Start = name
+		}
+		g.Nodes = append(g.Nodes, name)
+		for _, action := range sortedActions(node.baseNode()) {
+			to := node.baseNode().successors[action]
+			g.Edges = append(g.Edges, Edge{From: name, Action: action, To: NodeName(to)})
+		}
+	})
+	return g
+}
+
+// Validate reports problems that would stop the flow from running as
+// designed: a missing start node, successors that are not nodes, and
+// distinct nodes sharing a name, which makes them ambiguous to Resume
+func (f *Flow) Validate() error {
+	if f.startNode == nil {
+		return errors.New("flow has no start node")
+	}
+	if _, ok := f.startNode.(Runnable); !ok {
+		return fmt.Errorf("flow start %T is not a node", f.startNode)
+	}
+
+	var errs []error
+	named := make(map[string]Runnable)
+	f.visit(func(node Runnable) {
+		name := NodeName(node)
+		if other, ok := named[name]; ok && other != node {
+			errs = append(errs, fmt.Errorf("two nodes are named %q", name))
+		}
+		named[name] = node
+		for _, action := range sortedActions(node.baseNode()) {
+			if _, ok := node.baseNode().successors[action].(Runnable); !ok {
+				errs = append(errs, fmt.Errorf("successor of %q for %q is %T, not a node", name, action, node.baseNode().successors[action]))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// visit calls fn once for every node reachable from the start node, in
+// breadth-first order
+func (f *Flow) visit(fn func(Runnable)) {
+	start, ok := f.startNode.(Runnable)
+	if !ok {
+		return
+	}
+	seen := map[Runnable]bool{start: true}
+	queue := []Runnable{start}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		fn(curr)
+		for _, action := range sortedActions(curr.baseNode()) {
+			if next, ok := curr.baseNode().successors[action].(Runnable); ok && !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+func sortedActions(b *BaseNode) []string {
+	actions := make([]string, 0, len(b.successors))
+	for action := range b.successors {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, with the start node drawn
+// as a stadium
+func (g Graph) Mermaid() string {
+	ids := make(map[string]string, len(g.Nodes))
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for i, name := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[name] = id
+		label := strings.ReplaceAll(name, `"`, "#quot;")
+		if name == g.Start {
+			fmt.Fprintf(&sb, "    %s([\"%s\"])\n", id, label)
+		} else {
+			fmt.Fprintf(&sb, "    %s[\"%s\"]\n", id, label)
+		}
+	}
+	for _, e := range g.Edges {
+		to, ok := ids[e.To]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&sb, "    %s -->|%s| %s\n", ids[e.From], strings.ReplaceAll(e.Action, "|", "#124;"), to)
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package go_agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFlow_GraphAndMermaid(t *testing.T) {
+	decide := NewBaseNode()
+	decide.SetName("decide")
+	search := NewBaseNode()
+	search.SetName("search")
+	answer := NewBaseNode()
+	answer.SetName("answer")
+	decide.Next(search, "search")
+	decide.Next(answer, "answer")
+	search.Next(decide, "decide")
+
+	g := NewFlow(decide).Graph()
+	if g.Start != "decide" || fmt.Sprint(g.Nodes) != "[decide answer search]" {
+		t.Fatalf("Expected nodes in breadth-first order, got %+v", g)
+	}
+	if len(g.Edges) != 3 || g.Edges[0] != (Edge{From: "decide", Action: "answer", To: "answer"}) {
+		t.Fatalf("Unexpected edges %+v", g.Edges)
+	}
+
+	chart := g.Mermaid()
+	for _, want := range []string{"flowchart TD", `n0(["decide"])`, "n0 -->|search| n2", "n2 -->|decide| n0"} {
+		if !strings.Contains(chart, want) {
+			t.Fatalf("Expected the chart to contain %q:\n%s", want, chart)
+		}
+	}
+}
+
+func TestBaseNode_Actions(t *testing.T) {
+	decide := NewBaseNode()
+	if len(decide.Actions()) != 0 {
+		t.Fatalf("Expected no actions without successors, got %v", decide.Actions())
+	}
+	decide.Next(NewBaseNode(), "search")
+	decide.Next(NewBaseNode(), "answer")
+	if fmt.Sprint(decide.Actions()) != "[answer search]" {
+		t.Fatalf("Expected sorted actions, got %v", decide.Actions())
+	}
+}
+
+func TestFlow_Validate(t *testing.T) {
+	if err := NewFlow(nil).Validate(); err == nil {
+		t.Fatalf("Expected an error for a flow without a start node")
+	}
+
+	first := NewBaseNode()
+	first.SetName("step")
+	second := NewBaseNode()
+	second.SetName("step")
+	first.Next(second, "default")
+	first.Next("not a node", "broken")
+
+	err := NewFlow(first).Validate()
+	if err == nil || !strings.Contains(err.Error(), `two nodes are named "step"`) || !strings.Contains(err.Error(), "not a node") {
+		t.Fatalf("Expected duplicate name and invalid successor errors, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package guard adds guardrails to flows: validators that check the values
+// nodes read and write, and a hook that runs them around nodes.
+//
+// A Validator inspects a piece of text and reports Violations. Rule-based
+// validators match regular expressions, blocklisted phrases, lengths and
+// JSON schemas; Judge asks an LLM instead. A Guard is an agent.Hook that
+// runs validators on shared values before a node (its input) or after it
+// (its output) and then acts on violations: Redact replaces the offending
+// text, Reject stops the flow on RejectedAction, and Route transitions on
+// an action of the caller's choice.
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// RejectedAction is the action a Guard transitions on when a rule with
+	// the Reject action fails
+	RejectedAction = "rejected"
+	// ViolationsKey is the shared key that collects a run's Reports
+	ViolationsKey = "guardrail_violations"
+	// DefaultReplacement replaces redacted text
+	DefaultReplacement = "[REDACTED]"
+)
+
+// Span is a byte range of a checked text
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Violation is a problem a Validator found in a text
+type Violation struct {
+	Validator string `json:"validator"`
+	Message   string `json:"message"`
+	// Spans locate the offending parts of the text, when known. Redacting
+	// a violation without spans replaces the whole text.
+	Spans []Span `json:"spans,omitempty"`
+}
+
+// Validator checks a text. An error means the text could not be checked;
+// a Guard treats it as a violation, so that guarded content fails closed.
+type Validator interface {
+	Name() string
+	Validate(ctx context.Context, text string) ([]Violation, error)
+}
+
+// Stage tells whether a rule checks a node's input or output
+type Stage int
+
+const (
+	// Before checks a shared value before the node runs
+	Before Stage = iota
+	// After checks a shared value after the node ran
+	After
+)
+
+func (s Stage) String() string {
+	if s == Before {
+		return "before"
+	}
+	return "after"
+}
+
+type actionKind int
+
+const (
+	redact actionKind = iota
+	reject
+	route
+)
+
+// Action is what a Guard does when a rule fails
+type Action struct {
+	kind  actionKind
+	route string
+}
+
+var (
+	// Redact replaces the offending text and lets the flow go on. Only
+	// strings and string slices can be redacted; other values are rejected.
+	Redact = Action{kind: redact}
+	// Reject skips the node, or discards its action, and transitions on
+	// RejectedAction
+	Reject = Action{kind: reject}
+)
+
+// Route transitions on action, which the guarded node routes with Next, for
+// example to a node that asks the user to rephrase
+func Route(action string) Action {
+	return Action{kind: route, route: action}
+}
+
+func (a Action) String() string {
+	switch a.kind {
+	case redact:
+		return "redact"
+	case reject:
+		return "reject"
+	default:
+		return "route:" + a.route
+	}
+}
+
+// Rule checks the shared value under Key around the node named Node
+type Rule struct {
+	Node       string
+	Key        string
+	Stage      Stage
+	Action     Action
+	Validators []Validator
+}
+
+// Report records a failed rule in shared[ViolationsKey]
+type Report struct {
+	Node       string      `json:"node"`
+	Key        string      `json:"key"`
+	Stage      string      `json:"stage"`
+	Action     string      `json:"action"`
+	Violations []Violation `json:"violations"`
+}
+
+// Guard is an agent.Hook that enforces rules around nodes. A Guard may be
+// shared by concurrent flows.
+type Guard struct {
+	// ContextKey names the shared key holding the context given to
+	// validators, such as an LLM judge; "ctx" by default
+	ContextKey string
+	// Replacement replaces redacted text; DefaultReplacement by default
+	Replacement string
+
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// New creates a Guard without rules
+func New() *Guard {
+	return &Guard{ContextKey: "ctx", Replacement: DefaultReplacement}
+}
+
+// Add adds rules to the guard
+func (g *Guard) Add(rules ...Rule) *Guard {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rules = append(g.rules, rules...)
+	return g
+}
+
+// Before checks shared[key] with validators before the node named node runs
+func (g *Guard) Before(node, key string, action Action, validators ...Validator) *Guard {
+	return g.Add(Rule{Node: node, Key: key, Stage: Before, Action: action, Validators: validators})
+}
+
+// After checks shared[key] with validators after the node named node ran
+func (g *Guard) After(node, key string, action Action, validators ...Validator) *Guard {
+	return g.Add(Rule{Node: node, Key: key, Stage: After, Action: action, Validators: validators})
+}
+
+// BeforeNode implements agent.Hook
+func (g *Guard) BeforeNode(name string, shared map[string]interface{}) string {
+	return g.enforce(name, Before, shared)
+}
+
+// AfterNode implements agent.Hook
+func (g *Guard) AfterNode(name string, shared map[string]interface{}, action string) string {
+	if a := g.enforce(name, After, shared); a != "" {
+		return a
+	}
+	return action
+}
+
+// enforce applies the rules of a node's stage in order and returns the
+// action of the first one that redirects the flow, or ""
+func (g *Guard) enforce(node string, stage Stage, shared map[string]interface{}) string {
+	g.mu.Lock()
+	var rules []Rule
+	for _, r := range g.rules {
+		if r.Node == node && r.Stage == stage {
+			rules = append(rules, r)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, r := range rules {
+		if a := g.apply(r, shared); a != "" {
+			return a
+		}
+	}
+	return ""
+}
+
+// apply checks one rule and carries out its action
+func (g *Guard) apply(r Rule, shared map[string]interface{}) string {
+	value, ok := shared[r.Key]
+	if !ok || value == nil {
+		return ""
+	}
+	texts, redactable := textsOf(value)
+
+	ctx, ok := shared[g.ContextKey].(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
+	var all []Violation
+	found := make([][]Violation, len(texts))
+	for i, text := range texts {
+		for _, v := range r.Validators {
+			violations, err := v.Validate(ctx, text)
+			if err != nil {
+				violations = []Violation{{Validator: v.Name(), Message: fmt.Sprintf("validator failed: %v", err)}}
+			}
+			found[i] = append(found[i], violations...)
+		}
+		all = append(all, found[i]...)
+	}
+	if len(all) == 0 {
+		return ""
+	}
+
+	action := r.Action
+	if action.kind == redact && !redactable {
+		action = Reject
+	}
+	reports, _ := shared[ViolationsKey].([]Report)
+	shared[ViolationsKey] = append(reports, Report{Node: r.Node, Key: r.Key, Stage: r.Stage.String(), Action: action.String(), Violations: all})
+
+	switch action.kind {
+	case redact:
+		for i, text := range texts {
+			texts[i] = redactText(text, found[i], g.replacement())
+		}
+		if _, ok := value.(string); ok {
+			shared[r.Key] = texts[0]
+		} else {
+			shared[r.Key] = texts
+		}
+		return ""
+	case reject:
+		return RejectedAction
+	default:
+		return action.route
+	}
+}
+
+func (g *Guard) replacement() string {
+	if g.Replacement == "" {
+		return DefaultReplacement
+	}
+	return g.Replacement
+}
+
+// textsOf returns the texts to check in a shared value, and whether they can
+// be redacted. Values other than strings are checked as JSON.
+func textsOf(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return append([]string(nil), v...), true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return []string{fmt.Sprint(value)}, false
+	}
+	return []string{string(data)}, false
+}
+
+// redactText replaces the spans of violations in text, or the whole text
+// when a violation has no spans
+func redactText(text string, violations []Violation, replacement string) string {
+	var spans []Span
+	for _, v := range violations {
+		if len(v.Spans) == 0 {
+			return replacement
+		}
+		spans = append(spans, v.Spans...)
+	}
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+
+	out := make([]byte, 0, len(text))
+	pos := 0
+	for _, s := range spans {
+		end := min(s.End, len(text))
+		if s.Start < pos {
+			// Overlaps the span redacted last
+			pos = max(pos, end)
+			continue
+		}
+		if s.Start >= end {
+			continue
+		}
+		out = append(out, text[pos:s.Start]...)
+		out = append(out, replacement...)
+		pos = end
+	}
+	out = append(out, text[pos:]...)
+	return string(out)
+}
@@ -0,0 +1,119 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+type regexValidator struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+// Regex reports every match of patterns. The matched text is not included
+// in the violation's message, since it may be what the rule protects.
+func Regex(name string, patterns ...*regexp.Regexp) Validator {
+	return &regexValidator{name: name, patterns: patterns}
+}
+
+func (r *regexValidator) Name() string {
+	return r.name
+}
+
+func (r *regexValidator) Validate(ctx context.Context, text string) ([]Violation, error) {
+	var spans []Span
+	for _, re := range r.patterns {
+		for _, m := range re.FindAllStringIndex(text, -1) {
+			spans = append(spans, Span{Start: m[0], End: m[1]})
+		}
+	}
+	if len(spans) == 0 {
+		return nil, nil
+	}
+	return []Violation{{Validator: r.name, Message: fmt.Sprintf("%d matches", len(spans)), Spans: spans}}, nil
+}
+
+// Blocklist reports occurrences of phrases, ignoring case. Phrases only
+// match whole words.
+func Blocklist(name string, phrases ...string) Validator {
+	patterns := make([]*regexp.Regexp, len(phrases))
+	for i, p := range phrases {
+		patterns[i] = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(p) + `\b`)
+	}
+	return &regexValidator{name: name, patterns: patterns}
+}
+
+type lengthValidator struct {
+	min, max int
+}
+
+// Length reports texts shorter than min or longer than max characters; a
+// max of zero means no limit. Redacting a text that is too long truncates
+// it.
+func Length(min, max int) Validator {
+	return &lengthValidator{min: min, max: max}
+}
+
+func (l *lengthValidator) Name() string {
+	return "length"
+}
+
+func (l *lengthValidator) Validate(ctx context.Context, text string) ([]Violation, error) {
+	n := utf8.RuneCountInString(text)
+	switch {
+	case n < l.min:
+		return []Violation{{Validator: "length", Message: fmt.Sprintf("%d characters, want at least %d", n, l.min)}}, nil
+	case l.max > 0 && n > l.max:
+		// Find the byte offset of the first character over the limit
+		cut := 0
+		for i := 0; i < l.max; i++ {
+			_, size := utf8.DecodeRuneInString(text[cut:])
+			cut += size
+		}
+		return []Violation{{
+			Validator: "length",
+			Message:   fmt.Sprintf("%d characters, want at most %d", n, l.max),
+			Spans:     []Span{{Start: cut, End: len(text)}},
+		}}, nil
+	}
+	return nil, nil
+}
+
+// injectionPatterns match common attempts to override an LLM's instructions
+// from content it is given to read
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\s+(all\s+|any\s+)?(the\s+|your\s+)?(previous|prior|above|earlier|preceding)\s+(instructions|prompts?|rules|directions)\b`),
+	regexp.MustCompile(`(?i)\byou\s+are\s+now\s+(a|an|in|the)\b[^.\n]*`),
+	regexp.MustCompile(`(?i)\b(reveal|print|show|repeat)\s+(me\s+)?(your|the)\s+(system\s+prompt|hidden\s+instructions|instructions)\b`),
+	regexp.MustCompile(`(?i)\bnew\s+instructions\s*:`),
+	regexp.MustCompile(`(?i)</?\s*(system|assistant)\s*>`),
+	regexp.MustCompile(`(?i)\bdo\s+not\s+(tell|inform)\s+the\s+user\b`),
+}
+
+// PromptInjection reports phrases that try to override an LLM's
+// instructions, as found in scraped pages and other untrusted content. It
+// catches common attacks only; combine it with a Judge where more is at
+// stake.
+func PromptInjection() Validator {
+	return Regex("prompt_injection", injectionPatterns...)
+}
+
+// piiPatterns match common kinds of personal data
+var piiPatterns = []*regexp.Regexp{
+	// Email addresses
+	regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`),
+	// US social security numbers
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	// Payment card numbers, with optional spaces or dashes
+	regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	// Phone numbers in international or North American format
+	regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b`),
+}
+
+// PII reports email addresses, phone numbers, social security numbers and
+// payment card numbers
+func PII() Validator {
+	return Regex("pii", piiPatterns...)
+}
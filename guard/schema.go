@@ -0,0 +1,203 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema understood by JSONSchema: type, enum,
+// properties, required, additionalProperties (as a boolean), items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum and maximum
+type Schema struct {
+	Type                 interface{}        `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+type schemaValidator struct {
+	schema *Schema
+}
+
+// JSONSchema reports texts that are not JSON documents matching schema,
+// such as LLM replies that must follow a structured format
+func JSONSchema(schema []byte) (Validator, error) {
+	var s Schema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("parsing JSON schema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &schemaValidator{schema: &s}, nil
+}
+
+// compile prepares the patterns of s and its subschemas
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("compiling schema pattern: %w", err)
+		}
+		s.pattern = re
+	}
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+func (v *schemaValidator) Name() string {
+	return "json_schema"
+}
+
+func (v *schemaValidator) Validate(ctx context.Context, text string) ([]Violation, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(text), &doc); err != nil {
+		return []Violation{{Validator: "json_schema", Message: fmt.Sprintf("not valid JSON: %v", err)}}, nil
+	}
+	var violations []Violation
+	v.schema.check("$", doc, func(path, msg string) {
+		violations = append(violations, Violation{Validator: "json_schema", Message: path + ": " + msg})
+	})
+	return violations, nil
+}
+
+// check reports every way value, found at path, does not match s
+func (s *Schema) check(path string, value interface{}, report func(path, msg string)) {
+	if s.Type != nil && !s.typeMatches(value) {
+		report(path, fmt.Sprintf("is %s, want %v", jsonType(value), s.Type))
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		report(path, "is not one of the allowed values")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report(path, fmt.Sprintf("missing required property %q", name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				p.check(path+"."+name, v[name], report)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				report(path, fmt.Sprintf("unexpected property %q", name))
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			report(path, fmt.Sprintf("has %d items, want at least %d", len(v), *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			report(path, fmt.Sprintf("has %d items, want at most %d", len(v), *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, report)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			report(path, fmt.Sprintf("has %d characters, want at least %d", n, *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report(path, fmt.Sprintf("has %d characters, want at most %d", n, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report(path, fmt.Sprintf("does not match %q", s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			report(path, fmt.Sprintf("is %v, want at least %v", v, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			report(path, fmt.Sprintf("is %v, want at most %v", v, *s.Maximum))
+		}
+	}
+}
+
+// typeMatches reports whether value has the schema's type, which is a type
+// name or a list of them
+func (s *Schema) typeMatches(value interface{}) bool {
+	var types []string
+	switch t := s.Type.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+	}
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(value interface{}) bool {
+	data, _ := json.Marshal(value)
+	for _, allowed := range s.Enum {
+		if a, _ := json.Marshal(allowed); string(a) == string(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", value), "*")
+}
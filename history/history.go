@@ -0,0 +1,211 @@
+// Package history records flow runs so that they can be looked up, filtered
+// and compared after the fact.
+//
+// A Recorder follows a run through the flow's events and produces a Run:
+// its input and output, final action and status, duration, the nodes it
+// went through, the errors it met and its token usage. Runs are kept in a
+// Store; NewMemory keeps them in memory and OpenFile in a JSON-lines file
+// that survives restarts. Store.Query filters them, Compare shows what
+// changed between two runs and Summarize aggregates many.
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+	"github.com/utkarsh-cpu/go_agent/usage"
+)
+
+// ErrNotFound is returned for unknown run IDs
+var ErrNotFound = errors.New("history: run not found")
+
+// Status is how a run ended
+type Status string
+
+// Run statuses
+const (
+	// Succeeded runs completed their flow
+	Succeeded Status = "succeeded"
+	// Failed runs returned an error, panicked or ended on the "error" action
+	Failed Status = "failed"
+	// Suspended runs stopped at a node waiting for input
+	Suspended Status = "suspended"
+)
+
+// Run is the record of one flow run
+type Run struct {
+	ID     string `json:"id"`
+	Flow   string `json:"flow"`
+	Status Status `json:"status"`
+	// Action is the flow's final action
+	Action string `json:"action,omitempty"`
+	// Error describes why the run failed
+	Error string `json:"error,omitempty"`
+	// Input is the shared state the run started with and Output the one it
+	// ended with, both without values that cannot be encoded as JSON
+	Input      map[string]interface{} `json:"input,omitempty"`
+	Output     map[string]interface{} `json:"output,omitempty"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	Duration   time.Duration          `json:"duration"`
+	// Path lists the nodes the run started, in order
+	Path []string `json:"path,omitempty"`
+	// Errors lists the failed attempts of nodes, including the last one
+	// before a node fell back
+	Errors []NodeError `json:"errors,omitempty"`
+	// Usage is the run's LLM usage, when the recorder had a tracker
+	Usage *usage.Report `json:"usage,omitempty"`
+	// Labels are free-form tags to filter and group runs by, such as a
+	// prompt version or a deployment
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NodeError is a failed attempt of a node
+type NodeError struct {
+	Node    string `json:"node"`
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Tokens returns the total number of tokens the run used
+func (r *Run) Tokens() int {
+	if r.Usage == nil {
+		return 0
+	}
+	return r.Usage.Total.Usage.TotalTokens
+}
+
+// Cost returns the estimated cost of the run's LLM calls
+func (r *Run) Cost() float64 {
+	if r.Usage == nil {
+		return 0
+	}
+	return r.Usage.Total.Cost
+}
+
+// Store keeps runs. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save stores a run, replacing any run with the same ID
+	Save(ctx context.Context, run *Run) error
+	// Get returns the run with the given ID
+	Get(ctx context.Context, id string) (*Run, error)
+	// Query returns the runs that match filter, newest first
+	Query(ctx context.Context, filter Filter) ([]*Run, error)
+}
+
+// Recorder builds the Run of one flow run from the flow's events. Register
+// its Observe method with Flow.Observe before the run, and call Finish and
+// the function Flow.Observe returned after it.
+type Recorder struct {
+	// Usage, when set, is the tracker of this run only; its report is
+	// recorded with the run
+	Usage *usage.Tracker
+	// Labels are recorded with the run
+	Labels map[string]string
+
+	mu  sync.Mutex
+	run Run
+}
+
+// NewRecorder starts recording a run of the flow called name with input as
+// its shared state
+func NewRecorder(name string, input map[string]interface{}) *Recorder {
+	return &Recorder{run: Run{
+		ID:        state.NewID(),
+		Flow:      name,
+		Input:     state.Encodable(input),
+		StartedAt: time.Now(),
+	}}
+}
+
+// ID returns the ID of the recorded run
+func (r *Recorder) ID() string {
+	return r.run.ID
+}
+
+// Observe records an event of the run
+func (r *Recorder) Observe(ev agent.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch ev.Type {
+	case agent.NodeStarted:
+		r.run.Path = append(r.run.Path, ev.Node)
+	case agent.FlowCompleted, agent.FlowFailed:
+		r.run.Action = ev.Action
+		if ev.Type == agent.FlowFailed {
+			r.run.Error = ev.Error
+		}
+	default:
+		// Failed attempts are reported with the retries they cause, and the
+		// last one with ExecFailed
+		if ev.Error != "" {
+			r.run.Errors = append(r.run.Errors, NodeError{Node: ev.Node, Attempt: ev.Attempt, Error: ev.Error})
+		}
+	}
+}
+
+// Finish completes the run with the final shared state and the flow's
+// result and returns it
+func (r *Recorder) Finish(shared map[string]interface{}, result interface{}) *Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.run
+	run.FinishedAt = time.Now()
+	run.Duration = run.FinishedAt.Sub(run.StartedAt)
+	run.Output = state.Encodable(shared)
+	run.Labels = r.Labels
+	if r.Usage != nil {
+		report := r.Usage.Report()
+		run.Usage = &report
+	}
+
+	run.Status = Succeeded
+	switch res := result.(type) {
+	case *agent.Suspension:
+		run.Status = Suspended
+	case error:
+		run.Status = Failed
+		if run.Error == "" {
+			run.Error = res.Error()
+		}
+	case string:
+		if run.Action == "" {
+			run.Action = res
+		}
+	}
+	if run.Error != "" && run.Status != Suspended {
+		run.Status = Failed
+	}
+	if run.Action == "error" {
+		run.Status = Failed
+	}
+	return &run
+}
+
+// Record runs flow with shared, saves its Run to store and returns the
+// flow's result with the Run. A tracker, when given, must be used by this
+// run only. A panic in the flow is recorded as a failure and re-panicked.
+func Record(ctx context.Context, store Store, name string, flow *agent.Flow, shared map[string]interface{}, tracker *usage.Tracker) (result interface{}, run *Run, err error) {
+	rec := NewRecorder(name, shared)
+	rec.Usage = tracker
+	defer flow.Observe(rec.Observe)()
+	defer func() {
+		if r := recover(); r != nil {
+			run = rec.Finish(shared, fmt.Errorf("flow panicked: %v", r))
+			store.Save(context.WithoutCancel(ctx), run)
+			panic(r)
+		}
+	}()
+	result = flow.Run(shared)
+	run = rec.Finish(shared, result)
+	// Record the run even when ctx was canceled during it
+	if err := store.Save(context.WithoutCancel(ctx), run); err != nil {
+		return result, run, fmt.Errorf("saving run %s: %w", run.ID, err)
+	}
+	return result, run, nil
+}
@@ -0,0 +1,221 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/usage"
+)
+
+// answerNode fails its first failures attempts, then answers the question
+type answerNode struct {
+	*agent.Node
+	failures int
+	tracker  *usage.Tracker
+}
+
+func (n *answerNode) Prep(shared map[string]interface{}) interface{} {
+	return shared["question"]
+}
+
+func (n *answerNode) Exec(prepRes interface{}) interface{} {
+	if n.failures > 0 {
+		n.failures--
+		panic("model unavailable")
+	}
+	if n.tracker != nil {
+		n.tracker.RecordFor("answer", "test-model", llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	}
+	if prepRes == "" {
+		return errors.New("empty question")
+	}
+	return "answer to " + prepRes.(string)
+}
+
+func (n *answerNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if err, ok := execRes.(error); ok {
+		shared["error"] = err.Error()
+		return "error"
+	}
+	shared["answer"] = execRes
+	return "done"
+}
+
+type client struct{ key string }
+
+func newFlow(failures int, tracker *usage.Tracker) *agent.Flow {
+	answer := &answerNode{Node: agent.NewNode(3, 0), failures: failures, tracker: tracker}
+	answer.SetName("answer")
+	return agent.NewFlow(answer)
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+	tracker := usage.NewTracker(usage.PriceTable{}, usage.Limits{})
+	shared := map[string]interface{}{"question": "why", "ctx": ctx, "llm": &client{key: "secret"}}
+
+	result, run, err := Record(ctx, store, "research", newFlow(1, tracker), shared, tracker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "done" || run.Status != Succeeded || run.Action != "done" {
+		t.Fatalf("run = %s on %q, result %v, want succeeded on done", run.Status, run.Action, result)
+	}
+	if len(run.Path) != 1 || run.Path[0] != "answer" {
+		t.Fatalf("path = %v, want [answer]", run.Path)
+	}
+	if len(run.Errors) != 1 || run.Errors[0].Node != "answer" || run.Errors[0].Error != "model unavailable" {
+		t.Fatalf("errors = %+v, want the retried attempt", run.Errors)
+	}
+	if _, ok := run.Input["llm"]; ok || run.Input["question"] != "why" {
+		t.Fatalf("input = %v, want the question without the client", run.Input)
+	}
+	if run.Output["answer"] != "answer to why" || run.Tokens() != 15 {
+		t.Fatalf("output = %v with %d tokens", run.Output, run.Tokens())
+	}
+	if got, err := store.Get(ctx, run.ID); err != nil || got.Action != "done" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an unknown run = %v, want ErrNotFound", err)
+	}
+
+	// A node without retries that panics falls back to its error
+	once := &answerNode{Node: agent.NewNode(1, 0), failures: 1}
+	once.SetName("answer")
+	_, run, _ = Record(ctx, store, "research", agent.NewFlow(once), map[string]interface{}{"question": "why"}, nil)
+	if run.Status != Failed || len(run.Errors) != 1 || run.Errors[0].Attempt != 1 || run.Errors[0].Error != "model unavailable" {
+		t.Fatalf("run = %s with errors %+v, want failed with its only attempt", run.Status, run.Errors)
+	}
+
+	_, run, _ = Record(ctx, store, "research", newFlow(0, nil), map[string]interface{}{"question": ""}, nil)
+	if run.Status != Failed || run.Action != "error" || run.Error != "empty question" {
+		t.Fatalf("run = %s on %q (%q), want failed with the node's error", run.Status, run.Action, run.Error)
+	}
+}
+
+func TestRecord_SameFlowTwice(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+	flow := newFlow(0, nil)
+
+	_, first, _ := Record(ctx, store, "research", flow, map[string]interface{}{"question": "why"}, nil)
+	_, second, _ := Record(ctx, store, "research", flow, map[string]interface{}{"question": "how"}, nil)
+	if len(first.Path) != 1 || len(second.Path) != 1 {
+		t.Fatalf("paths = %v, %v, want one node each", first.Path, second.Path)
+	}
+	if got, _ := store.Get(ctx, first.ID); len(got.Path) != 1 {
+		t.Fatalf("stored path = %v after a later run, want one node", got.Path)
+	}
+}
+
+func TestFile_QueryAndCompare(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	store, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC)
+	runs := []*Run{
+		{ID: "a", Flow: "research", Status: Succeeded, Action: "done", StartedAt: start, Duration: time.Second,
+			Path: []string{"decide", "answer"}, Output: map[string]interface{}{"answer": "Paris"}, Labels: map[string]string{"prompt": "v1"}},
+		{ID: "b", Flow: "research", Status: Succeeded, Action: "done", StartedAt: start.Add(time.Minute), Duration: 3 * time.Second,
+			Path: []string{"decide", "search", "decide", "answer"}, Output: map[string]interface{}{"answer": "Paris, France"}, Labels: map[string]string{"prompt": "v2"},
+			Usage: &usage.Report{Total: usage.Totals{Usage: llm.Usage{TotalTokens: 100}}}},
+		{ID: "c", Flow: "research", Status: Failed, Action: "error", Error: "search failed", StartedAt: start.Add(2 * time.Minute), Duration: 2 * time.Second,
+			Path: []string{"decide", "search"}, Labels: map[string]string{"prompt": "v2"}},
+		{ID: "d", Flow: "digest", Status: Succeeded, StartedAt: start.Add(3 * time.Minute)},
+	}
+	for _, run := range runs {
+		if err := store.Save(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Saving a run again replaces it
+	runs[3].Action = "sent"
+	store.Save(ctx, runs[3])
+	store.Close()
+
+	store, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.Len() != 4 {
+		t.Fatalf("Len = %d, want 4", store.Len())
+	}
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 4 {
+		t.Fatalf("file has %d records after reopening, want 4", n)
+	}
+
+	cases := []struct {
+		filter Filter
+		want   string
+	}{
+		{Filter{Flow: "research"}, "cba"},
+		{Filter{Node: "search"}, "cb"},
+		{Filter{Status: Succeeded, Labels: map[string]string{"prompt": "v2"}}, "b"},
+		{Filter{ErrorContains: "search"}, "c"},
+		{Filter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, "cb"},
+		{Filter{MinDuration: 2 * time.Second}, "cb"},
+		{Filter{Limit: 2}, "dc"},
+		{Filter{Action: "sent"}, "d"},
+	}
+	for _, c := range cases {
+		got, err := store.Query(ctx, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids string
+		for _, run := range got {
+			ids += run.ID
+		}
+		if ids != c.want {
+			t.Errorf("Query(%+v) = %q, want %q", c.filter, ids, c.want)
+		}
+	}
+
+	a, _ := store.Get(ctx, "a")
+	b, _ := store.Get(ctx, "b")
+	diff := Compare(a, b)
+	fields := map[string]bool{}
+	for _, c := range diff.Changes {
+		fields[c.Field] = true
+	}
+	if len(diff.Changes) != 3 || !fields["path"] || !fields["labels.prompt"] || !fields["output.answer"] {
+		t.Fatalf("Compare = %s", diff)
+	}
+	if diff.Duration != 2*time.Second || diff.Tokens != 100 {
+		t.Fatalf("Compare = %s, want 2s and 100 tokens more", diff)
+	}
+
+	v2, _ := store.Query(ctx, Filter{Labels: map[string]string{"prompt": "v2"}})
+	stats := Summarize(v2)
+	if stats.Runs != 2 || stats.SuccessRate() != 0.5 || stats.MeanDuration != 2500*time.Millisecond ||
+		stats.P95Duration != 3*time.Second || stats.Actions["error"] != 1 || stats.Tokens != 100 {
+		t.Fatalf("Summarize = %+v", stats)
+	}
+
+	if n, err := store.Prune(start.Add(2 * time.Minute)); n != 2 || err != nil {
+		t.Fatalf("Prune = %d, %v, want 2", n, err)
+	}
+	store.Close()
+	store, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.Len() != 2 {
+		t.Fatalf("Len after Prune = %d, want 2", store.Len())
+	}
+}
@@ -0,0 +1,213 @@
+package history
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter selects runs. Zero fields match every run.
+type Filter struct {
+	Flow   string
+	Status Status
+	Action string
+	// Node selects runs that went through the named node
+	Node string
+	// Since and Until bound the start time of runs
+	Since time.Time
+	Until time.Time
+	// MinDuration and MaxDuration bound the duration of runs
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	// Labels selects runs that have all of these labels
+	Labels map[string]string
+	// ErrorContains selects runs whose error contains this text
+	ErrorContains string
+	// Limit caps the number of runs returned, newest first
+	Limit int
+}
+
+// Match reports whether run is selected by f
+func (f Filter) Match(run *Run) bool {
+	switch {
+	case f.Flow != "" && run.Flow != f.Flow,
+		f.Status != "" && run.Status != f.Status,
+		f.Action != "" && run.Action != f.Action,
+		f.Node != "" && !slices.Contains(run.Path, f.Node),
+		!f.Since.IsZero() && run.StartedAt.Before(f.Since),
+		!f.Until.IsZero() && !run.StartedAt.Before(f.Until),
+		f.MinDuration > 0 && run.Duration < f.MinDuration,
+		f.MaxDuration > 0 && run.Duration > f.MaxDuration,
+		f.ErrorContains != "" && !strings.Contains(run.Error, f.ErrorContains):
+		return false
+	}
+	for k, v := range f.Labels {
+		if run.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the runs selected by f, newest first
+func (f Filter) apply(runs []*Run) []*Run {
+	var out []*Run
+	for _, run := range runs {
+		if f.Match(run) {
+			out = append(out, run)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out
+}
+
+// Change is a field that differs between two runs
+type Change struct {
+	// Field names what changed, such as "action", "path" or
+	// "output.answer"
+	Field string
+	A, B  interface{}
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.A, c.B)
+}
+
+// Diff is what changed from run A to run B
+type Diff struct {
+	A, B    string
+	Changes []Change
+	// Duration, Tokens and Cost are B's values minus A's
+	Duration time.Duration
+	Tokens   int
+	Cost     float64
+}
+
+// Compare returns what changed from run a to run b: their status, action,
+// error, path, labels and every input and output key
+func Compare(a, b *Run) Diff {
+	d := Diff{
+		A:        a.ID,
+		B:        b.ID,
+		Duration: b.Duration - a.Duration,
+		Tokens:   b.Tokens() - a.Tokens(),
+		Cost:     b.Cost() - a.Cost(),
+	}
+	add := func(field string, x, y interface{}) {
+		if !reflect.DeepEqual(x, y) {
+			d.Changes = append(d.Changes, Change{Field: field, A: x, B: y})
+		}
+	}
+	add("flow", a.Flow, b.Flow)
+	add("status", a.Status, b.Status)
+	add("action", a.Action, b.Action)
+	add("error", a.Error, b.Error)
+	add("path", strings.Join(a.Path, " -> "), strings.Join(b.Path, " -> "))
+	compareMaps(add, "labels.", stringMap(a.Labels), stringMap(b.Labels))
+	compareMaps(add, "input.", a.Input, b.Input)
+	compareMaps(add, "output.", a.Output, b.Output)
+	return d
+}
+
+func compareMaps(add func(string, interface{}, interface{}), prefix string, a, b map[string]interface{}) {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		add(prefix+k, a[k], b[k])
+	}
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// String formats the diff for terminals and logs
+func (d Diff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s -> %s: duration %+v, tokens %+d, cost %+.6f", d.A, d.B, d.Duration, d.Tokens, d.Cost)
+	for _, c := range d.Changes {
+		fmt.Fprintf(&sb, "\n  %s", c)
+	}
+	return sb.String()
+}
+
+// Stats aggregates a set of runs
+type Stats struct {
+	Runs      int `json:"runs"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Suspended int `json:"suspended"`
+	// Actions counts the runs by final action
+	Actions map[string]int `json:"actions"`
+	// MeanDuration, P50Duration and P95Duration describe the run durations
+	MeanDuration time.Duration `json:"mean_duration"`
+	P50Duration  time.Duration `json:"p50_duration"`
+	P95Duration  time.Duration `json:"p95_duration"`
+	Tokens       int           `json:"tokens"`
+	Cost         float64       `json:"cost"`
+}
+
+// SuccessRate returns the share of runs that succeeded
+func (s Stats) SuccessRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Succeeded) / float64(s.Runs)
+}
+
+// Summarize aggregates runs, for example the runs of two prompt versions
+// selected by label
+func Summarize(runs []*Run) Stats {
+	s := Stats{Runs: len(runs), Actions: make(map[string]int)}
+	if len(runs) == 0 {
+		return s
+	}
+	durations := make([]time.Duration, 0, len(runs))
+	var total time.Duration
+	for _, run := range runs {
+		switch run.Status {
+		case Succeeded:
+			s.Succeeded++
+		case Failed:
+			s.Failed++
+		case Suspended:
+			s.Suspended++
+		}
+		s.Actions[run.Action]++
+		s.Tokens += run.Tokens()
+		s.Cost += run.Cost()
+		durations = append(durations, run.Duration)
+		total += run.Duration
+	}
+	slices.Sort(durations)
+	s.MeanDuration = total / time.Duration(len(runs))
+	s.P50Duration = percentile(durations, 0.50)
+	s.P95Duration = percentile(durations, 0.95)
+	return s
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.999999) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
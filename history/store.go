@@ -0,0 +1,233 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Memory is a Store that keeps runs in memory
+type Memory struct {
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory creates an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{runs: make(map[string]*Run)}
+}
+
+// Save implements Store
+func (m *Memory) Save(ctx context.Context, run *Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *run
+	m.runs[run.ID] = &c
+	return nil
+}
+
+// Get implements Store
+func (m *Memory) Get(ctx context.Context, id string) (*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, ok := m.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	c := *run
+	return &c, nil
+}
+
+// Query implements Store
+func (m *Memory) Query(ctx context.Context, filter Filter) ([]*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := filter.apply(m.list())
+	for i, run := range runs {
+		c := *run
+		runs[i] = &c
+	}
+	return runs, nil
+}
+
+// Len returns the number of runs
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.runs)
+}
+
+// list returns the stored runs. m.mu must be held.
+func (m *Memory) list() []*Run {
+	runs := make([]*Run, 0, len(m.runs))
+	for _, run := range m.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// prune removes the runs started before t and reports how many there were.
+// m.mu must be held.
+func (m *Memory) prune(t time.Time) int {
+	n := 0
+	for id, run := range m.runs {
+		if run.StartedAt.Before(t) {
+			delete(m.runs, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Prune removes the runs started before t and returns how many it removed
+func (m *Memory) Prune(t time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prune(t)
+}
+
+// File is a Store kept in a single append-only file of JSON lines, one per
+// saved run, so that the history survives restarts. Runs are also kept in
+// memory for queries. A run saved again is appended again; the older
+// record is dropped when the file is opened and by Prune.
+type File struct {
+	Memory
+	path string
+	f    *os.File
+}
+
+var _ Store = (*File)(nil)
+
+// OpenFile opens the File store at path, creating it if needed
+func OpenFile(path string) (*File, error) {
+	s := &File{Memory: Memory{runs: make(map[string]*Run)}, path: path}
+	records, stale := 0, false
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("opening history: %w", err)
+	default:
+		dec := json.NewDecoder(f)
+		for {
+			var run Run
+			err := dec.Decode(&run)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// Most likely a record cut short by a crash; keep the
+				// records before it and drop the rest when rewriting
+				log.Printf("Warning: history %s: dropping unreadable records: %v", path, err)
+				stale = true
+				break
+			}
+			records++
+			s.runs[run.ID] = &run
+		}
+		f.Close()
+	}
+
+	if stale || records > len(s.runs) {
+		if err := s.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	if s.f, err = openAppend(path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func openAppend(path string) (*os.File, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("opening history: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	return f, nil
+}
+
+// Save implements Store
+func (s *File) Save(ctx context.Context, run *Run) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("saving run %s: %w", run.ID, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("saving run %s: %w", run.ID, err)
+	}
+	// Keep what was written, so that fresh and reloaded runs look alike
+	var c Run
+	if err := json.Unmarshal(line, &c); err != nil {
+		return fmt.Errorf("saving run %s: %w", run.ID, err)
+	}
+	s.runs[run.ID] = &c
+	return nil
+}
+
+// Prune removes the runs started before t from memory and from the file and
+// returns how many it removed
+func (s *File) Prune(t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.prune(t)
+	if n == 0 {
+		return 0, nil
+	}
+	s.f.Close()
+	if err := s.rewrite(); err != nil {
+		return n, err
+	}
+	var err error
+	s.f, err = openAppend(s.path)
+	return n, err
+}
+
+// rewrite replaces the file with one record per run, oldest first. s.mu
+// must be held unless the store is not shared yet.
+func (s *File) rewrite() error {
+	runs := Filter{}.apply(s.list())
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for i := len(runs) - 1; i >= 0; i-- {
+		if err := enc.Encode(runs[i]); err != nil {
+			f.Close()
+			return fmt.Errorf("compacting history: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+	// Rename so a crash never leaves a half-written file
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
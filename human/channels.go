@@ -0,0 +1,135 @@
+package human
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CLI asks on a terminal and waits for the answer. It reads In through one
+// buffer for all its questions, so that answers piped in ahead are not lost;
+// use it through a pointer.
+type CLI struct {
+	In  io.Reader
+	Out io.Writer
+
+	mu      sync.Mutex
+	scanner *bufio.Scanner
+	scanIn  io.Reader
+}
+
+// NewCLI creates a CLI reading answers from in and asking on out
+func NewCLI(in io.Reader, out io.Writer) *CLI {
+	return &CLI{In: in, Out: out}
+}
+
+// Ask implements Channel. The human types one of the options, or any text
+// for free-form requests; an option may be followed by a colon and a note,
+// as in "reject: wrong recipient".
+func (c *CLI) Ask(ctx context.Context, req Request) (*Response, error) {
+	// One question at a time, each reading on from where the last stopped
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scanner == nil || c.scanIn != c.In {
+		c.scanner, c.scanIn = bufio.NewScanner(c.In), c.In
+	}
+	scanner := c.scanner
+
+	fmt.Fprintf(c.Out, "\n🙋 %s\n", req.Prompt)
+	if len(req.Options) > 0 {
+		fmt.Fprintf(c.Out, "Options: %s\n", strings.Join(req.Options, " / "))
+	}
+
+	for {
+		fmt.Fprint(c.Out, "> ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("reading answer: %w", err)
+			}
+			return nil, fmt.Errorf("reading answer: %w", io.ErrUnexpectedEOF)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		decision, input := line, ""
+		if len(req.Options) > 0 {
+			d, note, _ := strings.Cut(line, ":")
+			decision, input = strings.TrimSpace(d), strings.TrimSpace(note)
+		} else {
+			decision, input = "", line
+		}
+		if err := req.Valid(decision); err != nil {
+			fmt.Fprintf(c.Out, "Please answer one of: %s\n", strings.Join(req.Options, ", "))
+			continue
+		}
+		return &Response{RequestID: req.ID, Decision: decision, Input: input, Responder: "cli", At: time.Now()}, nil
+	}
+}
+
+// Chan announces requests on a Go channel and leaves the answer to Resume
+type Chan struct {
+	Requests chan Request
+}
+
+// NewChan creates a Chan with a buffer of size requests
+func NewChan(size int) *Chan {
+	return &Chan{Requests: make(chan Request, size)}
+}
+
+// Ask implements Channel
+func (c *Chan) Ask(ctx context.Context, req Request) (*Response, error) {
+	select {
+	case c.Requests <- req:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Webhook announces requests by POSTing them as JSON to URL, for example to
+// a chat bot or a ticketing system, and leaves the answer to Resume
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// Ask implements Channel
+func (w Webhook) Ask(ctx context.Context, req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("webhook: unexpected status %s", resp.Status)
+	}
+	return nil, nil
+}
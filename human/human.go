@@ -0,0 +1,70 @@
+// Package human puts a person in the loop of a flow.
+//
+// A HumanInputNode asks a Channel for a decision. Channels that can answer
+// at once, such as CLI, let the flow carry on with the decision as its next
+// action. Channels that only announce the request, such as Chan or Webhook,
+// make the node save the flow's state to a Store and suspend the flow; once
+// the human has answered, Resume restores the state and continues the flow
+// with their decision.
+package human
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Request asks a human for a decision
+type Request struct {
+	ID     string `json:"id"`
+	Node   string `json:"node"`
+	Prompt string `json:"prompt"`
+	// Options are the decisions the human may take; each is an action of
+	// the node. Empty means free-form input.
+	Options   []string               `json:"options,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Response is a human's answer to a Request
+type Response struct {
+	RequestID string `json:"request_id"`
+	// Decision is the action the flow continues with
+	Decision string `json:"decision"`
+	// Input is optional free text, such as a correction or a reason
+	Input     string    `json:"input,omitempty"`
+	Responder string    `json:"responder,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// ErrInvalidDecision is returned when a decision is not one of a request's
+// options
+var ErrInvalidDecision = errors.New("human: decision is not one of the options")
+
+// Valid checks a decision against the request's options
+func (r Request) Valid(decision string) error {
+	if len(r.Options) == 0 {
+		return nil
+	}
+	for _, o := range r.Options {
+		if o == decision {
+			return nil
+		}
+	}
+	return ErrInvalidDecision
+}
+
+// Channel delivers requests to humans. Ask returns the response when the
+// channel can wait for it, or nil when the request has only been announced
+// and the answer will arrive later through Resume.
+type Channel interface {
+	Ask(ctx context.Context, req Request) (*Response, error)
+}
+
+// ChannelFunc adapts a function to the Channel interface
+type ChannelFunc func(ctx context.Context, req Request) (*Response, error)
+
+// Ask calls f(ctx, req)
+func (f ChannelFunc) Ask(ctx context.Context, req Request) (*Response, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,163 @@
+package human
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// recordNode records that it ran and ends the flow with its action
+type recordNode struct {
+	*agent.BaseNode
+	action string
+}
+
+func (r *recordNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["ran"] = agent.NodeName(r)
+	return r.action
+}
+
+func newRecordNode(name string) *recordNode {
+	n := &recordNode{BaseNode: agent.NewBaseNode(), action: "done"}
+	n.SetName(name)
+	return n
+}
+
+func approvalFlow(channel Channel, store Store) *agent.Flow {
+	approval := NewApprovalNode("approve_email", channel, store, "Send this email?")
+	approval.DataKeys = []string{"draft"}
+	approval.Next(newRecordNode("send"), Approve)
+	approval.Next(newRecordNode("discard"), Reject)
+	return agent.NewFlow(approval)
+}
+
+func TestCLI_DecisionDrivesFlow(t *testing.T) {
+	var out strings.Builder
+	cli := NewCLI(strings.NewReader("maybe\nreject: wrong recipient\napprove\n"), &out)
+	shared := map[string]interface{}{"draft": "Hi Bob"}
+	flow := approvalFlow(cli, NewMemoryStore())
+
+	result := flow.Run(shared)
+
+	if result != "done" || shared["ran"] != "discard" {
+		t.Fatalf("result = %v, ran = %v; want the reject branch", result, shared["ran"])
+	}
+	if shared[DefaultDecisionKey] != Reject || shared[DefaultInputKey] != "wrong recipient" {
+		t.Errorf("decision = %v, input = %v", shared[DefaultDecisionKey], shared[DefaultInputKey])
+	}
+	if !strings.Contains(out.String(), "Please answer one of") {
+		t.Errorf("invalid answer was not rejected: %q", out.String())
+	}
+	// The next question reads on from the same piped input
+	shared = map[string]interface{}{"draft": "Hi Ann"}
+	if flow.Run(shared); shared["ran"] != "send" {
+		t.Errorf("second run ran %v, want the approve branch", shared["ran"])
+	}
+}
+
+func TestChan_SuspendsAndResumes(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := NewChan(1)
+	flow := approvalFlow(ch, store)
+
+	shared := map[string]interface{}{"draft": "Hi Bob", "client": func() {}}
+	result := flow.Run(shared)
+
+	suspension, ok := result.(*agent.Suspension)
+	if !ok {
+		t.Fatalf("Run() = %v, want a suspension", result)
+	}
+	if suspension.Node != "approve_email" {
+		t.Errorf("suspended node = %q", suspension.Node)
+	}
+	if _, ran := shared["ran"]; ran {
+		t.Fatal("flow continued past the approval node")
+	}
+
+	req := <-ch.Requests
+	if req.Prompt != "Send this email?" || req.Data["draft"] != "Hi Bob" {
+		t.Errorf("request = %+v", req)
+	}
+	pending, err := store.List()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("List() = %v, %v; want one pending request", pending, err)
+	}
+	if _, saved := pending[0].Shared["client"]; saved {
+		t.Error("a value that cannot be encoded was persisted")
+	}
+
+	if _, err := Resume(flow, store, Response{RequestID: req.ID, Decision: "later"}, nil); !errors.Is(err, ErrInvalidDecision) {
+		t.Errorf("Resume with an invalid decision error = %v", err)
+	}
+
+	restored := map[string]interface{}{}
+	result, err = Resume(flow, store, Response{RequestID: req.ID, Decision: Approve}, restored)
+	if err != nil {
+		t.Fatalf("Resume error = %v", err)
+	}
+	if result != "done" || restored["ran"] != "send" || restored["draft"] != "Hi Bob" {
+		t.Errorf("result = %v, shared = %v; want the approve branch with restored state", result, restored)
+	}
+	if _, err := store.Load(req.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pending request not deleted after resume: %v", err)
+	}
+}
+
+func TestResume_NestedNode(t *testing.T) {
+	store := NewMemoryStore()
+	ch := NewChan(1)
+	inner := approvalFlow(ch, store)
+	inner.SetName("inner")
+	outer := agent.NewFlow(inner)
+	inner.Next(newRecordNode("notify"), "done")
+
+	result := outer.Run(map[string]interface{}{"draft": "Hi Bob"})
+	if s, ok := result.(*agent.Suspension); !ok || len(s.Path) != 1 || s.Path[0] != "inner" {
+		t.Fatalf("Run() = %+v, want a suspension inside inner", result)
+	}
+	req := <-ch.Requests
+
+	shared := map[string]interface{}{}
+	result, err := Resume(outer, store, Response{RequestID: req.ID, Decision: Reject}, shared)
+	if err != nil {
+		t.Fatalf("Resume error = %v", err)
+	}
+	if result != "done" || shared["ran"] != "notify" || shared[DefaultDecisionKey] != Reject {
+		t.Errorf("result = %v, shared = %v; want the outer flow to finish after the reject branch", result, shared)
+	}
+}
+
+func TestWebhook_PostsRequest(t *testing.T) {
+	var got Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore()
+	hook := Webhook{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	result := approvalFlow(hook, store).Run(map[string]interface{}{"draft": "Hi"})
+
+	if _, ok := result.(*agent.Suspension); !ok {
+		t.Fatalf("Run() = %v, want a suspension", result)
+	}
+	if got.Node != "approve_email" || len(got.Options) != 2 {
+		t.Errorf("webhook received %+v", got)
+	}
+	if _, err := store.Load(got.ID); err != nil {
+		t.Errorf("pending request not saved: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package human
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+)
+
+// Default shared keys written by a HumanInputNode
+const (
+	DefaultDecisionKey = "human_decision"
+	DefaultInputKey    = "human_input"
+)
+
+// Actions of an approval node
+const (
+	Approve = "approve"
+	Reject  = "reject"
+)
+
+// HumanInputNode asks a human for a decision and continues the flow with it
+// as the next action. When the Channel cannot wait for the answer, the node
+// saves the shared state to Store and suspends the flow; Resume continues it.
+type HumanInputNode struct {
+	*agent.BaseNode
+
+	Channel Channel
+	Store   Store
+	// Prompt builds the question from the shared state
+	Prompt func(shared map[string]interface{}) string
+	// Options are the allowed decisions; empty for free-form input, in
+	// which case the flow continues on the "default" action
+	Options []string
+	// DataKeys are shared keys attached to the request for the human to
+	// review, such as a draft email
+	DataKeys []string
+	// PersistKeys limits the shared state saved on suspension. By default
+	// every value that can be encoded as JSON is saved; others, such as
+	// clients, must be supplied again to Resume.
+	PersistKeys []string
+	// DecisionKey and InputKey receive the decision and the free text
+	DecisionKey string
+	InputKey    string
+	// CtxKey optionally names a shared context.Context for the Channel
+	CtxKey string
+}
+
+// NewHumanInputNode creates a HumanInputNode. The name identifies the node
+// when the flow is resumed, so it must be unique within the flow.
+func NewHumanInputNode(name string, channel Channel, store Store, prompt string, options ...string) *HumanInputNode {
+	h := &HumanInputNode{
+		BaseNode:    agent.NewBaseNode(),
+		Channel:     channel,
+		Store:       store,
+		Prompt:      func(map[string]interface{}) string { return prompt },
+		Options:     options,
+		DecisionKey: DefaultDecisionKey,
+		InputKey:    DefaultInputKey,
+	}
+	h.SetName(name)
+	return h
+}
+
+// NewApprovalNode creates a HumanInputNode whose decision is Approve or Reject
+func NewApprovalNode(name string, channel Channel, store Store, prompt string) *HumanInputNode {
+	return NewHumanInputNode(name, channel, store, prompt, Approve, Reject)
+}
+
+type askInput struct {
+	ctx context.Context
+	req Request
+}
+
+type askResult struct {
+	req  Request
+	resp *Response
+	err  error
+}
+
+// Prep builds the request
+func (h *HumanInputNode) Prep(shared map[string]interface{}) interface{} {
+	ctx, ok := shared[h.CtxKey].(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
+	req := Request{
+		ID:        state.NewID(),
+		Node:      agent.NodeName(h),
+		Options:   h.Options,
+		CreatedAt: time.Now(),
+	}
+	if h.Prompt != nil {
+		req.Prompt = h.Prompt(shared)
+	}
+	if len(h.DataKeys) > 0 {
+		req.Data = make(map[string]interface{}, len(h.DataKeys))
+		for _, k := range h.DataKeys {
+			req.Data[k] = shared[k]
+		}
+	}
+	return askInput{ctx: ctx, req: req}
+}
+
+// Exec sends the request to the channel
+func (h *HumanInputNode) Exec(prepRes interface{}) interface{} {
+	in, ok := prepRes.(askInput)
+	if !ok {
+		return askResult{err: fmt.Errorf("human: invalid prep result %T", prepRes)}
+	}
+	resp, err := h.Channel.Ask(in.ctx, in.req)
+	return askResult{req: in.req, resp: resp, err: err}
+}
+
+// Post continues with the decision, or saves the state and suspends the flow
+func (h *HumanInputNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	res, ok := execRes.(askResult)
+	if !ok || res.err != nil {
+		err := res.err
+		if !ok {
+			err = fmt.Errorf("human: invalid exec result %T", execRes)
+		}
+		log.Printf("Warning: human input %s failed: %v", agent.NodeName(h), err)
+		shared["error"] = err.Error()
+		return "error"
+	}
+
+	if res.resp != nil {
+		h.apply(shared, *res.resp)
+		return decisionAction(*res.resp)
+	}
+
+	pending := &Pending{Request: res.req, Shared: h.snapshot(shared)}
+	if err := h.Store.Save(pending); err != nil {
+		log.Printf("Warning: human input %s could not save its state: %v", agent.NodeName(h), err)
+		shared["error"] = err.Error()
+		return "error"
+	}
+	return &agent.Suspension{Node: res.req.Node, Reason: res.req}
+}
+
+func (h *HumanInputNode) apply(shared map[string]interface{}, resp Response) {
+	if h.DecisionKey != "" {
+		shared[h.DecisionKey] = resp.Decision
+	}
+	if h.InputKey != "" {
+		shared[h.InputKey] = resp.Input
+	}
+}
+
+// snapshot returns the part of shared that can be persisted
+func (h *HumanInputNode) snapshot(shared map[string]interface{}) map[string]interface{} {
+	keys := h.PersistKeys
+	if len(keys) == 0 {
+		for k := range shared {
+			keys = append(keys, k)
+		}
+	}
+	selected := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		if v, ok := shared[k]; ok {
+			selected[k] = v
+		}
+	}
+	return state.Encodable(selected)
+}
+
+func decisionAction(resp Response) string {
+	if resp.Decision == "" {
+		return "default"
+	}
+	return resp.Decision
+}
+
+// Resume continues a flow suspended by a HumanInputNode with the human's
+// response. The saved state is merged into shared, which supplies the values
+// that could not be persisted and may be nil. Values restored from a
+// FileStore come back as JSON types: numbers as float64, lists as
+// []interface{} and objects as map[string]interface{}. Resume returns the
+// flow's result, which is another *agent.Suspension if the flow pauses again.
+func Resume(flow *agent.Flow, store Store, resp Response, shared map[string]interface{}) (interface{}, error) {
+	pending, err := store.Load(resp.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := pending.Request.Valid(resp.Decision); err != nil {
+		return nil, fmt.Errorf("%w: %q", err, resp.Decision)
+	}
+	path := pending.Path
+	if len(path) == 0 {
+		path, _ = flow.FindPath(pending.Request.Node)
+	}
+	node := flow.Locate(path, pending.Request.Node)
+	if node == nil {
+		return nil, fmt.Errorf("human: node %q not found in flow (path %v)", pending.Request.Node, path)
+	}
+
+	if shared == nil {
+		shared = make(map[string]interface{})
+	}
+	for k, v := range pending.Shared {
+		shared[k] = v
+	}
+	if h, ok := node.(*HumanInputNode); ok {
+		h.apply(shared, resp)
+	} else {
+		shared[DefaultDecisionKey] = resp.Decision
+		shared[DefaultInputKey] = resp.Input
+	}
+
+	if err := store.Delete(resp.RequestID); err != nil {
+		return nil, err
+	}
+	return flow.ResumeSuspension(shared, &agent.Suspension{Node: pending.Request.Node, Path: path}, decisionAction(resp)), nil
+}
@@ -0,0 +1,156 @@
+package human
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned when no pending request has the given ID
+var ErrNotFound = errors.New("human: pending request not found")
+
+// Pending is a suspended flow waiting for an answer
+type Pending struct {
+	Request Request `json:"request"`
+	// Shared holds the flow's shared state at the time of suspension
+	Shared map[string]interface{} `json:"shared"`
+	// Path names the nested flows enclosing the node, outermost first, as
+	// in agent.Suspension. Resume looks it up by the node's name when it is
+	// empty.
+	Path []string `json:"path,omitempty"`
+}
+
+// Store persists pending requests
+type Store interface {
+	Save(p *Pending) error
+	Load(id string) (*Pending, error)
+	Delete(id string) error
+	List() ([]*Pending, error)
+}
+
+// MemoryStore keeps pending requests in memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	pending map[string]*Pending
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{pending: make(map[string]*Pending)}
+}
+
+// Save implements Store
+func (s *MemoryStore) Save(p *Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[p.Request.ID] = p
+	return nil
+}
+
+// Load implements Store
+func (s *MemoryStore) Load(id string) (*Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return p, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List() ([]*Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Pending, 0, len(s.pending))
+	for _, p := range s.pending {
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// FileStore keeps each pending request as a JSON file in Dir, so that a
+// flow can be resumed by another process or after a restart
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates a FileStore, creating dir if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating pending store: %w", err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, filepath.Base(id)+".json")
+}
+
+// Save implements Store
+func (s *FileStore) Save(p *Pending) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("saving pending request: %w", err)
+	}
+	// Write then rename so a crash never leaves a half-written file
+	tmp := s.path(p.Request.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving pending request: %w", err)
+	}
+	return os.Rename(tmp, s.path(p.Request.ID))
+}
+
+// Load implements Store
+func (s *FileStore) Load(id string) (*Pending, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading pending request: %w", err)
+	}
+	var p Pending
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("loading pending request: %w", err)
+	}
+	return &p, nil
+}
+
+// Delete implements Store
+func (s *FileStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("deleting pending request: %w", err)
+	}
+	return nil
+}
+
+// List implements Store
+func (s *FileStore) List() ([]*Pending, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Pending, 0, len(files))
+	for _, f := range files {
+		id := filepath.Base(f)
+		p, err := s.Load(id[:len(id)-len(".json")])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
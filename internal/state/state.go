@@ -0,0 +1,58 @@
+// Package state holds the helpers the subpackages share for saving and
+// identifying flow runs
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Encodable returns the values of shared that can be encoded as JSON,
+// decoded back so that saved and fresh values look alike. Errors become
+// their messages. Contexts and structs that encode as empty objects, such as
+// clients, are left out.
+func Encodable(shared map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(shared))
+	for k, v := range shared {
+		if _, ok := v.(context.Context); ok {
+			continue
+		}
+		if err, ok := v.(error); ok {
+			out[k] = err.Error()
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil || (string(data) == "{}" && opaque(v)) {
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			continue
+		}
+		out[k] = decoded
+	}
+	return out
+}
+
+// opaque reports whether v is a struct, or a pointer to one
+func opaque(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t != nil && t.Kind() == reflect.Struct
+}
+
+// NewID returns a random 16-digit hex ID for a run, job or request
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
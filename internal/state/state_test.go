@@ -0,0 +1,42 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestEncodable(t *testing.T) {
+	type point struct{ X, Y int }
+	shared := map[string]interface{}{
+		"question": "why",
+		"tags":     []string{"a", "b"},
+		"point":    point{1, 2},
+		"err":      errors.New("boom"),
+		"ctx":      context.Background(),
+		"client":   &http.Client{},
+		"callback": func() {},
+	}
+	out := Encodable(shared)
+
+	if len(out) != 4 {
+		t.Fatalf("Encodable = %v, want question, tags, point and err", out)
+	}
+	if out["question"] != "why" || out["err"] != "boom" {
+		t.Errorf("question = %v, err = %v", out["question"], out["err"])
+	}
+	if tags, ok := out["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Errorf("tags = %#v, want them decoded from JSON", out["tags"])
+	}
+	if p, ok := out["point"].(map[string]interface{}); !ok || p["X"] != 1.0 {
+		t.Errorf("point = %#v, want it decoded from JSON", out["point"])
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 16 || a == b {
+		t.Errorf("NewID = %q, %q, want two different 16-digit IDs", a, b)
+	}
+}
@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrAllModelsFailed is returned when every model of a Fallback chain failed
+var ErrAllModelsFailed = errors.New("llm: all models failed")
+
+// Candidate is one model of a Fallback chain
+type Candidate struct {
+	Name  string
+	Model ChatModel
+}
+
+// Failure is a failed call to one model of a Fallback chain
+type Failure struct {
+	Model string `json:"model"`
+	Error string `json:"error"`
+}
+
+// ErrorClass tells a Fallback chain what to do after an error
+type ErrorClass int
+
+const (
+	// Retry calls the same model again while it has attempts left, then
+	// moves on to the next model
+	Retry ErrorClass = iota
+	// Switch moves on to the next model at once
+	Switch
+	// Stop gives up and returns the error
+	Stop
+)
+
+// Fallback is a ChatModel that tries an ordered list of models. When a model
+// has used up its attempts, or fails with an error that another model may
+// not hit, such as an exhausted quota or a prompt longer than its context
+// window, the next model gets the prompt. The reply records the model that
+// produced it and the failures before it.
+//
+// A node that needs its own list of models gets its own Fallback.
+type Fallback struct {
+	Candidates []Candidate
+	// Attempts is the number of calls made to each model; 1 when unset
+	Attempts int
+	// Wait is the delay between two attempts on the same model
+	Wait time.Duration
+	// Classify decides what to do after an error; nil means ClassifyError
+	Classify func(err error) ErrorClass
+}
+
+// NewFallback creates a Fallback that tries candidates in order, once each
+func NewFallback(candidates ...Candidate) *Fallback {
+	return &Fallback{Candidates: candidates, Attempts: 1}
+}
+
+// Generate implements ChatModel
+func (f *Fallback) Generate(ctx context.Context, prompt string) (*Response, error) {
+	classify := f.Classify
+	if classify == nil {
+		classify = ClassifyError
+	}
+	attempts := max(f.Attempts, 1)
+
+	var failures []Failure
+	var lastErr error
+	for _, c := range f.Candidates {
+	attempts:
+		for attempt := 1; attempt <= attempts; attempt++ {
+			resp, err := c.Model.Generate(ctx, prompt)
+			if err == nil {
+				if resp.Model == "" {
+					resp.Model = c.Name
+				}
+				resp.Fallbacks = append(failures, resp.Fallbacks...)
+				return resp, nil
+			}
+			failures = append(failures, Failure{Model: c.Name, Error: err.Error()})
+			lastErr = err
+
+			switch classify(err) {
+			case Stop:
+				return nil, err
+			case Switch:
+				break attempts
+			}
+			if attempt < attempts && f.Wait > 0 {
+				select {
+				case <-time.After(f.Wait):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("%w: no models configured", ErrAllModelsFailed)
+	}
+	return nil, fmt.Errorf("%w: %d failures, last: %w", ErrAllModelsFailed, len(failures), lastErr)
+}
+
+// ClassifyError stops on cancellation, switches models on quota, rate-limit
+// and context-length errors, and retries anything else. Providers report
+// these errors in different ways, so it looks for the usual wording.
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Stop
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{
+		"quota", "rate limit", "resource_exhausted", "resource exhausted", "429", "too many requests",
+		"context length", "context window", "maximum context", "too many tokens", "token limit", "prompt is too long",
+	} {
+		if strings.Contains(msg, s) {
+			return Switch
+		}
+	}
+	return Retry
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// scripted returns the errors in order, then a reply
+func scripted(calls *int, errs ...error) ChatModel {
+	return ModelFunc(func(ctx context.Context, prompt string) (*Response, error) {
+		*calls++
+		if *calls <= len(errs) {
+			return nil, errs[*calls-1]
+		}
+		return &Response{Text: "ok"}, nil
+	})
+}
+
+func TestFallback_SwitchesOnQuota(t *testing.T) {
+	var primary, secondary int
+	f := NewFallback(
+		Candidate{Name: "pro", Model: scripted(&primary, errors.New("googleapi: Error 429: Resource has been exhausted (e.g. check quota)"))},
+		Candidate{Name: "flash", Model: scripted(&secondary)},
+	)
+	f.Attempts = 3
+
+	resp, err := f.Generate(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary != 1 || secondary != 1 {
+		t.Errorf("calls = %d, %d; want the quota error to switch at once", primary, secondary)
+	}
+	if resp.Model != "flash" || len(resp.Fallbacks) != 1 || resp.Fallbacks[0].Model != "pro" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestFallback_RetriesBeforeSwitching(t *testing.T) {
+	var primary, secondary int
+	flaky := errors.New("connection reset")
+	f := &Fallback{
+		Candidates: []Candidate{
+			{Name: "pro", Model: scripted(&primary, flaky, flaky)},
+			{Name: "flash", Model: scripted(&secondary)},
+		},
+		Attempts: 2,
+	}
+	resp, err := f.Generate(context.Background(), "hi")
+	if err != nil || resp.Model != "flash" || primary != 2 || len(resp.Fallbacks) != 2 {
+		t.Errorf("resp = %+v, err = %v, primary calls = %d", resp, err, primary)
+	}
+}
+
+func TestFallback_AllFail(t *testing.T) {
+	var a, b int
+	f := NewFallback(
+		Candidate{Name: "a", Model: scripted(&a, errors.New("boom"))},
+		Candidate{Name: "b", Model: scripted(&b, context.Canceled)},
+	)
+	if _, err := f.Generate(context.Background(), "hi"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want the cancellation to stop the chain", err)
+	}
+
+	a, b = 0, 0
+	f.Candidates[1].Model = scripted(&b, errors.New("prompt is too long"))
+	if _, err := f.Generate(context.Background(), "hi"); !errors.Is(err, ErrAllModelsFailed) {
+		t.Errorf("error = %v, want ErrAllModelsFailed", err)
+	}
+}
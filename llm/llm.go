@@ -0,0 +1,47 @@
+// Package llm defines a provider-neutral interface for chat models so nodes
+// can be written once and run against Gemini, other providers or fakes.
+package llm
+
+import "context"
+
+// Usage is the token accounting a model reports for one call
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Response is a model's reply to a prompt
+type Response struct {
+	Text string
+	// Model is the name of the model that produced the reply
+	Model string
+	Usage Usage
+	// Fallbacks lists the models of a Fallback chain that failed before
+	// Model answered
+	Fallbacks []Failure
+	// Cached is set when the reply was served from a cache
+	Cached bool
+}
+
+// ChatModel generates a reply to a prompt
+type ChatModel interface {
+	Generate(ctx context.Context, prompt string) (*Response, error)
+}
+
+// ModelFunc adapts a plain function to the ChatModel interface
+type ModelFunc func(ctx context.Context, prompt string) (*Response, error)
+
+// Generate calls f(ctx, prompt)
+func (f ModelFunc) Generate(ctx context.Context, prompt string) (*Response, error) {
+	return f(ctx, prompt)
+}
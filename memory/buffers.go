@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+)
+
+// Buffer is a Memory that keeps every message
+type Buffer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewBuffer creates an empty Buffer
+func NewBuffer() *Buffer {
+	return &Buffer{}
+}
+
+// Append implements Memory
+func (b *Buffer) Append(_ context.Context, msgs ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, msgs...)
+	return nil
+}
+
+// Messages implements Memory
+func (b *Buffer) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message{}, b.messages...)
+}
+
+// Snapshot implements Memory
+func (b *Buffer) Snapshot() Snapshot {
+	return Snapshot{Messages: b.Messages()}
+}
+
+// Restore implements Memory
+func (b *Buffer) Restore(s Snapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append([]Message{}, s.Messages...)
+	if s.Summary != "" {
+		b.messages = append([]Message{summaryMessage(s.Summary)}, b.messages...)
+	}
+}
+
+// Clear implements Memory
+func (b *Buffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = nil
+}
+
+// SlidingWindow is a Memory that keeps the Size most recent messages
+type SlidingWindow struct {
+	Size int
+
+	buf Buffer
+}
+
+// NewSlidingWindow creates a SlidingWindow keeping size messages
+func NewSlidingWindow(size int) *SlidingWindow {
+	return &SlidingWindow{Size: size}
+}
+
+// Append implements Memory. Messages beyond the window are dropped.
+func (w *SlidingWindow) Append(ctx context.Context, msgs ...Message) error {
+	w.buf.Append(ctx, msgs...)
+	w.trim()
+	return nil
+}
+
+// Messages implements Memory
+func (w *SlidingWindow) Messages() []Message {
+	return w.buf.Messages()
+}
+
+// Snapshot implements Memory
+func (w *SlidingWindow) Snapshot() Snapshot {
+	return w.buf.Snapshot()
+}
+
+// Restore implements Memory
+func (w *SlidingWindow) Restore(s Snapshot) {
+	w.buf.Restore(s)
+	w.trim()
+}
+
+// Clear implements Memory
+func (w *SlidingWindow) Clear() {
+	w.buf.Clear()
+}
+
+func (w *SlidingWindow) trim() {
+	w.buf.mu.Lock()
+	defer w.buf.mu.Unlock()
+	if w.Size > 0 && len(w.buf.messages) > w.Size {
+		w.buf.messages = append([]Message{}, w.buf.messages[len(w.buf.messages)-w.Size:]...)
+	}
+}
+
+// SummaryBuffer is a Memory that keeps recent messages verbatim and folds
+// older ones into a running summary once the messages exceed MaxTokens.
+// Messages returns the summary, as a system message, followed by the recent
+// messages.
+type SummaryBuffer struct {
+	// MaxTokens is the budget for the verbatim messages
+	MaxTokens int
+	// Tokenizer counts tokens; the heuristic tokenizer is used when nil
+	Tokenizer contextbudget.Tokenizer
+	// Summarizer condenses the summary and the evicted messages
+	Summarizer contextbudget.SummarizeFunc
+	// KeepRecent is the number of newest messages never summarized
+	// (2 when unset, i.e. the last question and answer)
+	KeepRecent int
+
+	mu       sync.Mutex
+	summary  string
+	messages []Message
+}
+
+// NewSummaryBuffer creates a SummaryBuffer
+func NewSummaryBuffer(maxTokens int, summarizer contextbudget.SummarizeFunc) *SummaryBuffer {
+	return &SummaryBuffer{MaxTokens: maxTokens, Summarizer: summarizer}
+}
+
+// Append implements Memory. When the messages outgrow MaxTokens the oldest
+// are summarized until the rest fit in half the budget. If summarizing fails
+// the messages are kept and the error is returned.
+func (s *SummaryBuffer) Append(ctx context.Context, msgs ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msgs...)
+
+	tok := s.tokenizer()
+	if s.MaxTokens <= 0 || s.Summarizer == nil || countMessages(s.messages, tok) <= s.MaxTokens {
+		return nil
+	}
+
+	keep := s.KeepRecent
+	if keep <= 0 {
+		keep = 2
+	}
+	split := 0
+	for split < len(s.messages)-keep && countMessages(s.messages[split:], tok) > s.MaxTokens/2 {
+		split++
+	}
+	if split == 0 {
+		return nil
+	}
+
+	text := Format(s.messages[:split])
+	if s.summary != "" {
+		text = "Summary so far: " + s.summary + "\n" + text
+	}
+	summary, err := s.Summarizer(ctx, text, s.MaxTokens/2)
+	if err != nil {
+		return fmt.Errorf("summarizing memory: %w", err)
+	}
+	s.summary = summary
+	s.messages = append([]Message{}, s.messages[split:]...)
+	return nil
+}
+
+// Messages implements Memory
+func (s *SummaryBuffer) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := make([]Message, 0, len(s.messages)+1)
+	if s.summary != "" {
+		msgs = append(msgs, summaryMessage(s.summary))
+	}
+	return append(msgs, s.messages...)
+}
+
+// Summary returns the summary of the evicted messages
+func (s *SummaryBuffer) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// Snapshot implements Memory
+func (s *SummaryBuffer) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Snapshot{Summary: s.summary, Messages: append([]Message{}, s.messages...)}
+}
+
+// Restore implements Memory
+func (s *SummaryBuffer) Restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = snap.Summary
+	s.messages = append([]Message{}, snap.Messages...)
+}
+
+// Clear implements Memory
+func (s *SummaryBuffer) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = ""
+	s.messages = nil
+}
+
+func (s *SummaryBuffer) tokenizer() contextbudget.Tokenizer {
+	if s.Tokenizer != nil {
+		return s.Tokenizer
+	}
+	return contextbudget.HeuristicTokenizer{}
+}
+
+func summaryMessage(summary string) Message {
+	return Message{Role: RoleSystem, Content: "Summary of the earlier conversation: " + summary}
+}
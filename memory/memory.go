@@ -0,0 +1,168 @@
+// Package memory keeps the conversation of a multi-turn agent.
+//
+// A Memory is stored in the shared map under SharedKey so that nodes can read
+// the conversation in Prep and record new turns in Post. Buffer keeps every
+// message, SlidingWindow keeps the most recent ones and SummaryBuffer folds
+// old messages into a running summary once the conversation outgrows its
+// token budget. Any Memory can be persisted with Save and restored with Load.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+)
+
+// SharedKey is the key under which nodes find the Memory in the shared map
+const SharedKey = "memory"
+
+// Roles of conversation messages
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string    `json:"role"`
+	Content string    `json:"content"`
+	Time    time.Time `json:"time,omitempty"`
+}
+
+// Snapshot is the persistent state of a Memory
+type Snapshot struct {
+	Summary  string    `json:"summary,omitempty"`
+	Messages []Message `json:"messages"`
+}
+
+// Memory stores the messages of a conversation
+type Memory interface {
+	// Append records messages, compacting the memory if it overflows
+	Append(ctx context.Context, msgs ...Message) error
+	// Messages returns what the model should see of the conversation, oldest
+	// first
+	Messages() []Message
+	// Snapshot returns the state to persist
+	Snapshot() Snapshot
+	// Restore replaces the state with a snapshot
+	Restore(s Snapshot)
+	// Clear forgets the conversation
+	Clear()
+}
+
+// From returns the Memory stored in shared, if any
+func From(shared map[string]interface{}) (Memory, bool) {
+	m, ok := shared[SharedKey].(Memory)
+	return m, ok
+}
+
+// User creates a user message
+func User(content string) Message {
+	return Message{Role: RoleUser, Content: content, Time: time.Now()}
+}
+
+// Assistant creates an assistant message
+func Assistant(content string) Message {
+	return Message{Role: RoleAssistant, Content: content, Time: time.Now()}
+}
+
+// Format renders messages as a transcript for a prompt, one "role: content"
+// entry per message
+func Format(msgs []Message) string {
+	var sb strings.Builder
+	for i, m := range msgs {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s: %s", m.Role, strings.TrimSpace(m.Content))
+	}
+	return sb.String()
+}
+
+// Window returns the newest messages whose formatted size fits in maxTokens.
+// A leading system message, such as a summary, is always kept.
+func Window(msgs []Message, maxTokens int, tok contextbudget.Tokenizer) []Message {
+	if tok == nil {
+		tok = contextbudget.HeuristicTokenizer{}
+	}
+	var head []Message
+	if len(msgs) > 0 && msgs[0].Role == RoleSystem {
+		head, msgs = msgs[:1], msgs[1:]
+		maxTokens -= countMessages(head, tok)
+	}
+
+	start := len(msgs)
+	used := 0
+	for start > 0 {
+		n := countMessages(msgs[start-1:start], tok)
+		if used+n > maxTokens {
+			break
+		}
+		used += n
+		start--
+	}
+	return append(append([]Message{}, head...), msgs[start:]...)
+}
+
+func countMessages(msgs []Message, tok contextbudget.Tokenizer) int {
+	total := 0
+	for _, m := range msgs {
+		total += tok.Count(m.Role + ": " + m.Content)
+	}
+	return total
+}
+
+// Save writes a Memory's snapshot as JSON
+func Save(m Memory, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m.Snapshot()); err != nil {
+		return fmt.Errorf("saving memory: %w", err)
+	}
+	return nil
+}
+
+// Load restores a Memory from JSON written by Save
+func Load(m Memory, r io.Reader) error {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("loading memory: %w", err)
+	}
+	m.Restore(s)
+	return nil
+}
+
+// SaveFile saves a Memory to path
+func SaveFile(m Memory, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saving memory: %w", err)
+	}
+	if err := Save(m, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile restores a Memory from path. A missing file leaves the memory
+// empty and is not an error, so a new session can start from a path that
+// does not exist yet.
+func LoadFile(m Memory, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading memory: %w", err)
+	}
+	defer f.Close()
+	return Load(m, f)
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+)
+
+// wordTokenizer counts one token per word
+var wordTokenizer = contextbudget.TokenizerFunc(func(text string) int {
+	return len(strings.Fields(text))
+})
+
+func TestSlidingWindow_KeepsNewest(t *testing.T) {
+	w := NewSlidingWindow(2)
+	w.Append(context.Background(), User("one"), Assistant("two"), User("three"))
+
+	got := w.Messages()
+	if len(got) != 2 || got[0].Content != "two" || got[1].Content != "three" {
+		t.Errorf("Messages() = %+v, want [two three]", got)
+	}
+}
+
+func TestSummaryBuffer_SummarizesOnOverflow(t *testing.T) {
+	var summarized []string
+	s := NewSummaryBuffer(12, func(_ context.Context, text string, maxTokens int) (string, error) {
+		summarized = append(summarized, text)
+		return "talked about bees", nil
+	})
+	s.Tokenizer = wordTokenizer
+	ctx := context.Background()
+
+	s.Append(ctx, User("what do bees eat"), Assistant("nectar and pollen"))
+	if len(summarized) != 0 {
+		t.Fatalf("summarized before overflow: %v", summarized)
+	}
+
+	s.Append(ctx, User("and what do wasps eat"), Assistant("mostly other insects"))
+	if len(summarized) != 1 || !strings.Contains(summarized[0], "user: what do bees eat") {
+		t.Fatalf("summarized = %v, want the first exchange", summarized)
+	}
+
+	got := s.Messages()
+	if len(got) != 3 || got[0].Role != RoleSystem || !strings.Contains(got[0].Content, "talked about bees") {
+		t.Fatalf("Messages() = %+v, want summary followed by the last exchange", got)
+	}
+	if got[2].Content != "mostly other insects" {
+		t.Errorf("last message = %q", got[2].Content)
+	}
+}
+
+func TestSummaryBuffer_KeepsMessagesWhenSummarizerFails(t *testing.T) {
+	s := NewSummaryBuffer(4, func(context.Context, string, int) (string, error) {
+		return "", errors.New("model unavailable")
+	})
+	s.Tokenizer = wordTokenizer
+
+	err := s.Append(context.Background(), User("a b c"), Assistant("d e f"), User("g h i"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := s.Messages(); len(got) != 3 {
+		t.Errorf("kept %d messages, want 3", len(got))
+	}
+}
+
+func TestWindow_FitsNewestAndKeepsSummary(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "summary"},
+		User("one two three"),
+		Assistant("four five"),
+		User("six"),
+	}
+	got := Window(msgs, 7, wordTokenizer)
+	if len(got) != 3 || got[0].Role != RoleSystem || got[1].Content != "four five" {
+		t.Errorf("Window() = %+v", got)
+	}
+}
+
+func TestSaveLoad_RoundTrip(t *testing.T) {
+	s := NewSummaryBuffer(100, nil)
+	s.Restore(Snapshot{Summary: "earlier", Messages: []Message{User("hi"), Assistant("hello")}})
+
+	var buf bytes.Buffer
+	if err := Save(s, &buf); err != nil {
+		t.Fatalf("Save error = %v", err)
+	}
+	loaded := NewSummaryBuffer(100, nil)
+	if err := Load(loaded, &buf); err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if loaded.Summary() != "earlier" || len(loaded.Messages()) != 3 {
+		t.Errorf("loaded summary %q with %d messages", loaded.Summary(), len(loaded.Messages()))
+	}
+
+	path := filepath.Join(t.TempDir(), "memory.json")
+	b := NewBuffer()
+	if err := LoadFile(b, path); err != nil {
+		t.Fatalf("LoadFile on a missing file error = %v", err)
+	}
+	b.Append(context.Background(), User("remember me"))
+	if err := SaveFile(b, path); err != nil {
+		t.Fatalf("SaveFile error = %v", err)
+	}
+	restored := NewBuffer()
+	if err := LoadFile(restored, path); err != nil {
+		t.Fatalf("LoadFile error = %v", err)
+	}
+	if got := restored.Messages(); len(got) != 1 || got[0].Content != "remember me" {
+		t.Errorf("restored = %+v", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format([]Message{User(" hi "), Assistant("hello")})
+	if got != "user: hi\nassistant: hello" {
+		t.Errorf("Format() = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package prompt
+
+import (
+	"strings"
+	"text/template"
+)
+
+// backticks is a Markdown code fence. It cannot appear in Go raw strings,
+// which is why prompts used to be stitched together around it.
+const backticks = "```"
+
+// Funcs returns the helper functions available to every template:
+//
+//	fence "yaml"      opening code fence with a language tag ("```yaml")
+//	fence ""          bare code fence, used to close a block
+//	escapeFences .X   neutralises code fences inside untrusted text
+//	indent 2 .X       indents every line of text by n spaces
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"fence":        Fence,
+		"escapeFences": EscapeFences,
+		"indent":       Indent,
+	}
+}
+
+// Fence returns a Markdown code fence tagged with lang
+func Fence(lang string) string {
+	return backticks + lang
+}
+
+// EscapeFences breaks up code fences in text so that content pasted into a
+// prompt (search results, user input) cannot close or open a fenced block
+func EscapeFences(text string) string {
+	return strings.ReplaceAll(text, backticks, "` ` `")
+}
+
+// Indent prefixes every non-empty line of text with n spaces
+func Indent(n int, text string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
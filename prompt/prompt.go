@@ -0,0 +1,275 @@
+// Package prompt renders named, versioned prompt templates built on text/template.
+//
+// Templates are loaded from a filesystem (usually an embed.FS). Each file named
+// <name>.v<version>.tmpl in the root directory is a template, and every file in
+// the partials subdirectory is made available to all templates under its base
+// name, e.g. {{template "action_space" .}}.
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// partialsDir is the subdirectory holding shared template sections
+const partialsDir = "partials"
+
+// templateFile matches template file names such as "decide_action.v2.tmpl"
+var templateFile = regexp.MustCompile(`^([A-Za-z0-9_\-]+)\.v([0-9]+)\.tmpl$`)
+
+// Template is a single named and versioned prompt template
+type Template struct {
+	Name    string
+	Version int
+	tmpl    *template.Template
+	vars    []string
+}
+
+// Variables returns the top-level variables the template references, sorted
+func (t *Template) Variables() []string {
+	return append([]string(nil), t.vars...)
+}
+
+// Render executes the template with vars. It fails if any variable the
+// template references is missing from vars.
+func (t *Template) Render(vars map[string]interface{}) (string, error) {
+	var missing []string
+	for _, v := range t.vars {
+		if _, ok := vars[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("prompt %s.v%d: missing variables: %s", t.Name, t.Version, strings.Join(missing, ", "))
+	}
+
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, vars); err != nil {
+		return "", fmt.Errorf("prompt %s.v%d: %w", t.Name, t.Version, err)
+	}
+	return sb.String(), nil
+}
+
+// Registry holds templates keyed by name and version
+type Registry struct {
+	partials  map[string]string
+	templates map[string]map[int]*Template
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		partials:  make(map[string]string),
+		templates: make(map[string]map[int]*Template),
+	}
+}
+
+// Load reads all templates and partials under dir in fsys
+func Load(fsys fs.FS, dir string) (*Registry, error) {
+	r := NewRegistry()
+
+	partials, err := fs.Glob(fsys, path.Join(dir, partialsDir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range partials {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("reading partial %s: %w", p, err)
+		}
+		r.AddPartial(strings.TrimSuffix(path.Base(p), ".tmpl"), string(data))
+	}
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := templateFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[2])
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading template %s: %w", e.Name(), err)
+		}
+		if _, err := r.Add(m[1], version, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// MustLoad is like Load but panics on error. It is intended for templates
+// embedded in the binary, where a failure is a programming error.
+func MustLoad(fsys fs.FS, dir string) *Registry {
+	r, err := Load(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// AddPartial registers a shared section. Partials must be added before the
+// templates that use them.
+func (r *Registry) AddPartial(name string, text string) {
+	r.partials[name] = text
+}
+
+// Add parses text as version of the named template and registers it
+func (r *Registry) Add(name string, version int, text string) (*Template, error) {
+	tmpl := template.New(name).Funcs(Funcs()).Option("missingkey=error")
+	for pname, ptext := range r.partials {
+		if _, err := tmpl.New(pname).Parse(ptext); err != nil {
+			return nil, fmt.Errorf("parsing partial %s: %w", pname, err)
+		}
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return nil, fmt.Errorf("parsing prompt %s.v%d: %w", name, version, err)
+	}
+
+	t := &Template{
+		Name:    name,
+		Version: version,
+		tmpl:    tmpl,
+		vars:    variables(tmpl),
+	}
+	if r.templates[name] == nil {
+		r.templates[name] = make(map[int]*Template)
+	}
+	r.templates[name][version] = t
+	return t, nil
+}
+
+// Get returns the requested version of a template, or the latest version
+// when version is 0
+func (r *Registry) Get(name string, version int) (*Template, error) {
+	versions, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("prompt %q not found", name)
+	}
+	if version == 0 {
+		for v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("prompt %s.v%d not found", name, version)
+	}
+	return t, nil
+}
+
+// Versions lists the available versions of a template in ascending order
+func (r *Registry) Versions(name string) []int {
+	var out []int
+	for v := range r.templates[name] {
+		out = append(out, v)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// Render renders the latest version of the named template
+func (r *Registry) Render(name string, vars map[string]interface{}) (string, error) {
+	return r.RenderVersion(name, 0, vars)
+}
+
+// RenderVersion renders a specific version of the named template
+func (r *Registry) RenderVersion(name string, version int, vars map[string]interface{}) (string, error) {
+	t, err := r.Get(name, version)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(vars)
+}
+
+// variables collects the top-level fields referenced by tmpl, following
+// {{template}} calls that pass the root context along
+func variables(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var walk func(node parse.Node, root bool)
+	walkTree := func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		if t := tmpl.Lookup(name); t != nil && t.Tree != nil {
+			walk(t.Tree.Root, true)
+		}
+	}
+	walkPipe := func(pipe *parse.PipeNode, root bool) {
+		if pipe == nil || !root {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				walk(arg, root)
+			}
+		}
+	}
+	walk = func(node parse.Node, root bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, root)
+			}
+		case *parse.ActionNode:
+			walkPipe(n.Pipe, root)
+		case *parse.FieldNode:
+			if root && len(n.Ident) > 0 {
+				seen[n.Ident[0]] = true
+			}
+		case *parse.ChainNode:
+			walk(n.Node, root)
+		case *parse.PipeNode:
+			walkPipe(n, root)
+		case *parse.IfNode:
+			walkPipe(n.Pipe, root)
+			walk(n.List, root)
+			walk(n.ElseList, root)
+		case *parse.RangeNode:
+			// Inside range and with the dot changes, so only the pipeline
+			// itself refers to top-level variables.
+			walkPipe(n.Pipe, root)
+			walk(n.ElseList, root)
+		case *parse.WithNode:
+			walkPipe(n.Pipe, root)
+			walk(n.ElseList, root)
+		case *parse.TemplateNode:
+			if n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+				if _, isDot := n.Pipe.Cmds[0].Args[0].(*parse.DotNode); isDot && root {
+					walkTree(n.Name)
+					return
+				}
+			}
+			walkPipe(n.Pipe, root)
+		}
+	}
+	walkTree(tmpl.Name())
+
+	vars := make([]string, 0, len(seen))
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars
+}
@@ -0,0 +1,87 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"prompts/partials/rules.tmpl": {Data: []byte("Rules for {{.Question}}")},
+		"prompts/ask.v1.tmpl":         {Data: []byte("Q: {{.Question}}")},
+		"prompts/ask.v2.tmpl":         {Data: []byte("{{template \"rules\" .}}\n{{fence \"yaml\"}}\n{{escapeFences .Context}}\n{{fence \"\"}}")},
+		"prompts/README.md":           {Data: []byte("not a template")},
+	}
+}
+
+func TestLoad_Versions(t *testing.T) {
+	r, err := Load(testFS(), "prompts")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if got := r.Versions("ask"); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("Expected versions [1 2], got %v", got)
+	}
+
+	out, err := r.RenderVersion("ask", 1, map[string]interface{}{"Question": "why?"})
+	if err != nil {
+		t.Fatalf("RenderVersion failed: %v", err)
+	}
+	if out != "Q: why?" {
+		t.Fatalf("Unexpected v1 output: %q", out)
+	}
+
+	if _, err := r.Get("missing", 0); err == nil {
+		t.Fatalf("Expected error for unknown template")
+	}
+}
+
+func TestRender_LatestWithPartialAndFences(t *testing.T) {
+	r := MustLoad(testFS(), "prompts")
+
+	out, err := r.Render("ask", map[string]interface{}{
+		"Question": "why?",
+		"Context":  "see ```code```",
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	expected := "Rules for why?\n```yaml\nsee ` ` `code` ` `\n```"
+	if out != expected {
+		t.Fatalf("Unexpected output:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestRender_MissingVariables(t *testing.T) {
+	r := MustLoad(testFS(), "prompts")
+
+	tmpl, _ := r.Get("ask", 2)
+	if vars := tmpl.Variables(); strings.Join(vars, ",") != "Context,Question" {
+		t.Fatalf("Expected variables [Context Question] (including partial), got %v", vars)
+	}
+
+	_, err := r.Render("ask", map[string]interface{}{"Question": "why?"})
+	if err == nil || !strings.Contains(err.Error(), "missing variables: Context") {
+		t.Fatalf("Expected missing variable error, got %v", err)
+	}
+}
+
+func TestVariables_IgnoresRangeScope(t *testing.T) {
+	r := NewRegistry()
+	tmpl, err := r.Add("list", 1, "{{range .Items}}{{.Title}}{{end}}{{with .Extra}}{{.Inner}}{{end}}")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if vars := tmpl.Variables(); strings.Join(vars, ",") != "Extra,Items" {
+		t.Fatalf("Expected [Extra Items], got %v", vars)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	if got := Indent(2, "a\n\nb"); got != "  a\n\n  b" {
+		t.Fatalf("Unexpected indent output: %q", got)
+	}
+}
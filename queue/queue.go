@@ -0,0 +1,379 @@
+// Package queue runs many flow instances as jobs: runs are submitted with
+// their shared input, and workers pull and execute them with a concurrency
+// limit, retry failed runs with backoff and move runs that keep failing to
+// a dead-letter state.
+//
+// Jobs are kept in a Backend, which persists their status. OpenStore keeps
+// them in a directory of JSON files and NewMemoryStore in memory; other
+// backends, such as Redis, implement the same interface. A job whose worker
+// died is claimed again once its lease expires.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+)
+
+var (
+	// ErrEmpty is returned by Claim when no job is ready
+	ErrEmpty = errors.New("queue: no job ready")
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("queue: job not found")
+	// ErrUnknownFlow is returned when submitting a job for a flow that is
+	// not registered
+	ErrUnknownFlow = errors.New("queue: unknown flow")
+	// ErrLeaseLost is returned by Save when another worker claimed the job
+	// after the saving worker's lease expired
+	ErrLeaseLost = errors.New("queue: lease lost")
+)
+
+// Status is the state of a job
+type Status string
+
+// Job statuses
+const (
+	// Pending jobs wait for a worker, possibly until RunAt
+	Pending Status = "pending"
+	// Running jobs are held by a worker until LeaseUntil
+	Running Status = "running"
+	// Succeeded jobs completed their flow
+	Succeeded Status = "succeeded"
+	// Suspended jobs stopped at a node waiting for input
+	Suspended Status = "suspended"
+	// Dead jobs failed on every attempt; they stay until Requeue
+	Dead Status = "dead"
+)
+
+// Job is one run of a flow
+type Job struct {
+	ID     string                 `json:"id"`
+	Flow   string                 `json:"flow"`
+	Input  map[string]interface{} `json:"input"`
+	Status Status                 `json:"status"`
+	// Attempts counts the runs started so far
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"max_attempts"`
+	// Action is the final action of the last run
+	Action string `json:"action,omitempty"`
+	// Error describes the last failure
+	Error string `json:"error,omitempty"`
+	// Output is the final shared state of a finished run, without values
+	// that cannot be encoded as JSON
+	Output     map[string]interface{} `json:"output,omitempty"`
+	Worker     string                 `json:"worker,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	RunAt      time.Time              `json:"run_at"`
+	LeaseUntil time.Time              `json:"lease_until,omitempty"`
+}
+
+// Backend stores jobs. Implementations must be safe for concurrent use and
+// must hand a job to one worker at a time.
+type Backend interface {
+	// Add stores a new job
+	Add(ctx context.Context, job *Job) error
+	// Claim marks the next ready job as Running, held by worker until now
+	// plus lease, and returns it. A job is ready when it is Pending and its
+	// RunAt has passed, or Running with an expired lease. Claim counts the
+	// run in Attempts before storing the job, so that a run whose worker
+	// dies still counts. It returns ErrEmpty when no job is ready.
+	Claim(ctx context.Context, worker string, lease time.Duration) (*Job, error)
+	// Save stores the new state of a job. It returns ErrLeaseLost when the
+	// stored job is Running and held by another worker than job.Worker.
+	Save(ctx context.Context, job *Job) error
+	// Get returns the job with the given ID
+	Get(ctx context.Context, id string) (*Job, error)
+	// List returns the jobs with the given status, or all jobs when status
+	// is empty, oldest first
+	List(ctx context.Context, status Status) ([]*Job, error)
+}
+
+const (
+	// DefaultMaxAttempts is the number of runs of a job before it is dead
+	DefaultMaxAttempts = 3
+	// DefaultBackoff is the delay before the first retry; it doubles with
+	// every retry
+	DefaultBackoff = 10 * time.Second
+	// DefaultLease is how long a worker may hold a job before other workers
+	// consider it abandoned
+	DefaultLease = 30 * time.Minute
+	// DefaultPoll is how often idle workers look for jobs
+	DefaultPoll = time.Second
+)
+
+// Queue submits jobs to a Backend and runs them with workers
+type Queue struct {
+	Backend Backend
+	// Concurrency is the number of workers started by Work; 1 when unset
+	Concurrency int
+	// MaxAttempts is the default number of runs of a job
+	MaxAttempts int
+	// Backoff is the delay before the first retry of a job
+	Backoff time.Duration
+	// Lease is how long a worker may hold a job
+	Lease time.Duration
+	// Poll is how often idle workers look for jobs
+	Poll time.Duration
+	// Prepare, when set, is called before every run to add values that
+	// cannot be stored as JSON, such as LLM clients, to the shared input.
+	// An error fails the attempt.
+	Prepare func(ctx context.Context, flow string, shared map[string]interface{}) error
+	// ContextKey names the shared key that receives the run's context
+	ContextKey string
+	// Name identifies this process in the jobs it claims
+	Name string
+
+	mu    sync.Mutex
+	flows map[string]func() *agent.Flow
+}
+
+// New creates a Queue over backend with the default settings
+func New(backend Backend) *Queue {
+	return &Queue{
+		Backend:     backend,
+		Concurrency: 1,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		Lease:       DefaultLease,
+		Poll:        DefaultPoll,
+		ContextKey:  "ctx",
+		Name:        state.NewID()[:8],
+		flows:       make(map[string]func() *agent.Flow),
+	}
+}
+
+// Register makes a flow available to jobs under name. factory must return
+// fresh nodes on every call, since workers run flows concurrently.
+func (q *Queue) Register(name string, factory func() *agent.Flow) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.flows[name] = factory
+}
+
+func (q *Queue) factory(name string) (func() *agent.Flow, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, ok := q.flows[name]
+	return f, ok
+}
+
+// Submit adds a job running the flow registered under flow with input as
+// its shared state. input must be encodable as JSON.
+func (q *Queue) Submit(ctx context.Context, flow string, input map[string]interface{}) (*Job, error) {
+	if _, ok := q.factory(flow); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFlow, flow)
+	}
+	if _, err := json.Marshal(input); err != nil {
+		return nil, fmt.Errorf("queue: input of %s is not JSON: %w", flow, err)
+	}
+	now := time.Now()
+	job := &Job{
+		ID:          state.NewID(),
+		Flow:        flow,
+		Input:       input,
+		Status:      Pending,
+		MaxAttempts: max(q.MaxAttempts, 1),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		RunAt:       now,
+	}
+	if err := q.Backend.Add(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Requeue makes a dead or finished job pending again with a fresh set of
+// attempts, for example after the cause of its failures was fixed
+func (q *Queue) Requeue(ctx context.Context, id string) (*Job, error) {
+	job, err := q.Backend.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == Pending || job.Status == Running {
+		return nil, fmt.Errorf("queue: job %s is %s", id, job.Status)
+	}
+	job.Status = Pending
+	job.Attempts = 0
+	job.Error = ""
+	job.Worker = ""
+	job.RunAt = time.Now()
+	job.UpdatedAt = job.RunAt
+	if err := q.Backend.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Work runs workers until ctx is canceled, then waits for the jobs they hold
+// to finish. Their flows see the cancellation through the run's context.
+func (q *Queue) Work(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(q.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			q.worker(ctx, worker)
+		}(fmt.Sprintf("%s-%d", q.Name, i+1))
+	}
+	wg.Wait()
+}
+
+func (q *Queue) worker(ctx context.Context, name string) {
+	poll := q.Poll
+	if poll <= 0 {
+		poll = DefaultPoll
+	}
+	for ctx.Err() == nil {
+		ran, err := q.RunNext(ctx, name)
+		if err != nil {
+			log.Printf("Warning: queue worker %s: %v", name, err)
+		}
+		if ran {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(poll):
+		}
+	}
+}
+
+// RunNext claims one ready job for worker and runs it. It reports false when
+// no job was ready.
+func (q *Queue) RunNext(ctx context.Context, worker string) (bool, error) {
+	lease := q.Lease
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	job, err := q.Backend.Claim(ctx, worker, lease)
+	if errors.Is(err, ErrEmpty) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Workers that died running the job used up its attempts
+	if job.Attempts > job.MaxAttempts {
+		job.Status, job.Error = Dead, "worker stopped during the last attempt"
+		job.UpdatedAt, job.LeaseUntil = time.Now(), time.Time{}
+		if err := q.Backend.Save(ctx, job); err != nil {
+			return true, fmt.Errorf("saving job %s: %w", job.ID, err)
+		}
+		return true, nil
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	release := q.holdLease(runCtx, cancel, job, lease)
+	action, output, runErr := q.execute(runCtx, job)
+	release()
+	cancel()
+	now := time.Now()
+	job.Action, job.Output, job.UpdatedAt = action, output, now
+	job.LeaseUntil = time.Time{}
+	switch {
+	case runErr == nil && action == "suspended":
+		job.Status, job.Error = Suspended, ""
+	case runErr == nil:
+		job.Status, job.Error = Succeeded, ""
+	case job.Attempts < job.MaxAttempts:
+		job.Status, job.Error = Pending, runErr.Error()
+		job.RunAt = now.Add(q.backoff(job.Attempts))
+	default:
+		job.Status, job.Error = Dead, runErr.Error()
+	}
+	// Record the outcome even when ctx was canceled during the run
+	if err := q.Backend.Save(context.WithoutCancel(ctx), job); err != nil {
+		return true, fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	return true, nil
+}
+
+// holdLease renews the lease on job every third of lease until the returned
+// function is called, so that a long run is not claimed by other workers.
+// When the lease was lost anyway, it cancels the run through cancel.
+func (q *Queue) holdLease(ctx context.Context, cancel context.CancelFunc, job *Job, lease time.Duration) (release func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(max(lease/3, time.Millisecond))
+		defer ticker.Stop()
+		renewed := copyJob(job)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed.LeaseUntil = time.Now().Add(lease)
+			renewed.UpdatedAt = time.Now()
+			err := q.Backend.Save(ctx, renewed)
+			if errors.Is(err, ErrLeaseLost) {
+				log.Printf("Warning: queue worker %s lost job %s: %v", job.Worker, job.ID, err)
+				cancel()
+				return
+			}
+			if err != nil {
+				log.Printf("Warning: renewing the lease on job %s: %v", job.ID, err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// backoff returns the delay before the retry that follows attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.Backoff
+	if d <= 0 {
+		return 0
+	}
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return d
+}
+
+// execute runs a job's flow once and returns its final action, its
+// encodable shared state and why it failed, if it did
+func (q *Queue) execute(ctx context.Context, job *Job) (action string, output map[string]interface{}, err error) {
+	factory, ok := q.factory(job.Flow)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownFlow, job.Flow)
+	}
+	shared := make(map[string]interface{}, len(job.Input)+1)
+	for k, v := range job.Input {
+		shared[k] = v
+	}
+	if q.ContextKey != "" {
+		shared[q.ContextKey] = ctx
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("flow panicked: %v", r)
+		}
+		output = state.Encodable(shared)
+	}()
+	if q.Prepare != nil {
+		if err := q.Prepare(ctx, job.Flow, shared); err != nil {
+			return "", nil, fmt.Errorf("preparing run: %w", err)
+		}
+	}
+
+	action, err = agent.Outcome(factory().Run(shared), shared)
+	return action, nil, err
+}
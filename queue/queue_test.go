@@ -0,0 +1,303 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// answerNode fails its first failures runs, then answers the question
+type answerNode struct {
+	*agent.Node
+	failures *atomic.Int32
+}
+
+func (n *answerNode) Prep(shared map[string]interface{}) interface{} {
+	return shared["question"]
+}
+
+func (n *answerNode) Exec(prepRes interface{}) interface{} {
+	if n.failures != nil && n.failures.Add(-1) >= 0 {
+		return errors.New("model unavailable")
+	}
+	return "answer to " + prepRes.(string)
+}
+
+func (n *answerNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if err, ok := execRes.(error); ok {
+		shared["error"] = err.Error()
+		return "error"
+	}
+	shared["answer"] = execRes
+	return "done"
+}
+
+func newQueue(t *testing.T, backend Backend, failures int32) *Queue {
+	t.Helper()
+	remaining := &atomic.Int32{}
+	remaining.Store(failures)
+	q := New(backend)
+	q.Backoff = 0
+	q.Register("answer", func() *agent.Flow {
+		return agent.NewFlow(&answerNode{Node: agent.NewNode(1, 0), failures: remaining})
+	})
+	return q
+}
+
+func TestQueue_RunsJob(t *testing.T) {
+	ctx := context.Background()
+	q := newQueue(t, NewMemoryStore(), 0)
+
+	if _, err := q.Submit(ctx, "missing", nil); !errors.Is(err, ErrUnknownFlow) {
+		t.Fatalf("Submit of an unknown flow = %v, want ErrUnknownFlow", err)
+	}
+	job, err := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := q.RunNext(ctx, "w1"); !ran || err != nil {
+		t.Fatalf("RunNext = %v, %v, want a job", ran, err)
+	}
+	if ran, _ := q.RunNext(ctx, "w1"); ran {
+		t.Fatal("RunNext ran a job twice")
+	}
+
+	job, err = q.Backend.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != Succeeded || job.Action != "done" || job.Attempts != 1 {
+		t.Fatalf("job = %s after %d attempts with action %q, want succeeded", job.Status, job.Attempts, job.Action)
+	}
+	if job.Output["answer"] != "answer to why" {
+		t.Fatalf("output = %v, want the answer", job.Output)
+	}
+	if _, ok := job.Output["ctx"]; ok {
+		t.Fatal("output kept the run's context")
+	}
+}
+
+func TestQueue_RetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	q := newQueue(t, NewMemoryStore(), 5)
+	q.MaxAttempts = 2
+
+	job, err := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for mustRun(t, q) {
+	}
+	job, _ = q.Backend.Get(ctx, job.ID)
+	if job.Status != Dead || job.Attempts != 2 || job.Error != "model unavailable" {
+		t.Fatalf("job = %s after %d attempts (%q), want dead after 2", job.Status, job.Attempts, job.Error)
+	}
+	if dead, _ := q.Backend.List(ctx, Dead); len(dead) != 1 {
+		t.Fatalf("List(Dead) = %d jobs, want 1", len(dead))
+	}
+
+	// Three failures are left: the first requeue uses two of them, the
+	// second fails once and then succeeds on its retry
+	if _, err := q.Requeue(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Requeue(ctx, job.ID); err == nil {
+		t.Fatal("Requeue accepted a pending job")
+	}
+	q.MaxAttempts = 5
+	for mustRun(t, q) {
+	}
+	job, _ = q.Backend.Get(ctx, job.ID)
+	if job.Status != Dead {
+		t.Fatalf("job = %s, want dead since its MaxAttempts was set on submit", job.Status)
+	}
+	q.Requeue(ctx, job.ID)
+	for mustRun(t, q) {
+	}
+	job, _ = q.Backend.Get(ctx, job.ID)
+	if job.Status != Succeeded || job.Attempts != 2 {
+		t.Fatalf("job = %s after %d attempts, want succeeded after 2", job.Status, job.Attempts)
+	}
+}
+
+func mustRun(t *testing.T, q *Queue) bool {
+	t.Helper()
+	ran, err := q.RunNext(context.Background(), "w1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ran
+}
+
+func TestQueue_BackoffDelaysRetry(t *testing.T) {
+	ctx := context.Background()
+	q := newQueue(t, NewMemoryStore(), 1)
+	q.Backoff = time.Hour
+
+	job, _ := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"})
+	mustRun(t, q)
+	if mustRun(t, q) {
+		t.Fatal("retry ran before its backoff elapsed")
+	}
+	job, _ = q.Backend.Get(ctx, job.ID)
+	if job.Status != Pending || time.Until(job.RunAt) < 59*time.Minute {
+		t.Fatalf("job = %s at %v, want pending for an hour", job.Status, job.RunAt)
+	}
+}
+
+func TestStore_PersistsAndReclaimsLeases(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newQueue(t, store, 0)
+	job, err := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A worker claims the job and dies
+	if _, err := store.Claim(ctx, "dead-worker", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != Running || got.Worker != "dead-worker" || got.Input["question"] != "why" {
+		t.Fatalf("reopened job = %+v", got)
+	}
+	if _, err := store.Claim(ctx, "w2", time.Minute); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("Claim of a leased job = %v, want ErrEmpty", err)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	got, err = store.Claim(ctx, "w2", time.Minute)
+	if err != nil {
+		t.Fatalf("Claim after the lease expired = %v", err)
+	}
+	if got.ID != job.ID || got.Worker != "w2" || got.Attempts != 2 {
+		t.Fatalf("Claim = %+v, want the abandoned job on its second attempt", got)
+	}
+	if got, _ = store.Get(ctx, job.ID); got.Attempts != 2 {
+		t.Fatalf("stored attempts = %d, want 2 counted by Claim", got.Attempts)
+	}
+
+	// A job whose workers keep dying is dead once it used up its attempts
+	store.now = func() time.Time { return time.Now().Add(4 * time.Minute) }
+	if _, err := store.Claim(ctx, "w3", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	q.Backend = store
+	store.now = func() time.Time { return time.Now().Add(6 * time.Minute) }
+	if ran, err := q.RunNext(ctx, "w4"); !ran || err != nil {
+		t.Fatalf("RunNext = %v, %v", ran, err)
+	}
+	if got, _ = store.Get(ctx, job.ID); got.Status != Dead || got.Attempts != 4 {
+		t.Fatalf("job = %+v, want dead after 4 claims", got)
+	}
+}
+
+func TestQueue_HoldsLeases(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	q := newQueue(t, store, 0)
+	q.Lease = 30 * time.Millisecond
+	var claimErr error
+	q.Prepare = func(ctx context.Context, flow string, shared map[string]interface{}) error {
+		time.Sleep(100 * time.Millisecond)
+		_, claimErr = store.Claim(ctx, "other", q.Lease)
+		return nil
+	}
+	job, err := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := q.RunNext(ctx, "w1"); !ran || err != nil {
+		t.Fatalf("RunNext = %v, %v", ran, err)
+	}
+	if !errors.Is(claimErr, ErrEmpty) {
+		t.Fatalf("Claim during a long run = %v, want ErrEmpty while the lease is renewed", claimErr)
+	}
+	if job, _ = store.Get(ctx, job.ID); job.Status != Succeeded {
+		t.Fatalf("job = %+v, want succeeded", job)
+	}
+
+	// A worker whose lease expired cannot save over the next worker's run
+	job, _ = q.Submit(ctx, "answer", map[string]interface{}{"question": "how"})
+	stale, err := store.Claim(ctx, "w1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := store.Claim(ctx, "w2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	stale.Status = Succeeded
+	if err := store.Save(ctx, stale); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Save by the old worker = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestQueue_Work(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewMemoryStore()
+	q := newQueue(t, store, 0)
+	q.Concurrency = 4
+	q.Poll = time.Millisecond
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	q.Prepare = func(ctx context.Context, flow string, shared map[string]interface{}) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := q.Submit(ctx, "answer", map[string]interface{}{"question": "why"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.Work(ctx)
+		close(done)
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		jobs, _ := store.List(ctx, Succeeded)
+		if len(jobs) == 20 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("%d of 20 jobs succeeded", len(jobs))
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	if peak > 4 {
+		t.Fatalf("%d jobs ran at once, want at most 4", peak)
+	}
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is a Backend that keeps jobs in memory and, when it has a
+// directory, writes each job to a JSON file there so that the queue
+// survives restarts. Only one process may use a directory at a time.
+type Store struct {
+	dir string
+	now func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+var _ Backend = (*Store)(nil)
+
+// NewMemoryStore creates a Store that keeps jobs in memory only
+func NewMemoryStore() *Store {
+	return &Store{now: time.Now, jobs: make(map[string]*Job)}
+}
+
+// OpenStore opens the Store kept in dir, creating the directory if needed
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("opening queue: %w", err)
+	}
+	s := &Store{dir: dir, now: time.Now, jobs: make(map[string]*Job)}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("opening queue: %w", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening queue: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("opening queue: job file %s: %w", path, err)
+		}
+		s.jobs[job.ID] = &job
+	}
+	return s, nil
+}
+
+// Add implements Backend
+func (s *Store) Add(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; ok {
+		return fmt.Errorf("queue: job %s already exists", job.ID)
+	}
+	return s.put(job)
+}
+
+// Claim implements Backend
+func (s *Store) Claim(ctx context.Context, worker string, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var next *Job
+	for _, job := range s.jobs {
+		ready := (job.Status == Pending && !job.RunAt.After(now)) ||
+			(job.Status == Running && job.LeaseUntil.Before(now))
+		if ready && (next == nil || job.RunAt.Before(next.RunAt) ||
+			(job.RunAt.Equal(next.RunAt) && job.CreatedAt.Before(next.CreatedAt))) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, ErrEmpty
+	}
+
+	claimed := copyJob(next)
+	claimed.Status = Running
+	claimed.Attempts++
+	claimed.Worker = worker
+	claimed.LeaseUntil = now.Add(lease)
+	claimed.UpdatedAt = now
+	if err := s.put(claimed); err != nil {
+		return nil, err
+	}
+	return copyJob(claimed), nil
+}
+
+// Save implements Backend
+func (s *Store) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, job.ID)
+	}
+	if stored.Status == Running && stored.Worker != job.Worker {
+		return fmt.Errorf("%w: job %s is held by %s", ErrLeaseLost, job.ID, stored.Worker)
+	}
+	return s.put(job)
+}
+
+// Get implements Backend
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return copyJob(job), nil
+}
+
+// List implements Backend
+func (s *Store) List(ctx context.Context, status Status) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []*Job
+	for _, job := range s.jobs {
+		if status == "" || job.Status == status {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// Delete removes a finished job
+func (s *Store) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if job.Status == Running {
+		return fmt.Errorf("queue: job %s is running", id)
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("deleting job %s: %w", id, err)
+		}
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+// put stores a copy of job and writes it to its file. s.mu must be held.
+func (s *Store) put(job *Job) error {
+	if s.dir != "" {
+		data, err := json.MarshalIndent(job, "", "  ")
+		if err != nil {
+			return fmt.Errorf("saving job %s: %w", job.ID, err)
+		}
+		// Write then rename so a crash never leaves a half-written file
+		path := s.path(job.ID)
+		if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+			return fmt.Errorf("saving job %s: %w", job.ID, err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return fmt.Errorf("saving job %s: %w", job.ID, err)
+		}
+	}
+	s.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", `\`, "_").Replace(id)+".json")
+}
+
+// copyJob returns a copy of job that shares no maps with it. Input and
+// Output are copied one level deep, which is enough since the queue never
+// modifies nested values.
+func copyJob(job *Job) *Job {
+	c := *job
+	c.Input = copyMap(job.Input)
+	c.Output = copyMap(job.Output)
+	return &c
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/flowdef"
+	"github.com/utkarsh-cpu/go_agent/testkit"
+)
+
+func newRouter(model *testkit.FakeModel) (*RouterNode, *agent.Flow) {
+	r := NewRouterNode(model, 2)
+	r.SetName("triage")
+	r.Route("billing", "Questions about invoices, refunds and payments", agent.NewBaseNode())
+	r.Route("support", "Technical problems with the product", agent.NewBaseNode())
+	r.Next(agent.NewBaseNode(), DefaultAction)
+	return r, agent.NewFlow(r)
+}
+
+func TestRouterNode_Routes(t *testing.T) {
+	model := testkit.NewFakeModel()
+	model.On("refund").Reply("```json\n{\"action\": \"Billing\", \"confidence\": 0.9, \"rationale\": \"asks for a refund\"}\n```")
+	r, flow := newRouter(model)
+
+	shared := map[string]interface{}{"question": "Where is my refund?"}
+	tr := testkit.AssertPath(t, flow, shared, []string{"billing"})
+	tr.AssertNodes(t, []string{"triage", "BaseNode"})
+
+	d := shared[DefaultDecisionKey].(Decision)
+	if d.Action != "billing" || d.Confidence != 0.9 || d.Rationale != "asks for a refund" || d.Fallback {
+		t.Fatalf("decision = %+v", d)
+	}
+	prompt := model.Calls()[0].Prompt
+	if !strings.Contains(prompt, "- support: Technical problems") || strings.Contains(prompt, "- default") {
+		t.Fatalf("prompt does not offer exactly the described routes:\n%s", prompt)
+	}
+	if got := len(r.Routes()); got != 2 {
+		t.Fatalf("Routes = %d, want 2", got)
+	}
+}
+
+func TestRouterNode_FallsBack(t *testing.T) {
+	model := testkit.NewFakeModel()
+	model.On("unsure").Reply(`{"action": "support", "confidence": 0.3, "rationale": "could be either"}`)
+	model.On("invalid").Reply(`{"action": "sales", "confidence": 0.9}`, "no idea")
+	model.On("down").Fail(errors.New("model unavailable"))
+	_, flow := newRouter(model)
+
+	shared := map[string]interface{}{"question": "I'm unsure what I need"}
+	testkit.AssertPath(t, flow, shared, []string{DefaultAction})
+	if d := shared[DefaultDecisionKey].(Decision); !d.Fallback || d.Chosen != "support" {
+		t.Fatalf("low-confidence decision = %+v, want a fallback from support", d)
+	}
+
+	shared = map[string]interface{}{"question": "invalid"}
+	testkit.AssertPath(t, flow, shared, []string{DefaultAction})
+	if d := shared[DefaultDecisionKey].(Decision); !d.Fallback || d.Chosen != "" || !strings.Contains(d.Rationale, "no JSON object") {
+		t.Fatalf("decision after invalid replies = %+v", d)
+	}
+	model.AssertCalled(t, "invalid", 2)
+
+	shared = map[string]interface{}{"question": "down"}
+	testkit.AssertPath(t, flow, shared, []string{DefaultAction})
+	if d := shared[DefaultDecisionKey].(Decision); !strings.Contains(d.Rationale, "model unavailable") {
+		t.Fatalf("decision after model errors = %+v", d)
+	}
+}
+
+func TestFromDef(t *testing.T) {
+	def, err := flowdef.Parse([]byte(`
+start: triage
+nodes:
+  triage:
+    type: llm_route
+    retries: 2
+    params:
+      routes:
+        billing: Questions about invoices and refunds
+        support: Technical problems
+      min_confidence: 0.8
+    next:
+      billing: billing
+      support: support
+      default: support
+  billing:
+    type: set
+    params:
+      values: {team: billing}
+  support:
+    type: set
+    params:
+      values: {team: support}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := flowdef.Builtins()
+	reg["llm_route"] = FromDef
+	flow, err := def.Build(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := testkit.NewFakeModel()
+	model.On("money back").Reply(`{"action": "billing", "confidence": 0.9, "rationale": "refund"}`)
+	model.On("app crashes").Reply(`{"action": "billing", "confidence": 0.6, "rationale": "maybe"}`)
+	for question, team := range map[string]string{"I want my money back": "billing", "app crashes on the invoice page": "support"} {
+		shared := map[string]interface{}{"question": question, "llm": model}
+		flow.Run(shared)
+		if shared["team"] != team {
+			t.Errorf("team for %q = %v, want %s", question, shared["team"], team)
+		}
+	}
+
+	if _, err := FromDef(flowdef.NodeDef{Params: map[string]interface{}{}}); err == nil {
+		t.Error("FromDef accepted a node without routes")
+	}
+}
@@ -0,0 +1,460 @@
+// Package schedule runs flows on cron expressions or fixed intervals, for
+// example a daily research digest.
+//
+// Each Entry names a flow and its schedule, and gives the run's shared input
+// as templates that are filled with the run time. A Scheduler never starts a
+// flow while a run of it is still going, whichever entry started it; the
+// skipped run is counted instead. The last run of every entry is kept in a state file, so
+// that after a restart runs that were due while the process was down are
+// reported as missed and, if the entry asks for it, made up once.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/prompt"
+)
+
+var (
+	// ErrRunning is returned by Trigger while a run of the entry's flow is
+	// still going
+	ErrRunning = errors.New("schedule: flow is already running")
+	// ErrUnknownEntry is returned for names that were not added
+	ErrUnknownEntry = errors.New("schedule: unknown entry")
+)
+
+const (
+	// maxMissed bounds the missed run times passed to OnMissed
+	maxMissed = 100
+	// maxCounted bounds the missed runs counted at start, for short
+	// intervals after a long downtime
+	maxCounted = 100_000
+)
+
+// Entry is a flow run on a schedule
+type Entry struct {
+	// Name identifies the entry in the state file; it must be unique
+	Name string
+	// Spec decides when the entry runs; see Parse
+	Spec Spec
+	// Flow returns the flow to run. It is called for every run.
+	Flow func() *agent.Flow
+	// FlowName names the flow for overlap prevention: entries with the same
+	// FlowName never run at the same time. It defaults to Name.
+	FlowName string
+	// Input is the shared state of every run. String values are templates
+	// executed with the run's Data, e.g. "Digest for {{.Time.Format \"Jan 2\"}}".
+	// Other values are copied as they are.
+	Input map[string]interface{}
+	// CatchUp runs the entry once at start when runs were missed
+	CatchUp bool
+}
+
+// Data is what input templates are executed with
+type Data struct {
+	// Name is the entry's name
+	Name string
+	// Time is when the run was scheduled, or when it was triggered by hand
+	Time time.Time
+	// Last is when the previous run started, zero for the first run
+	Last time.Time
+}
+
+// State is what the scheduler remembers about an entry across restarts
+type State struct {
+	// LastScheduled is the latest scheduled time that was handled, whether
+	// the run started or was skipped
+	LastScheduled time.Time `json:"last_scheduled"`
+	LastStarted   time.Time `json:"last_started,omitempty"`
+	LastFinished  time.Time `json:"last_finished,omitempty"`
+	// LastAction is the final action of the last run
+	LastAction string `json:"last_action,omitempty"`
+	// LastError describes the last run's failure, empty if it succeeded
+	LastError string `json:"last_error,omitempty"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+	// Skipped counts runs that were not started because the previous run
+	// was still going
+	Skipped int `json:"skipped"`
+	// Missed counts runs that were due while the scheduler was not running
+	Missed int `json:"missed"`
+	// Next is when the entry runs next
+	Next time.Time `json:"next,omitempty"`
+}
+
+type entry struct {
+	Entry
+	templates map[string]*template.Template
+	// ready is set once missed runs were checked and Next computed
+	ready bool
+}
+
+// flow returns the name runs of e are kept apart by
+func (e *entry) flow() string {
+	if e.FlowName != "" {
+		return e.FlowName
+	}
+	return e.Name
+}
+
+// Scheduler runs entries on their schedules
+type Scheduler struct {
+	// Prepare, when set, is called before every run to add values that
+	// cannot be templated, such as LLM clients, to the shared state. An
+	// error fails the run.
+	Prepare func(ctx context.Context, name string, shared map[string]interface{}) error
+	// ContextKey names the shared key that receives the run's context
+	ContextKey string
+	// OnMissed is called at start with the times an entry missed, oldest
+	// first. By default the missed runs are logged.
+	OnMissed func(name string, missed []time.Time)
+	// OnFinish, when set, is called after every run with its final shared
+	// state and its failure, for example to deliver a digest
+	OnFinish func(name string, shared map[string]interface{}, err error)
+	// Location is the time zone of cron schedules; time.Local when nil
+	Location *time.Location
+
+	path string
+	now  func() time.Time
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	state   map[string]*State
+	// running holds the flows with a run going, by entry.flow
+	running map[string]bool
+}
+
+// New creates a Scheduler that keeps its state in the JSON file at path. An
+// empty path keeps the state in memory only.
+func New(path string) (*Scheduler, error) {
+	s := &Scheduler{
+		ContextKey: "ctx",
+		path:       path,
+		now:        time.Now,
+		wake:       make(chan struct{}, 1),
+		entries:    make(map[string]*entry),
+		state:      make(map[string]*State),
+		running:    make(map[string]bool),
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading schedule state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("loading schedule state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Add adds an entry. Its input templates are parsed now, so that mistakes
+// show up before the first run.
+func (s *Scheduler) Add(e Entry) error {
+	if e.Name == "" || e.Spec == nil || e.Flow == nil {
+		return fmt.Errorf("schedule: entry %q needs a name, a spec and a flow", e.Name)
+	}
+	templates := make(map[string]*template.Template)
+	for k, v := range e.Input {
+		text, ok := v.(string)
+		if !ok || !strings.Contains(text, "{{") {
+			continue
+		}
+		t, err := template.New(k).Funcs(prompt.Funcs()).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("schedule: entry %q: input %q: %w", e.Name, k, err)
+		}
+		templates[k] = t
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[e.Name]; ok {
+		return fmt.Errorf("schedule: entry %q already exists", e.Name)
+	}
+	s.entries[e.Name] = &entry{Entry: e, templates: templates}
+	if _, ok := s.state[e.Name]; !ok {
+		s.state[e.Name] = &State{}
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// State returns the state of the named entry
+func (s *Scheduler) State(name string) (State, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.state[name]
+	if !ok {
+		return State{}, false
+	}
+	return *st, true
+}
+
+// Names returns the names of the added entries, sorted
+func (s *Scheduler) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs entries on their schedules until ctx is canceled, then waits for
+// the runs in progress to finish. Their flows see the cancellation through
+// the run's context.
+func (s *Scheduler) Run(ctx context.Context) {
+	defer s.wg.Wait()
+	for {
+		next := s.tick(ctx)
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(s.now()))
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// tick prepares new entries, starts the runs that are due and returns when
+// the next run is due, or the zero time if no entry will run again
+func (s *Scheduler) tick(ctx context.Context) time.Time {
+	s.mu.Lock()
+	now := s.now()
+	var next time.Time
+	missed := make(map[string][]time.Time)
+	counts := make(map[string]int)
+	for _, e := range s.entries {
+		st := s.state[e.Name]
+		if !e.ready {
+			if times, n := s.checkMissed(ctx, e, st, now); n > 0 {
+				missed[e.Name], counts[e.Name] = times, n
+			}
+			e.ready = true
+		}
+		if !st.Next.IsZero() && !st.Next.After(now) {
+			s.start(ctx, e, st, st.Next)
+			st.Next = e.Spec.Next(now.In(s.location()))
+		}
+		if !st.Next.IsZero() && (next.IsZero() || st.Next.Before(next)) {
+			next = st.Next
+		}
+	}
+	s.save()
+	s.mu.Unlock()
+
+	// Report outside the lock, so that OnMissed may use the Scheduler
+	for name, times := range missed {
+		if s.OnMissed != nil {
+			s.OnMissed(name, times)
+		} else {
+			log.Printf("Warning: schedule entry %q missed %d runs since %s", name, counts[name], times[0].Format(time.RFC3339))
+		}
+	}
+	return next
+}
+
+// checkMissed counts the runs of e that were due between its last
+// scheduled time and now, computes its next run and returns the first
+// missed times and their count. s.mu must be held.
+func (s *Scheduler) checkMissed(ctx context.Context, e *entry, st *State, now time.Time) ([]time.Time, int) {
+	// An entry that never ran was due at the Next saved before the restart
+	t := st.Next
+	if !st.LastScheduled.IsZero() {
+		t = e.Spec.Next(st.LastScheduled.In(s.location()))
+	}
+	if t.IsZero() {
+		st.Next = e.Spec.Next(now.In(s.location()))
+		return nil, 0
+	}
+	var missed []time.Time
+	var last time.Time
+	n := 0
+	for ; !t.IsZero() && !t.After(now); t = e.Spec.Next(t) {
+		if n < maxMissed {
+			missed = append(missed, t)
+		}
+		last = t
+		if n++; n == maxCounted {
+			t = e.Spec.Next(now.In(s.location()))
+			break
+		}
+	}
+	st.Next = t
+	if n == 0 {
+		return nil, 0
+	}
+	st.Missed += n
+	if e.CatchUp {
+		s.start(ctx, e, st, last)
+	} else {
+		st.LastScheduled = last
+	}
+	return missed, n
+}
+
+// start runs e for the given scheduled time in the background, unless a run
+// of its flow is still going. s.mu must be held.
+func (s *Scheduler) start(ctx context.Context, e *entry, st *State, scheduled time.Time) {
+	st.LastScheduled = scheduled
+	if s.running[e.flow()] {
+		st.Skipped++
+		log.Printf("Warning: schedule entry %q skipped the run due at %s: a run of flow %q is still going", e.Name, scheduled.Format(time.RFC3339), e.flow())
+		return
+	}
+	s.running[e.flow()] = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, e, scheduled)
+	}()
+}
+
+// Trigger runs the named entry now and waits for it to finish, outside its
+// schedule. It returns ErrRunning while a run of the entry's flow is going,
+// and the run's failure if it fails.
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownEntry, name)
+	}
+	if s.running[e.flow()] {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrRunning, e.flow())
+	}
+	s.running[e.flow()] = true
+	s.mu.Unlock()
+	return s.run(ctx, e, s.now())
+}
+
+// run runs e, whose flow is marked as running, and records the outcome
+func (s *Scheduler) run(ctx context.Context, e *entry, scheduled time.Time) error {
+	s.mu.Lock()
+	st := s.state[e.Name]
+	data := Data{Name: e.Name, Time: scheduled, Last: st.LastStarted}
+	st.LastStarted = s.now()
+	st.Runs++
+	s.save()
+	s.mu.Unlock()
+
+	shared := make(map[string]interface{}, len(e.Input)+1)
+	action, err := s.execute(ctx, e, data, shared)
+	if s.OnFinish != nil {
+		s.OnFinish(e.Name, shared, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, e.flow())
+	st.LastFinished, st.LastAction = s.now(), action
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+		log.Printf("Warning: schedule entry %q failed: %v", e.Name, err)
+	} else {
+		st.LastError = ""
+	}
+	s.save()
+	return err
+}
+
+// execute runs e's flow once with shared and returns its final action and
+// why it failed, if it did
+func (s *Scheduler) execute(ctx context.Context, e *entry, data Data, shared map[string]interface{}) (action string, err error) {
+	for k, v := range e.Input {
+		t, ok := e.templates[k]
+		if !ok {
+			shared[k] = v
+			continue
+		}
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return "", fmt.Errorf("rendering input %q: %w", k, err)
+		}
+		shared[k] = sb.String()
+	}
+	if s.ContextKey != "" {
+		shared[s.ContextKey] = ctx
+	}
+	if s.Prepare != nil {
+		if err := s.Prepare(ctx, e.Name, shared); err != nil {
+			return "", fmt.Errorf("preparing run: %w", err)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("flow panicked: %v", r)
+		}
+	}()
+
+	result := e.Flow().Run(shared)
+	if s, ok := result.(*agent.Suspension); ok {
+		return "suspended", fmt.Errorf("suspended at %s; scheduled runs cannot wait for input", s.Node)
+	}
+	return agent.Outcome(result, shared)
+}
+
+func (s *Scheduler) location() *time.Location {
+	if s.Location != nil {
+		return s.Location
+	}
+	return time.Local
+}
+
+// save writes the state file. s.mu must be held. Failures are logged,
+// since the schedule goes on without the file.
+func (s *Scheduler) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err == nil {
+		// Write then rename so a crash never leaves a half-written file
+		if err = os.MkdirAll(filepath.Dir(s.path), 0o755); err == nil {
+			tmp := s.path + ".tmp"
+			if err = os.WriteFile(tmp, data, 0o644); err == nil {
+				err = os.Rename(tmp, s.path)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: could not save schedule state: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+func TestParse(t *testing.T) {
+	// Saturday
+	from := time.Date(2024, time.March, 2, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 9-17 * * mon-fri", time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.March, 2, 11, 0, 0, 0, time.UTC)},
+		{"10,20 * * * *", time.Date(2024, time.March, 2, 10, 10, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week both restricted: either one matches
+		{"0 12 15 * 7", time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 90m", from.Add(90 * time.Minute)},
+	}
+	for _, c := range cases {
+		spec, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", c.spec, err)
+			continue
+		}
+		if got := spec.Next(from); !got.Equal(c.want) {
+			t.Errorf("Parse(%q).Next = %v, want %v", c.spec, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@every soon"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+// recordNode records the topic of every run and blocks while release is open
+type recordNode struct {
+	*agent.Node
+	mu      *sync.Mutex
+	topics  *[]string
+	release chan struct{}
+}
+
+func (n *recordNode) Prep(shared map[string]interface{}) interface{} {
+	return shared["topic"]
+}
+
+func (n *recordNode) Exec(prepRes interface{}) interface{} {
+	if n.release != nil {
+		<-n.release
+	}
+	n.mu.Lock()
+	*n.topics = append(*n.topics, prepRes.(string))
+	n.mu.Unlock()
+	return nil
+}
+
+func newRecorder(release chan struct{}) (func() *agent.Flow, func() []string) {
+	var mu sync.Mutex
+	var topics []string
+	flow := func() *agent.Flow {
+		return agent.NewFlow(&recordNode{Node: agent.NewNode(1, 0), mu: &mu, topics: &topics, release: release})
+	}
+	return flow, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), topics...)
+	}
+}
+
+func TestScheduler_ReportsAndCatchesUpMissedRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	now := time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC)
+	flow, topics := newRecorder(nil)
+	entry := Entry{
+		Name:    "digest",
+		Spec:    Every(10 * time.Minute),
+		Flow:    flow,
+		Input:   map[string]interface{}{"topic": `{{.Name}} at {{.Time.Format "15:04"}}`},
+		CatchUp: true,
+	}
+
+	// The first process starts at 9:00, runs the entry at 9:10 and stops
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now.Add(-time.Hour) }
+	s.Add(entry)
+	s.tick(context.Background())
+	s.now = func() time.Time { return now.Add(-50 * time.Minute) }
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	// The next one starts at 10:00
+	s, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	var missed []time.Time
+	s.OnMissed = func(name string, times []time.Time) { missed = times }
+	var finished []interface{}
+	s.OnFinish = func(name string, shared map[string]interface{}, err error) {
+		finished = append(finished, shared["topic"])
+	}
+	s.Add(entry)
+	next := s.tick(context.Background())
+	s.wg.Wait()
+
+	if len(missed) != 5 || !missed[0].Equal(now.Add(-40*time.Minute)) {
+		t.Fatalf("missed = %v, want the 5 runs from 9:20", missed)
+	}
+	if got := topics(); len(got) != 2 || got[0] != "digest at 09:10" || got[1] != "digest at 10:00" {
+		t.Fatalf("runs = %q, want the 9:10 run and one catch-up run", got)
+	}
+	if len(finished) != 1 || finished[0] != "digest at 10:00" {
+		t.Fatalf("OnFinish saw %v, want the catch-up run", finished)
+	}
+	st, _ := s.State("digest")
+	if st.Missed != 5 || st.Runs != 2 || !st.LastScheduled.Equal(now) || !next.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("state = %+v, next %v", st, next)
+	}
+}
+
+func TestScheduler_PreventsOverlappingRuns(t *testing.T) {
+	release := make(chan struct{})
+	flow, topics := newRecorder(release)
+	s, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Entry{Name: "slow", Spec: Every(5 * time.Millisecond), Flow: flow, Input: map[string]interface{}{"topic": "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Entry{Name: "slow", Spec: Every(time.Second), Flow: flow}); err == nil {
+		t.Fatal("Add accepted a duplicate name")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		if st, _ := s.State("slow"); st.Skipped >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("no overlapping run was skipped")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err := s.Trigger(ctx, "slow"); !errors.Is(err, ErrRunning) {
+		t.Fatalf("Trigger = %v, want ErrRunning", err)
+	}
+	// Another entry for the same flow waits for it too
+	if err := s.Add(Entry{Name: "slow-too", FlowName: "slow", Spec: Every(time.Hour), Flow: flow}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trigger(ctx, "slow-too"); !errors.Is(err, ErrRunning) {
+		t.Fatalf("Trigger of another entry for the flow = %v, want ErrRunning", err)
+	}
+	cancel()
+	close(release)
+	<-done
+
+	if st, _ := s.State("slow"); st.Runs != 1 || len(topics()) != 1 {
+		t.Fatalf("state = %+v, want exactly one run", st)
+	}
+	if err := s.Trigger(context.Background(), "missing"); !errors.Is(err, ErrUnknownEntry) {
+		t.Fatalf("Trigger of an unknown entry = %v, want ErrUnknownEntry", err)
+	}
+}
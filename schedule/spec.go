@@ -0,0 +1,226 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec decides when an entry runs
+type Spec interface {
+	// Next returns the first run time after t, or the zero time if there is
+	// none
+	Next(t time.Time) time.Time
+}
+
+// Every returns a Spec that runs every d, counted from the previous run
+func Every(d time.Duration) Spec {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	if e <= 0 {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// macros are the named cron expressions Parse accepts
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a schedule: a five-field cron expression (minute, hour, day
+// of month, month and day of week), a macro such as "@daily" or "@hourly",
+// or "@every <duration>" such as "@every 90m".
+//
+// Cron fields accept "*", numbers, ranges ("1-5"), steps ("*/15", "8-18/2")
+// and comma-separated lists of these. Months and weekdays may also be given
+// by their three-letter English names, and Sunday is 0 or 7. As in classic
+// cron, when both the day of month and the day of week are restricted, a
+// day matching either one runs.
+func Parse(spec string) (Spec, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		dur, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || dur <= 0 {
+			return nil, fmt.Errorf("schedule: invalid interval in %q", spec)
+		}
+		return Every(dur), nil
+	}
+	if expr, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+	return ParseCron(spec)
+}
+
+// MustParse is like Parse but panics on invalid schedules
+func MustParse(spec string) Spec {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Cron is a Spec built from a cron expression. Times are computed in the
+// location of the time passed to Next.
+type Cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	// anyDay is set when the day of month or the day of week is "*"
+	anyDay bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// ParseCron parses a five-field cron expression; see Parse for the syntax
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule: %q: want 5 fields, got %d", expr, len(fields))
+	}
+	c := &Cron{expr: expr}
+	var err error
+	for i, p := range []struct {
+		f   field
+		set *uint64
+	}{{minuteField, &c.minute}, {hourField, &c.hour}, {domField, &c.dom}, {monthField, &c.month}, {dowField, &c.dow}} {
+		if *p.set, err = p.f.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("schedule: %q: %w", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parse returns the set of values s selects, one bit per value
+func (f field) parse(s string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/10" means from 5 to the end, every 10
+			if step > 1 {
+				hi = f.max
+			} else {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+// maxSearch bounds how far ahead Next looks for a matching time, so that
+// expressions that never match, such as "0 0 30 2 *", end
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next implements Spec
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxSearch)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
@@ -0,0 +1,150 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errNoProviders is returned by FanOut when it has nothing to query
+var errNoProviders = errors.New("search: no providers configured")
+
+// FanOut queries several providers in parallel and merges their results
+type FanOut struct {
+	Providers []Provider
+}
+
+// NewFanOut creates a FanOut over providers
+func NewFanOut(providers ...Provider) *FanOut {
+	return &FanOut{Providers: providers}
+}
+
+// Name implements Provider
+func (f *FanOut) Name() string {
+	names := make([]string, len(f.Providers))
+	for i, p := range f.Providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+// Search implements Provider. Results are merged by reciprocal rank, so a
+// page ranked highly by several engines comes first, and pages returned by
+// more than one provider appear once. Failing providers are logged and
+// skipped; an error is only returned if every provider fails.
+func (f *FanOut) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	if len(f.Providers) == 0 {
+		return nil, errNoProviders
+	}
+
+	lists := make([][]Result, len(f.Providers))
+	errs := make([]error, len(f.Providers))
+	var wg sync.WaitGroup
+	for i, p := range f.Providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
+			lists[i], errs[i] = p.Search(ctx, query, limit)
+		}(i, p)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			log.Printf("Warning: search provider %s failed: %v", f.Providers[i].Name(), err)
+		}
+	}
+	if failed == len(f.Providers) {
+		return nil, errors.Join(errs...)
+	}
+
+	return limitMerged(Merge(lists...), limit), nil
+}
+
+// Merge combines ranked result lists, dropping duplicate URLs. The first
+// occurrence of a page keeps its title and snippet; its score is the sum of
+// 1/(k+rank) over every list it appears in.
+func Merge(lists ...[]Result) []Result {
+	const k = 60 // standard reciprocal rank fusion constant
+
+	type entry struct {
+		result Result
+		score  float64
+		first  int
+	}
+	byURL := make(map[string]*entry)
+	order := 0
+	for _, list := range lists {
+		for i, r := range list {
+			key := NormalizeURL(r.URL)
+			rank := r.Rank
+			if rank <= 0 {
+				rank = i + 1
+			}
+			e, ok := byURL[key]
+			if !ok {
+				e = &entry{result: r, first: order}
+				byURL[key] = e
+				order++
+			} else if e.result.Snippet == "" {
+				e.result.Snippet = r.Snippet
+			}
+			e.score += 1 / float64(k+rank)
+		}
+	}
+
+	entries := make([]*entry, 0, len(byURL))
+	for _, e := range byURL {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].score != entries[b].score {
+			return entries[a].score > entries[b].score
+		}
+		return entries[a].first < entries[b].first
+	})
+
+	merged := make([]Result, len(entries))
+	for i, e := range entries {
+		merged[i] = e.result
+		merged[i].Rank = i + 1
+	}
+	return merged
+}
+
+func limitMerged(results []Result, limit int) []Result {
+	if limit > 0 && len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
+
+// NormalizeURL reduces a URL to a key that identifies the page: scheme and
+// host are lowercased, "www." and the fragment are dropped, tracking
+// parameters are removed and a trailing slash is ignored
+func NormalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(strings.ToLower(raw), "/")
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	params := u.Query()
+	for key := range params {
+		if strings.HasPrefix(key, "utm_") || key == "ref" || key == "fbclid" || key == "gclid" {
+			params.Del(key)
+		}
+	}
+
+	normalized := host + strings.TrimRight(u.EscapedPath(), "/")
+	if q := params.Encode(); q != "" {
+		normalized += "?" + q
+	}
+	return normalized
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BraveEndpoint is the Brave Search web search API
+const BraveEndpoint = "https://api.search.brave.com/res/v1/web/search"
+
+// Brave queries the Brave Search API
+type Brave struct {
+	APIKey string
+	// BaseURL overrides BraveEndpoint, e.g. for tests
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewBrave creates a Brave provider using the given subscription token
+func NewBrave(apiKey string) *Brave {
+	return &Brave{APIKey: apiKey}
+}
+
+// Name implements Provider
+func (b *Brave) Name() string {
+	return "brave"
+}
+
+// Search implements Provider
+func (b *Brave) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	endpoint := b.BaseURL
+	if endpoint == "" {
+		endpoint = BraveEndpoint
+	}
+	params := url.Values{"q": {query}}
+	if limit > 0 {
+		params.Set("count", strconv.Itoa(limit))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("brave: %w", err)
+	}
+	req.Header.Set("X-Subscription-Token", b.APIKey)
+
+	var body struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := getJSON(b.Client, b.Name(), req, &body); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(body.Web.Results))
+	for _, r := range body.Web.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Description})
+	}
+	return limitResults(results, limit, b.Name()), nil
+}
+
+// SearXNG queries a SearXNG instance. The instance must have the json output
+// format enabled.
+type SearXNG struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewSearXNG creates a provider for the instance at baseURL
+func NewSearXNG(baseURL string) *SearXNG {
+	return &SearXNG{BaseURL: baseURL}
+}
+
+// Name implements Provider
+func (s *SearXNG) Name() string {
+	return "searxng"
+}
+
+// Search implements Provider
+func (s *SearXNG) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+	endpoint := strings.TrimRight(s.BaseURL, "/") + "/search?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("searxng: %w", err)
+	}
+
+	var body struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := getJSON(s.Client, s.Name(), req, &body); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(body.Results))
+	for _, r := range body.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return limitResults(results, limit, s.Name()), nil
+}
+
+// JSONEndpoint adapts any search API that answers a GET request with JSON.
+// The query is sent in QueryParam and results are read from the array at
+// ResultsPath, a dot-separated path such as "data.items".
+type JSONEndpoint struct {
+	ProviderName string
+	URL          string
+	QueryParam   string
+	// LimitParam, when set, carries the requested number of results
+	LimitParam string
+	Headers    map[string]string
+	// ResultsPath locates the result array; the top level when empty
+	ResultsPath string
+	// Field names inside each result; "title", "url" and "snippet" when empty
+	TitleField   string
+	URLField     string
+	SnippetField string
+	Client       *http.Client
+}
+
+// Name implements Provider
+func (j *JSONEndpoint) Name() string {
+	if j.ProviderName == "" {
+		return "json"
+	}
+	return j.ProviderName
+}
+
+// Search implements Provider
+func (j *JSONEndpoint) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	u, err := url.Parse(j.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", j.Name(), err)
+	}
+	params := u.Query()
+	queryParam := j.QueryParam
+	if queryParam == "" {
+		queryParam = "q"
+	}
+	params.Set(queryParam, query)
+	if j.LimitParam != "" && limit > 0 {
+		params.Set(j.LimitParam, strconv.Itoa(limit))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", j.Name(), err)
+	}
+	for k, v := range j.Headers {
+		req.Header.Set(k, v)
+	}
+
+	var body interface{}
+	if err := getJSON(j.Client, j.Name(), req, &body); err != nil {
+		return nil, err
+	}
+
+	node := body
+	if j.ResultsPath != "" {
+		for _, key := range strings.Split(j.ResultsPath, ".") {
+			obj, ok := node.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: no object at %q in response", j.Name(), key)
+			}
+			node = obj[key]
+		}
+	}
+	items, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: results at %q are not an array", j.Name(), j.ResultsPath)
+	}
+
+	results := make([]Result, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		r := Result{
+			Title:   stringField(obj, j.TitleField, "title"),
+			URL:     stringField(obj, j.URLField, "url"),
+			Snippet: stringField(obj, j.SnippetField, "snippet"),
+		}
+		if r.URL == "" {
+			continue
+		}
+		results = append(results, r)
+	}
+	return limitResults(results, limit, j.Name()), nil
+}
+
+func stringField(obj map[string]interface{}, field string, fallback string) string {
+	if field == "" {
+		field = fallback
+	}
+	s, _ := obj[field].(string)
+	return s
+}
@@ -0,0 +1,108 @@
+// Package search queries web search engines through their official JSON APIs.
+//
+// Every engine is a Provider returning structured Results. FanOut queries
+// several providers in parallel and merges their results into one ranking
+// without duplicates.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a single search request when no client is given
+const defaultTimeout = 15 * time.Second
+
+// maxResponseBytes caps how much of a search API response is read
+const maxResponseBytes = 4 << 20
+
+// Result is a single search hit
+type Result struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+	// Rank is the 1-based position of the result in its result list
+	Rank int `json:"rank"`
+	// Source names the provider that returned the result
+	Source string `json:"source"`
+}
+
+// Provider is a search engine
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]Result, error)
+}
+
+// Format renders results as a numbered plain-text list for LLM prompts
+func Format(results []Result) string {
+	var sb strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "%d. %s\n%s", r.Rank, r.Title, r.URL)
+		if r.Snippet != "" {
+			sb.WriteString("\n")
+			sb.WriteString(r.Snippet)
+		}
+	}
+	return sb.String()
+}
+
+// ErrStatus is returned when a search API answers with a non-2xx status
+type ErrStatus struct {
+	Provider string
+	Status   int
+	Body     string
+}
+
+func (e *ErrStatus) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d: %s", e.Provider, e.Status, e.Body)
+}
+
+// getJSON performs req and decodes a JSON response into out
+func getJSON(client *http.Client, provider string, req *http.Request, out interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("%s: reading response: %w", provider, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := string(body)
+		if len(snippet) > 200 {
+			snippet = snippet[:200]
+		}
+		return &ErrStatus{Provider: provider, Status: resp.StatusCode, Body: snippet}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", provider, err)
+	}
+	return nil
+}
+
+// limitResults truncates results to limit (when positive) and numbers them
+func limitResults(results []Result, limit int, source string) []Result {
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i].Rank = i + 1
+		results[i].Source = source
+	}
+	return results
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBrave(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Subscription-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("q") != "golang" || r.URL.Query().Get("count") != "2" {
+			t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"web":{"results":[
+			{"title":"Go","url":"https://go.dev/","description":"The Go language"},
+			{"title":"Tour","url":"https://go.dev/tour","description":"A tour"}]}}`))
+	}))
+	defer srv.Close()
+
+	b := &Brave{APIKey: "secret", BaseURL: srv.URL}
+	results, err := b.Search(context.Background(), "golang", 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Title != "Go" || results[0].Snippet != "The Go language" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+	if results[1].Rank != 2 || results[1].Source != "brave" {
+		t.Fatalf("Expected rank and source to be set, got %+v", results[1])
+	}
+
+	b.APIKey = "wrong"
+	_, err = b.Search(context.Background(), "golang", 2)
+	var statusErr *ErrStatus
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnauthorized {
+		t.Fatalf("Expected ErrStatus 401, got %v", err)
+	}
+}
+
+func TestSearXNG(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("format") != "json" {
+			t.Errorf("Unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(`{"results":[{"title":"A","url":"https://a.example","content":"alpha"}]}`))
+	}))
+	defer srv.Close()
+
+	results, err := NewSearXNG(srv.URL+"/").Search(context.Background(), "a", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Snippet != "alpha" || results[0].Source != "searxng" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+}
+
+func TestJSONEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != "x" || r.URL.Query().Get("key") != "k" {
+			t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"data":{"items":[
+			{"name":"One","link":"https://one.example","summary":"1"},
+			{"name":"No link"},
+			{"name":"Two","link":"https://two.example","summary":"2"}]}}`))
+	}))
+	defer srv.Close()
+
+	j := &JSONEndpoint{
+		ProviderName: "custom",
+		URL:          srv.URL + "?key=k",
+		QueryParam:   "query",
+		ResultsPath:  "data.items",
+		TitleField:   "name",
+		URLField:     "link",
+		SnippetField: "summary",
+	}
+	results, err := j.Search(context.Background(), "x", 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[1].Title != "Two" || results[1].Rank != 2 {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	j.ResultsPath = "data.missing"
+	if _, err := j.Search(context.Background(), "x", 0); err == nil {
+		t.Fatalf("Expected error for missing results path")
+	}
+}
+
+// staticProvider returns fixed results or an error
+type staticProvider struct {
+	name    string
+	results []Result
+	err     error
+}
+
+func (s *staticProvider) Name() string { return s.name }
+
+func (s *staticProvider) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	return limitResults(append([]Result(nil), s.results...), limit, s.name), s.err
+}
+
+func TestFanOut_MergesAndDeduplicates(t *testing.T) {
+	a := &staticProvider{name: "a", results: []Result{
+		{Title: "Shared", URL: "https://www.example.com/page/?utm_source=a"},
+		{Title: "Only A", URL: "https://a.example"},
+	}}
+	b := &staticProvider{name: "b", results: []Result{
+		{Title: "Only B", URL: "https://b.example"},
+		{Title: "Shared again", URL: "https://example.com/page#top", Snippet: "from b"},
+	}}
+	broken := &staticProvider{name: "broken", err: errors.New("down")}
+
+	f := NewFanOut(a, b, broken)
+	results, err := f.Search(context.Background(), "q", 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 unique results, got %+v", results)
+	}
+	if results[0].Title != "Shared" || results[0].Snippet != "from b" {
+		t.Fatalf("Expected the page returned by both providers first, got %+v", results[0])
+	}
+	if results[2].Rank != 3 {
+		t.Fatalf("Expected merged results to be re-ranked, got %+v", results[2])
+	}
+	if f.Name() != "a+b+broken" {
+		t.Fatalf("Unexpected name %q", f.Name())
+	}
+
+	_, err = NewFanOut(broken).Search(context.Background(), "q", 10)
+	if err == nil || !strings.Contains(err.Error(), "down") {
+		t.Fatalf("Expected error when every provider fails, got %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	out := Format([]Result{{Title: "Go", URL: "https://go.dev", Snippet: "lang", Rank: 1}})
+	if out != "1. Go\nhttps://go.dev\nlang" {
+		t.Fatalf("Unexpected format: %q", out)
+	}
+}
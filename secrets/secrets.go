@@ -0,0 +1,163 @@
+// Package secrets gives flows access to API keys and other credentials
+// without spreading them through the code, the logs and saved state.
+//
+// A Provider looks secrets up by name: Env reads environment variables,
+// Files reads one file per secret as mounted by container runtimes, Map
+// holds values such as those of a dotenv file read with LoadDotenv, and a
+// Vault keeps them in a local file encrypted with a passphrase. Chain tries
+// several providers in order.
+//
+// A Store is the Provider a program hands to its flows. It remembers every
+// secret it returns so that Redact can scrub them from logs, traces and
+// checkpoints. Nodes reach it through the shared state with Get, and declare
+// the secrets they need with Requirer so that Check fails before a run
+// starts when one is missing.
+package secrets
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned for secrets that no provider has
+var ErrNotFound = errors.New("secrets: not found")
+
+// Provider looks up secrets by name. Lookup returns an error wrapping
+// ErrNotFound for unknown names.
+type Provider interface {
+	Lookup(name string) (string, error)
+}
+
+// Env reads secrets from environment variables named Prefix + name
+type Env struct {
+	Prefix string
+}
+
+// Lookup implements Provider. Empty variables count as unset.
+func (e Env) Lookup(name string) (string, error) {
+	if v := os.Getenv(e.Prefix + name); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Files reads each secret from the file named after it in Dir, such as the
+// secrets Docker and Kubernetes mount under /run/secrets. Trailing newlines
+// are removed.
+type Files struct {
+	Dir string
+}
+
+// Lookup implements Provider
+func (f Files) Lookup(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: invalid name %q", ErrNotFound, name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Map is a Provider holding secrets in memory
+type Map map[string]string
+
+// Lookup implements Provider
+func (m Map) Lookup(name string) (string, error) {
+	if v, ok := m[name]; ok && v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Chain tries providers in order and returns the first secret found
+type Chain []Provider
+
+// Lookup implements Provider
+func (c Chain) Lookup(name string) (string, error) {
+	for _, p := range c {
+		v, err := p.Lookup(name)
+		if err == nil {
+			return v, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// LoadDotenv reads a dotenv file of NAME=value lines
+func LoadDotenv(path string) (Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading dotenv file: %w", err)
+	}
+	defer f.Close()
+	m, err := ParseDotenv(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading dotenv file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseDotenv parses NAME=value lines. Blank lines and lines starting with
+// # are skipped, an "export " prefix is allowed, and values may be quoted:
+// double-quoted values understand \n, \" and \\ escapes, single-quoted
+// values are taken literally. Unquoted values end at " #".
+func ParseDotenv(r io.Reader) (Map, error) {
+	m := make(Map)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		name, value, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: want NAME=value", line)
+		}
+		value, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		m[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func unquote(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '"', '\'':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		inner := value[1:end]
+		if quote == '\'' {
+			return inner, nil
+		}
+		return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(inner), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+func TestProviders(t *testing.T) {
+	t.Setenv("APP_TOKEN", "from-env")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "TOKEN"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := (Env{Prefix: "APP_"}).Lookup("TOKEN"); err != nil || v != "from-env" {
+		t.Fatalf("Env.Lookup = %q, %v", v, err)
+	}
+	if v, err := (Files{Dir: dir}).Lookup("TOKEN"); err != nil || v != "from-file" {
+		t.Fatalf("Files.Lookup = %q, %v", v, err)
+	}
+	if _, err := (Files{Dir: dir}).Lookup("../TOKEN"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Files.Lookup of a path = %v, want ErrNotFound", err)
+	}
+
+	chain := Chain{Env{Prefix: "MISSING_"}, Map{"TOKEN": "from-map"}, Files{Dir: dir}}
+	if v, err := chain.Lookup("TOKEN"); err != nil || v != "from-map" {
+		t.Fatalf("Chain.Lookup = %q, %v, want the first provider that has it", v, err)
+	}
+	if _, err := chain.Lookup("OTHER"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Chain.Lookup of an unknown secret = %v, want ErrNotFound", err)
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	m, err := ParseDotenv(strings.NewReader(`
+# credentials
+export API_KEY=abc123 # inline comment
+QUOTED="line one\nsaid \"hi\""
+LITERAL='no \n escapes'
+EMPTY=
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Map{"API_KEY": "abc123", "QUOTED": "line one\nsaid \"hi\"", "LITERAL": `no \n escapes`, "EMPTY": ""}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s = %q, want %q", k, m[k], v)
+		}
+	}
+	if _, err := ParseDotenv(strings.NewReader("NOT A PAIR")); err == nil {
+		t.Fatal("ParseDotenv accepted a line without =")
+	}
+}
+
+func TestVault(t *testing.T) {
+	defer func(n int) { vaultIterations = n }(vaultIterations)
+	vaultIterations = 1000
+	path := filepath.Join(t.TempDir(), "vault.json")
+
+	v, err := OpenVault(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("API_KEY", "sk-secret")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-secret") || strings.Contains(string(data), "API_KEY") {
+		t.Fatalf("vault file is not encrypted:\n%s", data)
+	}
+
+	v, err = OpenVault(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := v.Lookup("API_KEY"); err != nil || s != "sk-secret" {
+		t.Fatalf("Lookup = %q, %v", s, err)
+	}
+	if _, err := OpenVault(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("OpenVault with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+
+	// A corrupt file is an error, not a panic
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	for _, corrupt := range []func(f vaultFile) vaultFile{
+		func(f vaultFile) vaultFile { f.Nonce = f.Nonce[:4]; return f },
+		func(f vaultFile) vaultFile { f.Nonce = nil; return f },
+		func(f vaultFile) vaultFile { f.Iterations = 0; return f },
+	} {
+		data, _ := json.Marshal(corrupt(f))
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenVault(path, "correct horse"); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("OpenVault of a corrupt vault = %v, want ErrWrongPassphrase", err)
+		}
+	}
+}
+
+func TestStore_Redacts(t *testing.T) {
+	s := NewStore(Map{"API_KEY": "sk-12345", "PIN": "42"})
+	s.Lookup("API_KEY")
+	s.Lookup("PIN")
+
+	if got := s.Redact("key=sk-12345 pin=42"); got != "key=[REDACTED:API_KEY] pin=42" {
+		t.Fatalf("Redact = %q", got)
+	}
+	v := s.RedactValue(map[string]interface{}{"log": []interface{}{"used sk-12345"}, "n": 1})
+	if got := v.(map[string]interface{})["log"].([]interface{})[0]; got != "used [REDACTED:API_KEY]" {
+		t.Fatalf("RedactValue = %v", v)
+	}
+
+	var out strings.Builder
+	logger := log.New(s.Writer(&out), "", 0)
+	logger.Printf("calling with key %s", "sk-12345")
+	if out.String() != "calling with key [REDACTED:API_KEY]\n" {
+		t.Fatalf("log output = %q", out.String())
+	}
+}
+
+type needsKey struct {
+	*agent.BaseNode
+}
+
+func (n *needsKey) RequiredSecrets() []string {
+	return []string{"API_KEY", "OTHER_KEY"}
+}
+
+func TestCheck(t *testing.T) {
+	first := &needsKey{BaseNode: agent.NewBaseNode()}
+	first.SetName("first")
+	flow := agent.NewFlow(first)
+
+	err := Check(flow, NewStore(Map{"API_KEY": "x"}))
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "OTHER_KEY") || strings.Contains(err.Error(), "API_KEY") {
+		t.Fatalf("Check = %v, want only OTHER_KEY missing", err)
+	}
+	if err := Check(flow, NewStore(Map{"API_KEY": "x", "OTHER_KEY": "y"})); err != nil {
+		t.Fatalf("Check = %v, want nil", err)
+	}
+
+	shared := map[string]interface{}{SharedKey: NewStore(Map{"API_KEY": "x"})}
+	if v, err := Get(shared, "API_KEY"); err != nil || v != "x" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if _, err := Get(map[string]interface{}{}, "API_KEY"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get without a store = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// SharedKey is the shared key under which nodes find the run's Store
+const SharedKey = "secrets"
+
+// minRedactLen is the length below which values are not redacted, since
+// replacing every occurrence of a short string would garble text
+const minRedactLen = 4
+
+// Store is a Provider that remembers the secrets it returns, so that they
+// can be redacted from anything the program writes. It is safe for
+// concurrent use.
+type Store struct {
+	provider Provider
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewStore creates a Store that looks secrets up in providers, in order
+func NewStore(providers ...Provider) *Store {
+	return &Store{provider: Chain(providers), values: make(map[string]string)}
+}
+
+// Lookup implements Provider
+func (s *Store) Lookup(name string) (string, error) {
+	v, err := s.provider.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.values[name] = v
+	s.mu.Unlock()
+	return v, nil
+}
+
+// Redact replaces every secret the store has returned with a placeholder
+// naming it
+func (s *Store) Redact(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.values) == 0 {
+		return text
+	}
+	// Replace longer values first, in case one secret contains another
+	names := make([]string, 0, len(s.values))
+	for name, v := range s.values {
+		if len(v) >= minRedactLen {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return len(s.values[names[i]]) > len(s.values[names[j]]) })
+	for _, name := range names {
+		text = strings.ReplaceAll(text, s.values[name], "[REDACTED:"+name+"]")
+	}
+	return text
+}
+
+// RedactValue returns a copy of v with secrets redacted from its strings,
+// looking into slices and string-keyed maps. Other values are returned
+// unchanged.
+func (s *Store) RedactValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		return s.Redact(x)
+	case error:
+		return s.Redact(x.Error())
+	case []string:
+		out := make([]string, len(x))
+		for i, item := range x {
+			out[i] = s.Redact(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = s.RedactValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			out[k] = s.RedactValue(item)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(x))
+		for k, item := range x {
+			out[k] = s.Redact(item)
+		}
+		return out
+	}
+	return v
+}
+
+// RedactEvent returns ev with secrets redacted from its error and result
+func (s *Store) RedactEvent(ev agent.Event) agent.Event {
+	ev.Error = s.Redact(ev.Error)
+	if ev.Result != nil {
+		ev.Result = s.RedactValue(ev.Result)
+	}
+	return ev
+}
+
+type redactWriter struct {
+	store *Store
+	w     io.Writer
+}
+
+// Writer returns a writer that redacts secrets before writing to w, for use
+// with log.SetOutput. Each write is redacted on its own, so a secret split
+// across two writes is not caught; the log package writes whole entries.
+func (s *Store) Writer(w io.Writer) io.Writer {
+	return &redactWriter{store: s, w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.store.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Get returns the secret called name from the Store in shared[SharedKey]
+func Get(shared map[string]interface{}, name string) (string, error) {
+	p, ok := shared[SharedKey].(Provider)
+	if !ok {
+		return "", fmt.Errorf("%w: %s (no secret provider in shared state)", ErrNotFound, name)
+	}
+	return p.Lookup(name)
+}
+
+// Requirer is implemented by nodes that need secrets to run
+type Requirer interface {
+	RequiredSecrets() []string
+}
+
+// Check looks up the secrets required by the nodes of flow and reports the
+// missing ones, so that a run fails before it starts rather than halfway.
+// Nodes of nested flows are not checked.
+func Check(flow *agent.Flow, p Provider) error {
+	var errs []error
+	for _, name := range flow.Graph().Nodes {
+		node, ok := flow.FindNode(name).(Requirer)
+		if !ok {
+			continue
+		}
+		for _, secret := range node.RequiredSecrets() {
+			if _, err := p.Lookup(secret); err != nil {
+				errs = append(errs, fmt.Errorf("node %q: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
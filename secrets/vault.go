@@ -0,0 +1,193 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrWrongPassphrase is returned when a vault cannot be decrypted
+var ErrWrongPassphrase = errors.New("secrets: wrong passphrase or corrupt vault")
+
+const (
+	vaultVersion   = 1
+	vaultKeyBytes  = 32
+	vaultSaltBytes = 16
+)
+
+// vaultIterations is the PBKDF2 iteration count of new vaults
+var vaultIterations = 600_000
+
+// Vault is a Provider that keeps secrets in a local file encrypted with a
+// passphrase, like a keyring. The key is derived with PBKDF2-SHA256 and the
+// secrets are sealed with AES-256-GCM. A Vault is safe for concurrent use.
+type Vault struct {
+	path       string
+	key        []byte
+	salt       []byte
+	iterations int
+
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// vaultFile is the file format of a Vault
+type vaultFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// OpenVault opens the vault at path with passphrase. A missing file is an
+// empty vault, created by the first Save.
+func OpenVault(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("secrets: empty vault passphrase")
+	}
+	v := &Vault{path: path, secrets: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		v.salt = make([]byte, vaultSaltBytes)
+		if _, err := rand.Read(v.salt); err != nil {
+			return nil, err
+		}
+		v.iterations = vaultIterations
+		if v.key, err = deriveKey(passphrase, v.salt, v.iterations); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening vault: %w", err)
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("opening vault %s: %w", path, err)
+	}
+	if f.Version != vaultVersion {
+		return nil, fmt.Errorf("opening vault %s: unsupported version %d", path, f.Version)
+	}
+	if f.Iterations <= 0 {
+		return nil, fmt.Errorf("%w: %s has %d key iterations", ErrWrongPassphrase, path, f.Iterations)
+	}
+	v.salt, v.iterations = f.Salt, f.Iterations
+	if v.key, err = deriveKey(passphrase, f.Salt, f.Iterations); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: %s has a %d-byte nonce", ErrWrongPassphrase, path, len(f.Nonce))
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &v.secrets); err != nil {
+		return nil, fmt.Errorf("opening vault %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func deriveKey(passphrase string, salt []byte, iterations int) ([]byte, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, vaultKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("deriving vault key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Lookup implements Provider
+func (v *Vault) Lookup(name string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.secrets[name]; ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Set stores a secret; call Save to write it
+func (v *Vault) Set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secrets[name] = value
+}
+
+// Delete removes a secret; call Save to write the change
+func (v *Vault) Delete(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.secrets, name)
+}
+
+// Names returns the names of the stored secrets, sorted
+func (v *Vault) Names() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the secrets and writes them to the vault's file, readable
+// by its owner only
+func (v *Vault) Save() error {
+	v.mu.Lock()
+	plain, err := json.Marshal(v.secrets)
+	v.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("saving vault: %w", err)
+	}
+
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vaultFile{
+		Version:    vaultVersion,
+		Iterations: v.iterations,
+		Salt:       v.salt,
+		Nonce:      nonce,
+		Data:       gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("saving vault: %w", err)
+	}
+
+	// Write then rename so a crash never leaves a half-written file
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving vault: %w", err)
+	}
+	return os.Rename(tmp, v.path)
+}
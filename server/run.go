@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/internal/state"
+)
+
+// CanceledAction is the action a canceled run transitions on. A flow may
+// route it to a cleanup node; otherwise the run ends.
+const CanceledAction = "canceled"
+
+// Status is the state of a run
+type Status string
+
+// Run statuses
+const (
+	Running   Status = "running"
+	Completed Status = "completed"
+	Failed    Status = "failed"
+	Canceled  Status = "canceled"
+	Suspended Status = "suspended"
+)
+
+// Info describes a run. Node is the node a suspended run is waiting at.
+type Info struct {
+	ID         string     `json:"id"`
+	Flow       string     `json:"flow"`
+	Status     Status     `json:"status"`
+	Action     string     `json:"action,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Node       string     `json:"node,omitempty"`
+	Events     int        `json:"events"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Result is a finished run with its final shared state. Values that cannot
+// be encoded as JSON, such as clients, are left out of Shared.
+type Result struct {
+	Info
+	Shared map[string]interface{} `json:"shared"`
+}
+
+// Run is one execution of a registered flow
+type Run struct {
+	id     string
+	flow   string
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	status   Status
+	action   string
+	err      string
+	canceled bool
+	shared   map[string]interface{}
+	events   []agent.Event
+	// changed is closed and replaced whenever an event is recorded
+	changed  chan struct{}
+	started  time.Time
+	finished time.Time
+	// suspension is where a suspended run stopped
+	suspension *agent.Suspension
+}
+
+func newRun(flow string, shared map[string]interface{}, cancel context.CancelFunc) *Run {
+	return &Run{
+		id:      state.NewID(),
+		flow:    flow,
+		cancel:  cancel,
+		status:  Running,
+		shared:  shared,
+		changed: make(chan struct{}),
+		started: time.Now(),
+	}
+}
+
+// ID returns the run's identifier
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Info returns the current state of the run
+func (r *Run) Info() Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.info()
+}
+
+func (r *Run) info() Info {
+	info := Info{
+		ID:        r.id,
+		Flow:      r.flow,
+		Status:    r.status,
+		Action:    r.action,
+		Error:     r.err,
+		Events:    len(r.events),
+		StartedAt: r.started,
+	}
+	if r.suspension != nil {
+		info.Node = r.suspension.Node
+	}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		info.FinishedAt = &finished
+	}
+	return info
+}
+
+// Result returns the run's result, or false while it is still running
+func (r *Run) Result() (*Result, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status == Running {
+		return nil, false
+	}
+	return &Result{Info: r.info(), Shared: state.Encodable(r.shared)}, true
+}
+
+// Cancel asks the run to stop. The context given to its nodes is canceled
+// and, once the current node returns, the flow transitions on
+// CanceledAction. Cancel reports false when the run has already finished.
+func (r *Run) Cancel() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != Running {
+		return false
+	}
+	r.canceled = true
+	r.cancel()
+	return true
+}
+
+// Events returns the events recorded from index from on, whether the run has
+// finished, and a channel that is closed when more events are recorded
+func (r *Run) Events(from int) ([]agent.Event, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []agent.Event
+	if from < len(r.events) {
+		events = append(events, r.events[from:]...)
+	}
+	return events, r.status != Running, r.changed
+}
+
+// record stores an event and, for the last event of the run, its outcome
+func (r *Run) record(ev agent.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	switch ev.Type {
+	case agent.FlowCompleted, agent.FlowFailed:
+		r.finish(ev)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *Run) finish(ev agent.Event) {
+	r.finished = ev.Time
+	r.action = ev.Action
+	r.err = ev.Error
+	switch {
+	case r.canceled:
+		r.status = Canceled
+	case ev.Type == agent.FlowFailed:
+		r.status = Failed
+	case ev.Action == "suspended":
+		r.status = Suspended
+		r.suspension, _ = ev.Result.(*agent.Suspension)
+	default:
+		r.status = Completed
+	}
+	r.cancel()
+}
+
+// Suspension returns where a suspended run stopped, or nil when the run is
+// not suspended
+func (r *Run) Suspension() *agent.Suspension {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != Suspended {
+		return nil
+	}
+	return r.suspension
+}
+
+// reopen marks a run suspended at s as running again, with cancel canceling
+// its new context. It reports false when the run was resumed meanwhile.
+func (r *Run) reopen(s *agent.Suspension, cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != Suspended || r.suspension != s {
+		return false
+	}
+	r.status = Running
+	r.cancel = cancel
+	r.suspension = nil
+	r.action = ""
+	r.err = ""
+	r.finished = time.Time{}
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return true
+}
+
+// cancelHook redirects a canceled run on CanceledAction once, after the node
+// running at the time, so that a cleanup node reached by it can still run
+type cancelHook struct {
+	ctx   context.Context
+	fired bool
+}
+
+func (h *cancelHook) BeforeNode(name string, shared map[string]interface{}) string {
+	return ""
+}
+
+func (h *cancelHook) AfterNode(name string, shared map[string]interface{}, action string) string {
+	if h.fired || h.ctx.Err() == nil {
+		return action
+	}
+	h.fired = true
+	return CanceledAction
+}
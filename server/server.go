@@ -0,0 +1,397 @@
+// Package server exposes flows over HTTP so that other programs, such as a
+// web frontend, can run agents without Go glue code.
+//
+// Flows are registered by name with a Factory that builds a new Flow for
+// every run. The API is JSON over REST, with execution events streamed as
+// Server-Sent Events:
+//
+//	GET  /flows                list the registered flows
+//	POST /flows/{name}/runs    start a run; the body is the shared input
+//	GET  /runs                 list runs
+//	GET  /runs/{id}            poll the status of a run
+//	GET  /runs/{id}/result     fetch the final shared state of a run
+//	POST /runs/{id}/cancel     cancel a run
+//	POST /runs/{id}/resume     resume a suspended run with an action
+//	GET  /runs/{id}/events     stream the events of a run
+//
+// Runs are kept in memory for Retention after they finish.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+const (
+	// DefaultContextKey is the shared key of a run's context
+	DefaultContextKey = "ctx"
+	// DefaultRetention is how long finished runs are kept
+	DefaultRetention = time.Hour
+	// maxBodyBytes caps the size of a run's JSON input
+	maxBodyBytes = 1 << 20
+)
+
+// ErrUnknownFlow is returned when no flow is registered under a name
+var ErrUnknownFlow = errors.New("server: unknown flow")
+
+// ErrNotSuspended is returned when resuming a run that is not suspended
+var ErrNotSuspended = errors.New("server: run is not suspended")
+
+// Factory builds a new Flow for every run. Each call must return fresh nodes,
+// since a run registers hooks and observers on its flow.
+type Factory func() *agent.Flow
+
+// Server runs registered flows and serves the HTTP API. It implements
+// http.Handler.
+type Server struct {
+	// Prepare, when set, is called before every run to add values that
+	// cannot be sent as JSON, such as LLM clients, to the shared input. An
+	// error rejects the run.
+	Prepare func(ctx context.Context, flow string, shared map[string]interface{}) error
+	// ContextKey names the shared key that receives the run's context,
+	// which is canceled when the run is canceled
+	ContextKey string
+	// Retention is how long finished runs are kept
+	Retention time.Duration
+
+	mu        sync.Mutex
+	factories map[string]Factory
+	runs      map[string]*Run
+	mux       *http.ServeMux
+}
+
+// New creates a Server with no registered flows
+func New() *Server {
+	s := &Server{
+		ContextKey: DefaultContextKey,
+		Retention:  DefaultRetention,
+		factories:  make(map[string]Factory),
+		runs:       make(map[string]*Run),
+		mux:        http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /flows", s.handleFlows)
+	s.mux.HandleFunc("POST /flows/{name}/runs", s.handleStart)
+	s.mux.HandleFunc("GET /runs", s.handleRuns)
+	s.mux.HandleFunc("GET /runs/{id}", s.handleStatus)
+	s.mux.HandleFunc("GET /runs/{id}/result", s.handleResult)
+	s.mux.HandleFunc("POST /runs/{id}/cancel", s.handleCancel)
+	s.mux.HandleFunc("POST /runs/{id}/resume", s.handleResume)
+	s.mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+	return s
+}
+
+// Register makes a flow available under name, replacing any flow already
+// registered under it
+func (s *Server) Register(name string, factory Factory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.factories[name] = factory
+}
+
+// Flows returns the names of the registered flows, sorted
+func (s *Server) Flows() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.factories))
+	for name := range s.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start runs the flow registered under name in the background with shared
+// as its input
+func (s *Server) Start(name string, shared map[string]interface{}) (*Run, error) {
+	s.mu.Lock()
+	factory, ok := s.factories[name]
+	s.prune()
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFlow, name)
+	}
+
+	if shared == nil {
+		shared = make(map[string]interface{})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if s.ContextKey != "" {
+		shared[s.ContextKey] = ctx
+	}
+	if s.Prepare != nil {
+		if err := s.Prepare(ctx, name, shared); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	flow := factory()
+	flow.Use(&cancelHook{ctx: ctx})
+	run := newRun(name, shared, cancel)
+
+	s.mu.Lock()
+	s.runs[run.id] = run
+	s.mu.Unlock()
+
+	events := flow.RunStream(shared, agent.StreamOptions{Buffer: 64})
+	go func() {
+		for ev := range events {
+			run.record(ev)
+		}
+	}()
+	return run, nil
+}
+
+// Resume continues a suspended run in the background on a new flow from its
+// factory, transitioning on action from the node it is waiting at. The run
+// keeps its ID, shared state and events, and gets a new context.
+func (s *Server) Resume(run *Run, action string) error {
+	suspension := run.Suspension()
+	if suspension == nil {
+		return fmt.Errorf("%w: %s", ErrNotSuspended, run.id)
+	}
+	s.mu.Lock()
+	factory, ok := s.factories[run.flow]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlow, run.flow)
+	}
+	flow := factory()
+	if flow.Locate(suspension.Path, suspension.Node) == nil {
+		return fmt.Errorf("server: node %q not found in flow %q", suspension.Node, run.flow)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if !run.reopen(suspension, cancel) {
+		cancel()
+		return fmt.Errorf("%w: %s", ErrNotSuspended, run.id)
+	}
+	if s.ContextKey != "" {
+		run.shared[s.ContextKey] = ctx
+	}
+	flow.Use(&cancelHook{ctx: ctx})
+	flow.Observe(run.record)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err := fmt.Errorf("flow panicked: %v", r)
+				run.record(agent.Event{Type: agent.FlowFailed, Time: time.Now(), Flow: agent.NodeName(flow), Error: err.Error(), Result: err})
+			}
+		}()
+		flow.ResumeSuspension(run.shared, suspension, action)
+	}()
+	return nil
+}
+
+// Lookup returns the run with the given ID
+func (s *Server) Lookup(id string) (*Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	return run, ok
+}
+
+// prune forgets runs that finished more than Retention ago. s.mu must be held.
+func (s *Server) prune() {
+	if s.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.Retention)
+	for id, run := range s.runs {
+		info := run.Info()
+		if info.FinishedAt != nil && info.FinishedAt.Before(cutoff) {
+			delete(s.runs, id)
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleFlows(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"flows": s.Flows()})
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	shared := make(map[string]interface{})
+	body := http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := json.NewDecoder(body).Decode(&shared); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding shared input: %w", err))
+		return
+	}
+
+	run, err := s.Start(r.PathValue("name"), shared)
+	if errors.Is(err, ErrUnknownFlow) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/runs/"+run.id)
+	writeJSON(w, http.StatusAccepted, run.Info())
+}
+
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runs := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+
+	infos := make([]Info, len(runs))
+	for i, run := range runs {
+		infos[i] = run.Info()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.Before(infos[j].StartedAt) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"runs": infos})
+}
+
+// lookup returns the run named in the request path, or writes a 404
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*Run, bool) {
+	run, ok := s.Lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %q not found", r.PathValue("id")))
+	}
+	return run, ok
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if run, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, run.Info())
+	}
+}
+
+func (s *Server) handleResult(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	result, done := run.Result()
+	if !done {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %q is still running", run.id))
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if !run.Cancel() {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %q has already finished", run.id))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.Info())
+}
+
+// resumeRequest is the body of a resume request
+type resumeRequest struct {
+	Action string `json:"action"`
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	var req resumeRequest
+	body := http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := json.NewDecoder(body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding resume request: %w", err))
+		return
+	}
+	if req.Action == "" {
+		writeError(w, http.StatusBadRequest, errors.New("resume request has no action"))
+		return
+	}
+
+	err := s.Resume(run, req.Action)
+	if errors.Is(err, ErrNotSuspended) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.Info())
+}
+
+// handleEvents streams a run's events, from the first one or the one after
+// Last-Event-ID, until the run finishes or the client goes away
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	next := 0
+	if last, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = last + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		events, done, changed := run.Events(next)
+		for _, ev := range events {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("Warning: encoding event of run %s: %v", run.id, err)
+				data = []byte("{}")
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, ev.Type, data); err != nil {
+				return
+			}
+			next++
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: encoding response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// greetNode writes a greeting for shared["name"]
+type greetNode struct {
+	*agent.BaseNode
+}
+
+func (g *greetNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["greeting"] = "Hello, " + shared["name"].(string)
+	return "done"
+}
+
+// waitNode blocks until the run's context is canceled
+type waitNode struct {
+	*agent.BaseNode
+	started chan struct{}
+}
+
+func (n *waitNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	close(n.started)
+	<-shared[DefaultContextKey].(context.Context).Done()
+	return "done"
+}
+
+// cleanupNode records that a canceled run was cleaned up
+type cleanupNode struct {
+	*agent.BaseNode
+}
+
+func (c *cleanupNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	shared["cleaned"] = true
+	return nil
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func waitFor(t *testing.T, srv *httptest.Server, id string, status Status) Info {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var info Info
+		do(t, srv, "GET", "/runs/"+id, "", &info)
+		if info.Status == status {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run status = %q, want %q", info.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer_RunLifecycle(t *testing.T) {
+	s := New()
+	s.Register("greet", func() *agent.Flow { return agent.NewFlow(&greetNode{BaseNode: agent.NewBaseNode()}) })
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var flows struct{ Flows []string }
+	do(t, srv, "GET", "/flows", "", &flows)
+	if len(flows.Flows) != 1 || flows.Flows[0] != "greet" {
+		t.Errorf("flows = %v", flows.Flows)
+	}
+
+	if code := do(t, srv, "POST", "/flows/missing/runs", "{}", nil); code != http.StatusNotFound {
+		t.Errorf("unknown flow status = %d, want 404", code)
+	}
+	if code := do(t, srv, "POST", "/flows/greet/runs", "{not json", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid input status = %d, want 400", code)
+	}
+
+	var started Info
+	if code := do(t, srv, "POST", "/flows/greet/runs", `{"name": "Ada"}`, &started); code != http.StatusAccepted {
+		t.Fatalf("start status = %d, want 202", code)
+	}
+	info := waitFor(t, srv, started.ID, Completed)
+	if info.Action != "done" || info.FinishedAt == nil {
+		t.Errorf("info = %+v", info)
+	}
+
+	var result Result
+	if code := do(t, srv, "GET", "/runs/"+started.ID+"/result", "", &result); code != http.StatusOK {
+		t.Fatalf("result status = %d, want 200", code)
+	}
+	if result.Shared["greeting"] != "Hello, Ada" {
+		t.Errorf("shared = %v", result.Shared)
+	}
+	if _, ok := result.Shared[DefaultContextKey]; ok {
+		t.Error("the run's context was returned in the result")
+	}
+
+	if code := do(t, srv, "POST", "/runs/"+started.ID+"/cancel", "", nil); code != http.StatusConflict {
+		t.Errorf("cancel of a finished run status = %d, want 409", code)
+	}
+}
+
+func TestServer_StreamsEvents(t *testing.T) {
+	s := New()
+	s.Register("greet", func() *agent.Flow { return agent.NewFlow(&greetNode{BaseNode: agent.NewBaseNode()}) })
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	run, err := s.Start("greet", map[string]interface{}{"name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(srv.URL + "/runs/" + run.ID() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			types = append(types, name)
+		}
+	}
+	want := "flow_started node_started exec_attempt node_completed flow_completed"
+	if strings.Join(types, " ") != want {
+		t.Errorf("events = %v, want %s", types, want)
+	}
+}
+
+func TestServer_CancelRun(t *testing.T) {
+	wait := &waitNode{BaseNode: agent.NewBaseNode(), started: make(chan struct{})}
+	cleanup := &cleanupNode{BaseNode: agent.NewBaseNode()}
+	wait.Next(cleanup, CanceledAction)
+
+	s := New()
+	s.Register("wait", func() *agent.Flow { return agent.NewFlow(wait) })
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var started Info
+	do(t, srv, "POST", "/flows/wait/runs", "", &started)
+	<-wait.started
+
+	if code := do(t, srv, "GET", "/runs/"+started.ID+"/result", "", nil); code != http.StatusConflict {
+		t.Errorf("result of a running run status = %d, want 409", code)
+	}
+	if code := do(t, srv, "POST", "/runs/"+started.ID+"/cancel", "", nil); code != http.StatusAccepted {
+		t.Fatalf("cancel status = %d, want 202", code)
+	}
+	waitFor(t, srv, started.ID, Canceled)
+
+	var result Result
+	do(t, srv, "GET", "/runs/"+started.ID+"/result", "", &result)
+	if result.Shared["cleaned"] != true {
+		t.Errorf("cleanup node did not run: %v", result.Shared)
+	}
+}
+
+// reviewNode suspends its flow until a reviewer decides
+type reviewNode struct {
+	*agent.BaseNode
+}
+
+func (n *reviewNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	return &agent.Suspension{Reason: "needs review"}
+}
+
+func TestServer_ResumeRun(t *testing.T) {
+	s := New()
+	s.Register("review", func() *agent.Flow {
+		review := &reviewNode{BaseNode: agent.NewBaseNode()}
+		review.SetName("review")
+		review.Next(&greetNode{BaseNode: agent.NewBaseNode()}, "approve")
+		return agent.NewFlow(review)
+	})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var started Info
+	do(t, srv, "POST", "/flows/review/runs", `{"name": "Ada"}`, &started)
+	info := waitFor(t, srv, started.ID, Suspended)
+	if info.Node != "review" {
+		t.Errorf("suspended node = %q, want review", info.Node)
+	}
+
+	if code := do(t, srv, "POST", "/runs/"+started.ID+"/resume", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("resume without an action status = %d, want 400", code)
+	}
+	if code := do(t, srv, "POST", "/runs/"+started.ID+"/resume", `{"action": "approve"}`, nil); code != http.StatusAccepted {
+		t.Fatalf("resume status = %d, want 202", code)
+	}
+	info = waitFor(t, srv, started.ID, Completed)
+	if info.Action != "done" || info.Node != "" {
+		t.Errorf("info = %+v", info)
+	}
+
+	var result Result
+	do(t, srv, "GET", "/runs/"+started.ID+"/result", "", &result)
+	if result.Shared["greeting"] != "Hello, Ada" {
+		t.Errorf("shared = %v", result.Shared)
+	}
+	if code := do(t, srv, "POST", "/runs/"+started.ID+"/resume", `{"action": "approve"}`, nil); code != http.StatusConflict {
+		t.Errorf("resume of a completed run status = %d, want 409", code)
+	}
+}
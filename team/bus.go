@@ -0,0 +1,142 @@
+package team
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kind is the type of a Message
+type Kind string
+
+// Kinds of messages exchanged by a team
+const (
+	// Task delegates a sub-task from the supervisor to a worker
+	Task Kind = "task"
+	// Result carries a worker's result for a task
+	Result Kind = "result"
+	// Failure reports that a worker could not complete a task
+	Failure Kind = "failure"
+	// Done carries the supervisor's final answer
+	Done Kind = "done"
+)
+
+// Message is what the supervisor and its workers send each other
+type Message struct {
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+	// TaskID links a result or a failure to its task
+	TaskID  string `json:"task_id,omitempty"`
+	Content string `json:"content"`
+	// Data is the result as the worker's flow wrote it, when it is not text
+	Data interface{} `json:"data,omitempty"`
+	At   time.Time   `json:"at"`
+}
+
+func (m Message) String() string {
+	if m.To != "" {
+		return fmt.Sprintf("[%s] %s -> %s: %s", m.Kind, m.From, m.To, m.Content)
+	}
+	return fmt.Sprintf("[%s] %s: %s", m.Kind, m.From, m.Content)
+}
+
+// Handler receives the messages published on a Bus
+type Handler func(Message)
+
+type subscription struct {
+	kinds   []Kind
+	handler Handler
+}
+
+// Bus records the messages of one team run in order and passes them on to
+// its subscribers. It is safe for concurrent use.
+type Bus struct {
+	mu       sync.Mutex
+	messages []Message
+	subs     []subscription
+}
+
+// NewBus creates an empty Bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Publish assigns the message an ID and a time, records it and calls the
+// subscribers for its kind. It returns the recorded message.
+func (b *Bus) Publish(msg Message) Message {
+	b.mu.Lock()
+	msg.ID = fmt.Sprintf("m%d", len(b.messages)+1)
+	if msg.At.IsZero() {
+		msg.At = time.Now()
+	}
+	b.messages = append(b.messages, msg)
+	var handlers []Handler
+	for _, sub := range b.subs {
+		if len(sub.kinds) == 0 || slices.Contains(sub.kinds, msg.Kind) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.Unlock()
+
+	// Call the handlers unlocked, so that they may publish in turn
+	for _, h := range handlers {
+		h(msg)
+	}
+	return msg
+}
+
+// Subscribe calls h with every message of the given kinds published from
+// now on, or with every message when no kind is given
+func (b *Bus) Subscribe(h Handler, kinds ...Kind) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, subscription{kinds: kinds, handler: h})
+}
+
+// Messages returns the recorded messages of the given kinds, or all of
+// them, oldest first
+func (b *Bus) Messages(kinds ...Kind) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []Message
+	for _, msg := range b.messages {
+		if len(kinds) == 0 || slices.Contains(kinds, msg.Kind) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// Pending returns the tasks that have neither a result nor a failure yet,
+// oldest first
+func (b *Bus) Pending() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	answered := make(map[string]bool)
+	for _, msg := range b.messages {
+		if msg.Kind == Result || msg.Kind == Failure {
+			answered[msg.TaskID] = true
+		}
+	}
+	var out []Message
+	for _, msg := range b.messages {
+		if msg.Kind == Task && !answered[msg.ID] {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// MarshalJSON encodes the recorded messages, so that a bus kept in the
+// shared state shows up in traces and run records
+func (b *Bus) MarshalJSON() ([]byte, error) {
+	messages := b.Messages()
+	if messages == nil {
+		messages = []Message{}
+	}
+	return json.Marshal(messages)
+}
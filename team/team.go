@@ -0,0 +1,449 @@
+// Package team composes agent flows into a team: a Supervisor that splits a
+// task into sub-tasks and Workers that carry them out.
+//
+// Each Worker wraps an ordinary flow. The Supervisor delegates to a worker by
+// returning the worker's name as its action, and every worker returns to the
+// supervisor on ReportAction, so a team is a plain agent.Flow:
+//
+//	sup := team.NewSupervisor(team.NewModelPlanner(model), 2)
+//	sup.Delegate("researcher", "Answers factual questions", researchFlow)
+//	sup.Delegate("writer", "Writes prose from notes", writerFlow)
+//	flow := agent.NewFlow(sup)
+//
+// The supervisor and its workers talk through a Bus kept in the shared
+// state. The supervisor publishes Task messages; each worker runs its flow
+// on the task and publishes a Result or a Failure. Whenever no task is
+// pending, a Planner reads the messages so far and either delegates more
+// tasks or ends the run with the final answer on DoneAction.
+package team
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// Actions of a team
+const (
+	// DoneAction is returned by the supervisor once the planner has answered
+	DoneAction = "done"
+	// ReportAction leads from every worker back to the supervisor
+	ReportAction = "report"
+)
+
+// Default settings of a Supervisor and its Workers
+const (
+	DefaultGoalKey   = "task"
+	DefaultAnswerKey = "answer"
+	DefaultBusKey    = "team_bus"
+	DefaultRoundKey  = "team_round"
+	DefaultMaxRounds = 10
+	// DefaultTaskKey and DefaultResultKey are the keys of a worker's flow
+	// that receive its task and hold its result
+	DefaultTaskKey   = "task"
+	DefaultResultKey = "result"
+)
+
+var (
+	// ErrInvalidPlan wraps the errors of plans the supervisor cannot follow
+	ErrInvalidPlan = errors.New("team: invalid plan")
+	// ErrTooManyRounds is returned when the planner has not answered after
+	// the supervisor's MaxRounds
+	ErrTooManyRounds = errors.New("team: too many rounds")
+)
+
+// WorkerInfo describes a worker to the planner
+type WorkerInfo struct {
+	Name        string
+	Description string
+}
+
+// State is what the planner decides on
+type State struct {
+	Goal    string
+	Workers []WorkerInfo
+	// Messages are the messages of the run so far, oldest first
+	Messages []Message
+	// Round counts the planner's decisions so far, from 1 for the first
+	Round     int
+	MaxRounds int
+}
+
+// Assignment delegates a sub-task to a worker
+type Assignment struct {
+	Worker string `json:"worker"`
+	Task   string `json:"task"`
+}
+
+// Plan is the planner's decision: either more tasks, or the final answer
+type Plan struct {
+	Tasks     []Assignment `json:"tasks,omitempty"`
+	Done      bool         `json:"done"`
+	Answer    string       `json:"answer,omitempty"`
+	Rationale string       `json:"rationale,omitempty"`
+}
+
+// Planner decides the supervisor's next step
+type Planner interface {
+	Plan(ctx context.Context, state State) (Plan, error)
+}
+
+// PlannerFunc adapts a function to the Planner interface
+type PlannerFunc func(ctx context.Context, state State) (Plan, error)
+
+// Plan calls f(ctx, state)
+func (f PlannerFunc) Plan(ctx context.Context, state State) (Plan, error) {
+	return f(ctx, state)
+}
+
+// Supervisor delegates the task in shared[GoalKey] to its workers until its
+// Planner has an answer, which it stores in shared[AnswerKey] before
+// returning DoneAction. Plans the supervisor cannot follow are retried like
+// failed Exec calls. When the planner keeps failing, or has not answered
+// after MaxRounds decisions, the supervisor sets shared["error"] and returns
+// "error".
+//
+// Hooks registered on the team's flow run for the supervisor and the
+// workers, not for the nodes of the workers' flows.
+type Supervisor struct {
+	*agent.Node
+
+	Planner   Planner
+	GoalKey   string
+	AnswerKey string
+	// BusKey holds the run's Bus in the shared state; a new Bus is created
+	// when there is none
+	BusKey    string
+	RoundKey  string
+	MaxRounds int
+	// OnMessage, when set, is subscribed to the Bus of every run, for
+	// example to log the conversation
+	OnMessage Handler
+	// CtxKey optionally names a shared context.Context for the planner
+	CtxKey string
+
+	workers []*Worker
+}
+
+// NewSupervisor creates a Supervisor that asks planner up to maxRetries
+// times for a plan it can follow
+func NewSupervisor(planner Planner, maxRetries int) *Supervisor {
+	return &Supervisor{
+		Node:      agent.NewNode(maxRetries, 0),
+		Planner:   planner,
+		GoalKey:   DefaultGoalKey,
+		AnswerKey: DefaultAnswerKey,
+		BusKey:    DefaultBusKey,
+		RoundKey:  DefaultRoundKey,
+		MaxRounds: DefaultMaxRounds,
+	}
+}
+
+// Delegate adds a worker named name that runs flow on its tasks, and wires
+// it to the supervisor. The description tells the planner what the worker
+// is good at. Delegate panics if the name is taken or is one of the
+// supervisor's own actions.
+func (s *Supervisor) Delegate(name, description string, flow *agent.Flow) *Worker {
+	if name == "" || name == DoneAction || name == "error" {
+		panic(fmt.Sprintf("team: %q cannot name a worker", name))
+	}
+	if s.Worker(name) != nil {
+		panic(fmt.Sprintf("team: worker %q already exists", name))
+	}
+	w := NewWorker(flow)
+	w.SetName(name)
+	w.Description = description
+	w.BusKey = s.BusKey
+	s.workers = append(s.workers, w)
+	s.Next(w, name)
+	w.Next(s, ReportAction)
+	return w
+}
+
+// Worker returns the worker named name, or nil
+func (s *Supervisor) Worker(name string) *Worker {
+	for _, w := range s.workers {
+		if w.Name() == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// Workers describes the supervisor's workers, in the order they were added
+func (s *Supervisor) Workers() []WorkerInfo {
+	infos := make([]WorkerInfo, len(s.workers))
+	for i, w := range s.workers {
+		infos[i] = WorkerInfo{Name: w.Name(), Description: w.Description}
+	}
+	return infos
+}
+
+type supervisorInput struct {
+	ctx     context.Context
+	bus     *Bus
+	state   State
+	pending []Message
+}
+
+// Prep gets the run's Bus and collects the state for the planner
+func (s *Supervisor) Prep(shared map[string]interface{}) interface{} {
+	bus, ok := shared[s.BusKey].(*Bus)
+	if !ok {
+		bus = NewBus()
+		if s.OnMessage != nil {
+			bus.Subscribe(s.OnMessage)
+		}
+		shared[s.BusKey] = bus
+	}
+	in := supervisorInput{ctx: context.Background(), bus: bus, pending: bus.Pending()}
+	if ctx, ok := shared[s.CtxKey].(context.Context); ok && s.CtxKey != "" {
+		in.ctx = ctx
+	}
+	in.state = State{
+		Goal:      fmt.Sprint(shared[s.GoalKey]),
+		Workers:   s.Workers(),
+		Messages:  bus.Messages(),
+		Round:     rounds(shared[s.RoundKey]) + 1,
+		MaxRounds: s.MaxRounds,
+	}
+	return in
+}
+
+// rounds reads the round counter, which is a float64 once the shared state
+// has been through JSON
+func rounds(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// Exec asks the planner for the next step, unless tasks are still pending.
+// Plans that cannot be followed panic, which the flow counts as a failed
+// attempt, so that they are retried.
+func (s *Supervisor) Exec(prepRes interface{}) interface{} {
+	in := prepRes.(supervisorInput)
+	if len(in.pending) > 0 {
+		return nil
+	}
+	if in.state.Round > s.MaxRounds {
+		return fmt.Errorf("%w: no answer after %d rounds", ErrTooManyRounds, s.MaxRounds)
+	}
+	if s.Planner == nil {
+		panic(errors.New("team: no planner"))
+	}
+	plan, err := s.Planner.Plan(in.ctx, in.state)
+	if err != nil {
+		panic(fmt.Errorf("team: planning: %w", err))
+	}
+	if err := s.check(plan); err != nil {
+		panic(err)
+	}
+	return plan
+}
+
+// check reports why the supervisor cannot follow plan
+func (s *Supervisor) check(plan Plan) error {
+	if plan.Done {
+		return nil
+	}
+	if len(plan.Tasks) == 0 {
+		return fmt.Errorf("%w: no tasks and no answer", ErrInvalidPlan)
+	}
+	for _, a := range plan.Tasks {
+		if s.Worker(a.Worker) == nil {
+			return fmt.Errorf("%w: unknown worker %q", ErrInvalidPlan, a.Worker)
+		}
+		if strings.TrimSpace(a.Task) == "" {
+			return fmt.Errorf("%w: empty task for %s", ErrInvalidPlan, a.Worker)
+		}
+	}
+	return nil
+}
+
+// Post follows the plan: it publishes the answer and returns DoneAction, or
+// publishes the tasks and returns the name of the worker of the oldest
+// pending task
+func (s *Supervisor) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	in := prepRes.(supervisorInput)
+	name := agent.NodeName(s)
+	switch res := execRes.(type) {
+	case nil:
+	case Plan:
+		shared[s.RoundKey] = in.state.Round
+		if res.Done {
+			log.Printf("%s finished after %d rounds%s", name, in.state.Round, rationale(res))
+			in.bus.Publish(Message{Kind: Done, From: name, Content: res.Answer})
+			shared[s.AnswerKey] = res.Answer
+			return DoneAction
+		}
+		log.Printf("%s delegated %d tasks%s", name, len(res.Tasks), rationale(res))
+		for _, a := range res.Tasks {
+			in.bus.Publish(Message{Kind: Task, From: name, To: a.Worker, Content: a.Task})
+		}
+	case error:
+		log.Printf("Warning: supervisor %s failed: %v", name, res)
+		shared["error"] = res.Error()
+		return "error"
+	default:
+		shared["error"] = fmt.Sprintf("supervisor %s: unexpected result %T", name, execRes)
+		return "error"
+	}
+	return in.bus.Pending()[0].To
+}
+
+func rationale(plan Plan) string {
+	if plan.Rationale == "" {
+		return ""
+	}
+	return ": " + plan.Rationale
+}
+
+// Worker runs its flow on the tasks the supervisor delegates to it. The flow
+// gets its own shared map, holding the task in TaskKey, the run's Bus in
+// BusKey, the keys the Worker reads and its fixed values. When the flow is
+// done, the Worker publishes shared[ResultKey] as a Result, or a Failure if
+// the flow ended on "error", set shared["error"], panicked or left no
+// result, and returns ReportAction.
+type Worker struct {
+	*agent.Node
+
+	Flow        *agent.Flow
+	Description string
+	TaskKey     string
+	ResultKey   string
+	BusKey      string
+
+	reads  []string
+	values map[string]interface{}
+}
+
+// NewWorker creates a Worker for flow. Supervisor.Delegate creates and wires
+// workers; NewWorker is for wiring them by hand.
+func NewWorker(flow *agent.Flow) *Worker {
+	return &Worker{
+		Node:      agent.NewNode(1, 0),
+		Flow:      flow,
+		TaskKey:   DefaultTaskKey,
+		ResultKey: DefaultResultKey,
+		BusKey:    DefaultBusKey,
+		values:    make(map[string]interface{}),
+	}
+}
+
+// Reads copies the given keys of the team's shared state into the worker's
+// flow, such as a model client or a context
+func (w *Worker) Reads(keys ...string) *Worker {
+	w.reads = append(w.reads, keys...)
+	return w
+}
+
+// With sets key to value in the worker's flow for every task
+func (w *Worker) With(key string, value interface{}) *Worker {
+	w.values[key] = value
+	return w
+}
+
+type workerRun struct {
+	bus    *Bus
+	task   Message
+	scope  map[string]interface{}
+	action interface{}
+}
+
+// Prep picks the worker's oldest pending task and builds the flow's shared
+// map
+func (w *Worker) Prep(shared map[string]interface{}) interface{} {
+	bus, ok := shared[w.BusKey].(*Bus)
+	if !ok {
+		return nil
+	}
+	run := &workerRun{bus: bus}
+	for _, task := range bus.Pending() {
+		if task.To == agent.NodeName(w) {
+			run.task = task
+			break
+		}
+	}
+	if run.task.ID == "" {
+		return run
+	}
+	run.scope = make(map[string]interface{}, len(w.reads)+len(w.values)+2)
+	for _, k := range w.reads {
+		if v, ok := shared[k]; ok {
+			run.scope[k] = v
+		}
+	}
+	for k, v := range w.values {
+		run.scope[k] = v
+	}
+	run.scope[w.TaskKey] = run.task.Content
+	run.scope[w.BusKey] = bus
+	return run
+}
+
+// Exec runs the flow on the task
+func (w *Worker) Exec(prepRes interface{}) interface{} {
+	run, ok := prepRes.(*workerRun)
+	if !ok {
+		return fmt.Errorf("worker %s: no team bus in the shared state", agent.NodeName(w))
+	}
+	if run.scope == nil {
+		return fmt.Errorf("worker %s: no pending task", agent.NodeName(w))
+	}
+	run.action = w.Flow.Run(run.scope)
+	return run
+}
+
+// Post publishes the outcome of the task and reports back to the supervisor
+func (w *Worker) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	name := agent.NodeName(w)
+	run, ok := execRes.(*workerRun)
+	if !ok {
+		err := fmt.Errorf("worker %s failed: %v", name, execRes)
+		log.Printf("Warning: %v", err)
+		// A panic in the flow still leaves a task to fail
+		run, _ = prepRes.(*workerRun)
+		if run == nil || run.task.ID == "" {
+			shared["error"] = err.Error()
+			return "error"
+		}
+		w.fail(run, err.Error())
+		return ReportAction
+	}
+
+	// Workers also fail when their flow set an error but moved on
+	_, err := agent.Outcome(run.action, run.scope)
+	if msg, failed := run.scope["error"]; failed && err == nil {
+		err = fmt.Errorf("%v", msg)
+	}
+	if err != nil {
+		w.fail(run, err.Error())
+		return ReportAction
+	}
+	result, ok := run.scope[w.ResultKey]
+	if !ok || result == nil {
+		w.fail(run, fmt.Sprintf("no result in %q", w.ResultKey))
+		return ReportAction
+	}
+	msg := Message{Kind: Result, From: name, To: run.task.From, TaskID: run.task.ID}
+	if text, ok := result.(string); ok {
+		msg.Content = text
+	} else {
+		msg.Content, msg.Data = fmt.Sprint(result), result
+	}
+	run.bus.Publish(msg)
+	return ReportAction
+}
+
+func (w *Worker) fail(run *workerRun, reason string) {
+	run.bus.Publish(Message{Kind: Failure, From: agent.NodeName(w), To: run.task.From, TaskID: run.task.ID, Content: reason})
+}
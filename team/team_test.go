@@ -0,0 +1,146 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/testkit"
+)
+
+// taskNode does its flow's task with fn
+type taskNode struct {
+	*agent.BaseNode
+	fn func(task string) (interface{}, error)
+}
+
+func workerFlow(fn func(task string) (interface{}, error)) *agent.Flow {
+	return agent.NewFlow(&taskNode{BaseNode: agent.NewBaseNode(), fn: fn})
+}
+
+func (n *taskNode) Prep(shared map[string]interface{}) interface{} {
+	return shared[DefaultTaskKey]
+}
+
+func (n *taskNode) Exec(prepRes interface{}) interface{} {
+	result, err := n.fn(prepRes.(string))
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (n *taskNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if err, ok := execRes.(error); ok {
+		shared["error"] = err.Error()
+		return "error"
+	}
+	shared[DefaultResultKey] = execRes
+	return "done"
+}
+
+func TestSupervisor_DelegatesUntilDone(t *testing.T) {
+	model := testkit.NewFakeModel()
+	model.On(`\[result\] writer`).Reply(`{"done": true, "answer": "Paris has 2.1 million people.", "rationale": "the draft answers it"}`)
+	model.On(`\(none yet\)`).Reply("```json\n" + `{"tasks": [
+		{"worker": "researcher", "task": "population of Paris"},
+		{"worker": "writer", "task": "one sentence on Paris"}
+	], "rationale": "research, then write"}` + "\n```")
+
+	sup := NewSupervisor(NewModelPlanner(model), 2)
+	var seen []Kind
+	sup.OnMessage = func(msg Message) { seen = append(seen, msg.Kind) }
+	sup.Delegate("researcher", "Looks up facts", workerFlow(func(task string) (interface{}, error) {
+		return map[string]int{"population": 2_100_000}, nil
+	}))
+	writer := sup.Delegate("writer", "Writes prose", workerFlow(func(task string) (interface{}, error) {
+		return "draft: " + task, nil
+	}))
+	writer.With(DefaultTaskKey, "overwritten by the task")
+
+	shared := map[string]interface{}{"task": "How many people live in Paris?"}
+	tr := testkit.AssertPath(t, agent.NewFlow(sup), shared, []string{"researcher", ReportAction, "writer", ReportAction})
+	tr.AssertNodes(t, []string{"Supervisor", "researcher", "Supervisor", "writer", "Supervisor"})
+
+	if shared["answer"] != "Paris has 2.1 million people." || shared[DefaultRoundKey] != 2 {
+		t.Fatalf("answer = %v after %v rounds", shared["answer"], shared[DefaultRoundKey])
+	}
+	bus := shared[DefaultBusKey].(*Bus)
+	results := bus.Messages(Result)
+	if len(results) != 2 || results[0].TaskID != "m1" || results[0].Data == nil || results[1].Content != "draft: one sentence on Paris" {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := strings.Join(kinds(bus.Messages()), " "); got != "task task result result done" || len(seen) != 5 {
+		t.Fatalf("messages = %s, subscriber saw %d", got, len(seen))
+	}
+	prompt := model.Calls()[1].Prompt
+	if !strings.Contains(prompt, "- researcher: Looks up facts") || !strings.Contains(prompt, "round 2 of at most 10") ||
+		!strings.Contains(prompt, `[result] researcher -> Supervisor: map[population:2100000]`) {
+		t.Fatalf("second prompt lacks the workers or results:\n%s", prompt)
+	}
+}
+
+func kinds(messages []Message) []string {
+	var out []string
+	for _, msg := range messages {
+		out = append(out, string(msg.Kind))
+	}
+	return out
+}
+
+func TestSupervisor_HandlesFailures(t *testing.T) {
+	calls := 0
+	planner := PlannerFunc(func(ctx context.Context, state State) (Plan, error) {
+		calls++
+		switch {
+		case calls == 1:
+			return Plan{Tasks: []Assignment{{Worker: "nobody", Task: "x"}}}, nil
+		case len(state.Messages) == 0:
+			return Plan{Tasks: []Assignment{{Worker: "flaky", Task: "x"}, {Worker: "panicky", Task: "y"}}}, nil
+		}
+		var failures []string
+		for _, msg := range state.Messages {
+			if msg.Kind == Failure {
+				failures = append(failures, msg.From+": "+msg.Content)
+			}
+		}
+		return Plan{Done: true, Answer: strings.Join(failures, "; ")}, nil
+	})
+	sup := NewSupervisor(planner, 2)
+	sup.Delegate("flaky", "Fails", workerFlow(func(string) (interface{}, error) {
+		return nil, errors.New("service down")
+	}))
+	sup.Delegate("panicky", "Panics", workerFlow(func(string) (interface{}, error) {
+		panic("boom")
+	}))
+
+	shared := map[string]interface{}{"task": "anything"}
+	if action := agent.NewFlow(sup).Run(shared); action != DoneAction {
+		t.Fatalf("action = %v, want done", action)
+	}
+	if calls != 3 {
+		t.Fatalf("planner calls = %d, want 3 with the invalid plan retried", calls)
+	}
+	if shared["answer"] != "flaky: service down; panicky: boom" {
+		t.Fatalf("answer = %q", shared["answer"])
+	}
+
+	// A planner that never finishes runs out of rounds
+	sup = NewSupervisor(PlannerFunc(func(ctx context.Context, state State) (Plan, error) {
+		return Plan{Tasks: []Assignment{{Worker: "echo", Task: "again"}}}, nil
+	}), 1)
+	sup.MaxRounds = 3
+	sup.Delegate("echo", "Echoes", workerFlow(func(task string) (interface{}, error) { return task, nil }))
+	shared = map[string]interface{}{"task": "loop"}
+	if action := agent.NewFlow(sup).Run(shared); action != "error" {
+		t.Fatalf("action = %v, want error", action)
+	}
+	if msg, _ := shared["error"].(string); !strings.Contains(msg, "no answer after 3 rounds") {
+		t.Fatalf("error = %v", shared["error"])
+	}
+	if n := len(shared[DefaultBusKey].(*Bus).Messages(Result)); n != 3 {
+		t.Fatalf("results = %d, want 3", n)
+	}
+}
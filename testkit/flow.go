@@ -0,0 +1,73 @@
+package testkit
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// Trace is the record of one flow run
+type Trace struct {
+	// Events are every event of the run, in order
+	Events []agent.Event
+	// Result is what the flow returned
+	Result interface{}
+}
+
+// Record runs flow with shared and records its events
+func Record(flow *agent.Flow, shared map[string]interface{}) *Trace {
+	tr := &Trace{}
+	defer flow.Observe(func(ev agent.Event) {
+		tr.Events = append(tr.Events, ev)
+	})()
+	tr.Result = flow.Run(shared)
+	return tr
+}
+
+// Path returns the actions the flow transitioned on, in order. The action
+// that ended the flow is not part of the path, since it leads nowhere.
+func (tr *Trace) Path() []string {
+	var path []string
+	for _, ev := range tr.Events {
+		if ev.Type == agent.Transition {
+			path = append(path, ev.Action)
+		}
+	}
+	return path
+}
+
+// Nodes returns the nodes that ran or were skipped, in order
+func (tr *Trace) Nodes() []string {
+	var nodes []string
+	for _, ev := range tr.Events {
+		if ev.Type == agent.NodeStarted || ev.Type == agent.NodeCompleted && ev.Skipped {
+			nodes = append(nodes, ev.Node)
+		}
+	}
+	return nodes
+}
+
+// AssertPath runs flow with shared and fails the test unless it transitions
+// on exactly the actions in want. It returns the trace for further checks.
+func AssertPath(t testing.TB, flow *agent.Flow, shared map[string]interface{}, want []string) *Trace {
+	t.Helper()
+	tr := Record(flow, shared)
+	if got := tr.Path(); !slices.Equal(got, want) {
+		t.Errorf("flow path = %s, want %s", format(got), format(want))
+	}
+	return tr
+}
+
+// AssertNodes fails the test unless the run visited exactly the nodes in want
+func (tr *Trace) AssertNodes(t testing.TB, want []string) {
+	t.Helper()
+	if got := tr.Nodes(); !slices.Equal(got, want) {
+		t.Errorf("flow nodes = %s, want %s", format(got), format(want))
+	}
+}
+
+func format(path []string) string {
+	return fmt.Sprintf("%q", path)
+}
@@ -0,0 +1,177 @@
+// Package testkit provides deterministic fakes and assertions for testing
+// nodes and flows without network access or API keys.
+//
+// FakeModel is a scripted llm.ChatModel that answers prompts matching regular
+// expressions with canned responses, FakeSearch is a search.Provider with
+// canned results, and AssertPath checks the exact route a flow takes:
+//
+//	model := testkit.NewFakeModel()
+//	model.On(`Decide the next action`).Reply(searchYAML, answerYAML)
+//	model.On(`Write the final answer`).Reply("Paris")
+//
+//	shared := map[string]interface{}{"question": "...", "llm": model}
+//	testkit.AssertPath(t, flow, shared, []string{"search", "decide", "answer"})
+//	model.AssertCalled(t, `Decide the next action`, 2)
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+	"github.com/utkarsh-cpu/go_agent/llm"
+)
+
+// ErrUnexpectedPrompt is returned for a prompt that no rule matches
+var ErrUnexpectedPrompt = errors.New("testkit: unexpected prompt")
+
+// reply is one scripted response
+type reply struct {
+	text string
+	err  error
+}
+
+// Rule answers the prompts matching its pattern. Successive calls receive
+// successive replies; the last reply is repeated once the others are used.
+type Rule struct {
+	pattern *regexp.Regexp
+	replies []reply
+	calls   int
+}
+
+// Reply appends text responses to the rule's script
+func (r *Rule) Reply(texts ...string) *Rule {
+	for _, text := range texts {
+		r.replies = append(r.replies, reply{text: text})
+	}
+	return r
+}
+
+// Fail appends an error response to the rule's script
+func (r *Rule) Fail(err error) *Rule {
+	r.replies = append(r.replies, reply{err: err})
+	return r
+}
+
+// Call is a prompt received by a FakeModel
+type Call struct {
+	Prompt string
+	// Pattern is the pattern of the rule that answered, or empty
+	Pattern string
+	Text    string
+	Err     error
+}
+
+// FakeModel is a scripted llm.ChatModel. Rules are tried in the order they
+// were added; a prompt no rule matches fails with ErrUnexpectedPrompt. It is
+// safe for concurrent use.
+type FakeModel struct {
+	// Name is reported as the model of every response
+	Name string
+
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+// NewFakeModel creates a FakeModel without rules
+func NewFakeModel() *FakeModel {
+	return &FakeModel{Name: "fake"}
+}
+
+// On adds a rule for the prompts matching pattern, a regular expression. It
+// panics if pattern does not compile, like regexp.MustCompile.
+func (m *FakeModel) On(pattern string) *Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := &Rule{pattern: regexp.MustCompile(pattern)}
+	m.rules = append(m.rules, r)
+	return r
+}
+
+// Generate implements llm.ChatModel. Usage is estimated with
+// contextbudget.HeuristicTokenizer.
+func (m *FakeModel) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	call := Call{Prompt: prompt}
+	for _, r := range m.rules {
+		if !r.pattern.MatchString(prompt) || len(r.replies) == 0 {
+			continue
+		}
+		next := r.replies[min(r.calls, len(r.replies)-1)]
+		r.calls++
+		call.Pattern, call.Text, call.Err = r.pattern.String(), next.text, next.err
+		m.calls = append(m.calls, call)
+		if next.err != nil {
+			return nil, next.err
+		}
+		tok := contextbudget.HeuristicTokenizer{}
+		usage := llm.Usage{PromptTokens: tok.Count(prompt), CompletionTokens: tok.Count(next.text)}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		return &llm.Response{Text: next.text, Model: m.Name, Usage: usage}, nil
+	}
+
+	call.Err = fmt.Errorf("%w: %q", ErrUnexpectedPrompt, excerpt(prompt))
+	m.calls = append(m.calls, call)
+	return nil, call.Err
+}
+
+// Calls returns the prompts received so far, in order
+func (m *FakeModel) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// AssertCalled fails the test unless the rule added with pattern answered
+// exactly n prompts
+func (m *FakeModel) AssertCalled(t testing.TB, pattern string, n int) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rules {
+		if r.pattern.String() == pattern {
+			if r.calls != n {
+				t.Errorf("model rule %q answered %d prompts, want %d", pattern, r.calls, n)
+			}
+			return
+		}
+	}
+	t.Errorf("model has no rule %q", pattern)
+}
+
+// AssertCallCount fails the test unless the model received exactly n prompts
+func (m *FakeModel) AssertCallCount(t testing.TB, n int) {
+	t.Helper()
+	if calls := m.Calls(); len(calls) != n {
+		t.Errorf("model received %d prompts, want %d", len(calls), n)
+	}
+}
+
+// AssertNoUnexpected fails the test if a prompt matched no rule
+func (m *FakeModel) AssertNoUnexpected(t testing.TB) {
+	t.Helper()
+	for _, c := range m.Calls() {
+		if c.Pattern == "" {
+			t.Errorf("model received an unexpected prompt: %q", excerpt(c.Prompt))
+		}
+	}
+}
+
+// excerpt shortens a prompt for error messages
+func excerpt(prompt string) string {
+	const max = 120
+	if r := []rune(prompt); len(r) > max {
+		return string(r[:max]) + "..."
+	}
+	return prompt
+}
@@ -0,0 +1,94 @@
+package testkit
+
+import (
+	"context"
+	"regexp"
+	"sync"
+
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+// searchRule answers the queries matching a pattern
+type searchRule struct {
+	pattern *regexp.Regexp
+	results []search.Result
+	err     error
+}
+
+// FakeSearch is a search.Provider with canned results. Rules are tried in the
+// order they were added; a query no rule matches returns no results. It is
+// safe for concurrent use.
+type FakeSearch struct {
+	mu      sync.Mutex
+	rules   []searchRule
+	queries []string
+}
+
+// NewFakeSearch creates a FakeSearch without rules
+func NewFakeSearch() *FakeSearch {
+	return &FakeSearch{}
+}
+
+// On returns results for the queries matching pattern, a regular expression.
+// Results are ranked and attributed to the provider when those fields are
+// empty.
+func (s *FakeSearch) On(pattern string, results ...search.Result) *FakeSearch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ranked := make([]search.Result, len(results))
+	for i, r := range results {
+		if r.Rank == 0 {
+			r.Rank = i + 1
+		}
+		if r.Source == "" {
+			r.Source = s.Name()
+		}
+		ranked[i] = r
+	}
+	s.rules = append(s.rules, searchRule{pattern: regexp.MustCompile(pattern), results: ranked})
+	return s
+}
+
+// Fail makes the queries matching pattern fail with err
+func (s *FakeSearch) Fail(pattern string, err error) *FakeSearch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, searchRule{pattern: regexp.MustCompile(pattern), err: err})
+	return s
+}
+
+// Name implements search.Provider
+func (s *FakeSearch) Name() string {
+	return "fake"
+}
+
+// Search implements search.Provider
+func (s *FakeSearch) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, query)
+	for _, r := range s.rules {
+		if !r.pattern.MatchString(query) {
+			continue
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		results := r.results
+		if limit > 0 && len(results) > limit {
+			results = results[:limit]
+		}
+		return append([]search.Result(nil), results...), nil
+	}
+	return nil, nil
+}
+
+// Queries returns the queries received so far, in order
+func (s *FakeSearch) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
@@ -0,0 +1,114 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/llm"
+	"github.com/utkarsh-cpu/go_agent/search"
+)
+
+// decideNode asks the model whether to search or answer
+type decideNode struct {
+	*agent.BaseNode
+}
+
+func (d *decideNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	model := shared["llm"].(llm.ChatModel)
+	resp, err := model.Generate(context.Background(), "Decide the next action for: "+shared["question"].(string))
+	if err != nil {
+		shared["error"] = err.Error()
+		return "error"
+	}
+	return strings.TrimSpace(resp.Text)
+}
+
+// searchNode searches for the question
+type searchNode struct {
+	*agent.BaseNode
+}
+
+func (s *searchNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	provider := shared["search"].(search.Provider)
+	results, _ := provider.Search(context.Background(), shared["question"].(string), 5)
+	shared["context"] = search.Format(results)
+	return "decide"
+}
+
+func researchFlow() *agent.Flow {
+	decide := &decideNode{BaseNode: agent.NewBaseNode()}
+	decide.SetName("decide")
+	find := &searchNode{BaseNode: agent.NewBaseNode()}
+	find.SetName("search")
+	answer := agent.NewBaseNode()
+	answer.SetName("answer")
+	decide.Next(find, "search")
+	decide.Next(answer, "answer")
+	find.Next(decide, "decide")
+	return agent.NewFlow(decide)
+}
+
+func TestAssertPath_FollowsScript(t *testing.T) {
+	model := NewFakeModel()
+	model.On(`^Decide the next action`).Reply("search", "answer")
+	engine := NewFakeSearch().On(`capital`, search.Result{Title: "Paris", URL: "https://example.com/paris"})
+
+	shared := map[string]interface{}{"question": "What is the capital of France?", "llm": model, "search": engine}
+	tr := AssertPath(t, researchFlow(), shared, []string{"search", "decide", "answer"})
+	tr.AssertNodes(t, []string{"decide", "search", "decide", "answer"})
+
+	model.AssertCalled(t, `^Decide the next action`, 2)
+	model.AssertCallCount(t, 2)
+	model.AssertNoUnexpected(t)
+	if q := engine.Queries(); len(q) != 1 || q[0] != "What is the capital of France?" {
+		t.Errorf("queries = %q", q)
+	}
+	if !strings.Contains(shared["context"].(string), "Paris") {
+		t.Errorf("context = %q", shared["context"])
+	}
+}
+
+// recorder captures assertion failures instead of failing the test
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+func TestFakeModel_Failures(t *testing.T) {
+	boom := errors.New("quota exceeded")
+	model := NewFakeModel()
+	model.On(`retry`).Fail(boom).Reply("ok")
+
+	if _, err := model.Generate(context.Background(), "please retry"); !errors.Is(err, boom) {
+		t.Errorf("first call error = %v, want %v", err, boom)
+	}
+	resp, err := model.Generate(context.Background(), "please retry")
+	if err != nil || resp.Text != "ok" || resp.Usage.TotalTokens == 0 {
+		t.Errorf("second call = %+v, %v", resp, err)
+	}
+	if _, err := model.Generate(context.Background(), "something else"); !errors.Is(err, ErrUnexpectedPrompt) {
+		t.Errorf("unmatched prompt error = %v, want ErrUnexpectedPrompt", err)
+	}
+
+	// The assertions report the unexpected prompt through the test
+	rec := &recorder{TB: t}
+	model.AssertNoUnexpected(rec)
+	if !rec.failed {
+		t.Error("AssertNoUnexpected did not fail on an unmatched prompt")
+	}
+}
+
+func TestFakeSearch_Limit(t *testing.T) {
+	engine := NewFakeSearch().On(`.`, search.Result{Title: "a"}, search.Result{Title: "b"}, search.Result{Title: "c"})
+	results, err := engine.Search(context.Background(), "go", 2)
+	if err != nil || len(results) != 2 || results[1].Rank != 2 || results[1].Source != "fake" {
+		t.Errorf("Search() = %+v, %v", results, err)
+	}
+}
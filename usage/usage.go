@@ -0,0 +1,274 @@
+// Package usage accounts for the tokens and money spent by a flow run.
+//
+// A Tracker records the usage reported by every LLM call, attributes it to the
+// node that made it and prices it from a PriceTable. Registered on a Flow with
+// Use, it also enforces Limits by rerouting the flow once they are exceeded.
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/utkarsh-cpu/go_agent/llm"
+)
+
+// DefaultExceededAction is the action a Tracker transitions on once a limit
+// has been exceeded, unless Limits.Action says otherwise
+const DefaultExceededAction = "budget_exceeded"
+
+// ErrBudgetExceeded is returned by Tracker.Err once a limit has been exceeded
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// Price is the cost of a model in US dollars per million tokens
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// PriceTable maps model names to prices. A model without an exact entry uses
+// the longest entry that is a prefix of its name, so "gemini-2.0-flash-001"
+// is priced as "gemini-2.0-flash".
+type PriceTable map[string]Price
+
+// DefaultPrices lists public list prices for the models used in the examples.
+// Prices change; callers that need exact figures should supply their own.
+var DefaultPrices = PriceTable{
+	"gemini-2.0-flash":      {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.0-flash-lite": {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+}
+
+// Lookup returns the price for model and whether one was found
+func (p PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// Cost prices a single call. Unknown models cost nothing.
+func (p PriceTable) Cost(model string, u llm.Usage) float64 {
+	price, _ := p.Lookup(model)
+	return float64(u.PromptTokens)*price.InputPerMillion/1e6 +
+		float64(u.CompletionTokens)*price.OutputPerMillion/1e6
+}
+
+// Limits are hard caps for a run. Zero values mean unlimited.
+type Limits struct {
+	MaxTokens int
+	MaxCost   float64
+	// Action is transitioned on after a node that pushed the run over a
+	// limit. Register a successor for it to reroute the flow; without one
+	// the flow stops. Defaults to DefaultExceededAction.
+	Action string
+}
+
+// Call is the usage of a single LLM call
+type Call struct {
+	Node  string    `json:"node"`
+	Model string    `json:"model"`
+	Usage llm.Usage `json:"usage"`
+	Cost  float64   `json:"cost"`
+	Time  time.Time `json:"time"`
+	// Fallbacks are the models that failed before Model answered
+	Fallbacks []llm.Failure `json:"fallbacks,omitempty"`
+	// Cached is set when the reply was served from a cache
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Totals aggregates usage over several calls
+type Totals struct {
+	Calls int       `json:"calls"`
+	Usage llm.Usage `json:"usage"`
+	Cost  float64   `json:"cost"`
+}
+
+func (t Totals) add(c Call) Totals {
+	return Totals{
+		Calls: t.Calls + 1,
+		Usage: t.Usage.Add(c.Usage),
+		Cost:  t.Cost + c.Cost,
+	}
+}
+
+// Report summarises the usage of a run
+type Report struct {
+	Total    Totals            `json:"total"`
+	ByNode   map[string]Totals `json:"by_node"`
+	ByModel  map[string]Totals `json:"by_model"`
+	Calls    []Call            `json:"calls"`
+	Exceeded bool              `json:"exceeded"`
+}
+
+// String formats the report for terminals and logs
+func (r Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d LLM calls, %d tokens (%d prompt, %d completion), $%.6f",
+		r.Total.Calls, r.Total.Usage.TotalTokens, r.Total.Usage.PromptTokens,
+		r.Total.Usage.CompletionTokens, r.Total.Cost)
+	if r.Exceeded {
+		sb.WriteString(" [budget exceeded]")
+	}
+
+	nodes := make([]string, 0, len(r.ByNode))
+	for n := range r.ByNode {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	for _, n := range nodes {
+		t := r.ByNode[n]
+		fmt.Fprintf(&sb, "\n  %s: %d calls, %d tokens, $%.6f", n, t.Calls, t.Usage.TotalTokens, t.Cost)
+	}
+	return sb.String()
+}
+
+// Tracker records usage for one flow run. It is safe for concurrent use.
+type Tracker struct {
+	Prices PriceTable
+	Limits Limits
+
+	mu    sync.Mutex
+	node  string
+	calls []Call
+	// rerouted is set once the run has been sent on Limits.Action
+	rerouted bool
+}
+
+// NewTracker creates a Tracker with the given prices and limits
+func NewTracker(prices PriceTable, limits Limits) *Tracker {
+	return &Tracker{
+		Prices: prices,
+		Limits: limits,
+	}
+}
+
+// Record adds a call made by the node that is currently running
+func (t *Tracker) Record(model string, u llm.Usage) {
+	t.mu.Lock()
+	node := t.node
+	t.mu.Unlock()
+	t.RecordFor(node, model, u)
+}
+
+// RecordFor adds a call made by the named node
+func (t *Tracker) RecordFor(node string, model string, u llm.Usage) {
+	t.add(Call{Node: node, Model: model, Usage: u})
+}
+
+// RecordResponse adds a call made by the node that is currently running,
+// with the model, fallbacks and cache status reported in resp
+func (t *Tracker) RecordResponse(resp *llm.Response) {
+	t.mu.Lock()
+	node := t.node
+	t.mu.Unlock()
+	t.add(Call{Node: node, Model: resp.Model, Usage: resp.Usage, Fallbacks: resp.Fallbacks, Cached: resp.Cached})
+}
+
+// add prices and stores a call
+func (t *Tracker) add(call Call) {
+	if call.Usage.TotalTokens == 0 {
+		call.Usage.TotalTokens = call.Usage.PromptTokens + call.Usage.CompletionTokens
+	}
+	call.Cost = t.Prices.Cost(call.Model, call.Usage)
+	call.Time = time.Now()
+
+	t.mu.Lock()
+	t.calls = append(t.calls, call)
+	t.mu.Unlock()
+}
+
+// Report aggregates the calls recorded so far
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reportLocked()
+}
+
+func (t *Tracker) reportLocked() Report {
+	r := Report{
+		ByNode:  make(map[string]Totals),
+		ByModel: make(map[string]Totals),
+		Calls:   append([]Call(nil), t.calls...),
+	}
+	for _, c := range t.calls {
+		r.Total = r.Total.add(c)
+		r.ByNode[c.Node] = r.ByNode[c.Node].add(c)
+		r.ByModel[c.Model] = r.ByModel[c.Model].add(c)
+	}
+	r.Exceeded = (t.Limits.MaxTokens > 0 && r.Total.Usage.TotalTokens > t.Limits.MaxTokens) ||
+		(t.Limits.MaxCost > 0 && r.Total.Cost > t.Limits.MaxCost)
+	return r
+}
+
+// Exceeded reports whether any limit has been exceeded
+func (t *Tracker) Exceeded() bool {
+	return t.Report().Exceeded
+}
+
+// Err returns ErrBudgetExceeded, with the totals, once a limit has been exceeded
+func (t *Tracker) Err() error {
+	r := t.Report()
+	if !r.Exceeded {
+		return nil
+	}
+	return fmt.Errorf("%w: %d tokens, $%.6f", ErrBudgetExceeded, r.Total.Usage.TotalTokens, r.Total.Cost)
+}
+
+// BeforeNode implements agent.Hook by attributing subsequent calls to name
+func (t *Tracker) BeforeNode(name string, shared map[string]interface{}) string {
+	t.mu.Lock()
+	t.node = name
+	t.mu.Unlock()
+	return ""
+}
+
+// AfterNode implements agent.Hook. It replaces the action of the node that
+// pushed the run over a limit with Limits.Action; the nodes after it keep
+// their own actions, so a degraded route may be several nodes long.
+func (t *Tracker) AfterNode(name string, shared map[string]interface{}, action string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rerouted || !t.reportLocked().Exceeded {
+		return action
+	}
+	t.rerouted = true
+	if t.Limits.Action != "" {
+		return t.Limits.Action
+	}
+	return DefaultExceededAction
+}
+
+// meteredModel records the usage of every call to the wrapped model
+type meteredModel struct {
+	model   llm.ChatModel
+	tracker *Tracker
+}
+
+// Meter wraps model so the usage of every successful call is recorded on
+// tracker, attributed to the node running at the time
+func Meter(model llm.ChatModel, tracker *Tracker) llm.ChatModel {
+	return &meteredModel{model: model, tracker: tracker}
+}
+
+// Generate implements llm.ChatModel
+func (m *meteredModel) Generate(ctx context.Context, prompt string) (*llm.Response, error) {
+	resp, err := m.model.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	m.tracker.RecordResponse(resp)
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/llm"
+)
+
+// fixedModel reports the same usage for every call
+func fixedModel(name string, prompt, completion int) llm.ChatModel {
+	return llm.ModelFunc(func(ctx context.Context, p string) (*llm.Response, error) {
+		return &llm.Response{
+			Text:  "ok",
+			Model: name,
+			Usage: llm.Usage{PromptTokens: prompt, CompletionTokens: completion},
+		}, nil
+	})
+}
+
+// llmNode calls its model once and returns action
+type llmNode struct {
+	*agent.Node
+	model  llm.ChatModel
+	action string
+}
+
+func (n *llmNode) Exec(prepRes interface{}) interface{} {
+	if _, err := n.model.Generate(context.Background(), "hello"); err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func (n *llmNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	return n.action
+}
+
+func TestPriceTable_PrefixLookup(t *testing.T) {
+	prices := PriceTable{
+		"model":       {InputPerMillion: 1, OutputPerMillion: 2},
+		"model-large": {InputPerMillion: 10, OutputPerMillion: 20},
+	}
+	cost := prices.Cost("model-large-001", llm.Usage{PromptTokens: 1e6, CompletionTokens: 1e6})
+	if math.Abs(cost-30) > 1e-9 {
+		t.Fatalf("Expected longest prefix price (30), got %v", cost)
+	}
+	if cost := prices.Cost("other", llm.Usage{PromptTokens: 1e6}); cost != 0 {
+		t.Fatalf("Expected unknown model to cost nothing, got %v", cost)
+	}
+}
+
+func TestTracker_AggregatesPerNodeInFlow(t *testing.T) {
+	tracker := NewTracker(PriceTable{"m": {InputPerMillion: 1e6, OutputPerMillion: 2e6}}, Limits{})
+	model := Meter(fixedModel("m", 10, 5), tracker)
+
+	first := &llmNode{Node: agent.NewNode(1, 0), model: model, action: "next"}
+	second := &llmNode{Node: agent.NewNode(1, 0), model: model, action: "done"}
+	first.SetName("first")
+	second.SetName("second")
+	first.Next(second, "next")
+
+	flow := agent.NewFlow(first)
+	flow.Use(tracker)
+	flow.Run(map[string]interface{}{})
+
+	r := tracker.Report()
+	if r.Total.Calls != 2 || r.Total.Usage.TotalTokens != 30 {
+		t.Fatalf("Unexpected totals: %+v", r.Total)
+	}
+	if r.ByNode["first"].Calls != 1 || r.ByNode["second"].Calls != 1 {
+		t.Fatalf("Expected one call per node, got %+v", r.ByNode)
+	}
+	if math.Abs(r.Total.Cost-40) > 1e-9 {
+		t.Fatalf("Expected cost 40, got %v", r.Total.Cost)
+	}
+	if tracker.Err() != nil {
+		t.Fatalf("Expected no budget error without limits")
+	}
+}
+
+func TestTracker_LimitReroutesFlow(t *testing.T) {
+	tracker := NewTracker(nil, Limits{MaxTokens: 10})
+	model := Meter(fixedModel("m", 10, 5), tracker)
+
+	expensive := &llmNode{Node: agent.NewNode(1, 0), model: model, action: "next"}
+	normal := &llmNode{Node: agent.NewNode(1, 0), model: model, action: "done"}
+	cheap := &llmNode{Node: agent.NewNode(1, 0), model: fixedModel("free", 0, 0), action: "degraded"}
+	summary := &llmNode{Node: agent.NewNode(1, 0), model: fixedModel("free", 0, 0), action: "done"}
+	expensive.Next(normal, "next")
+	expensive.Next(cheap, DefaultExceededAction)
+	cheap.Next(summary, "degraded")
+
+	flow := agent.NewFlow(expensive)
+	flow.Use(tracker)
+	result := flow.Run(map[string]interface{}{})
+
+	// Only the node that crossed the limit is rerouted; the degraded route
+	// then follows its own actions
+	if result != "done" {
+		t.Fatalf("Expected the degraded route to end on done, got %v", result)
+	}
+	if r := tracker.Report(); r.Total.Calls != 1 || !r.Exceeded {
+		t.Fatalf("Expected only the expensive call before rerouting, got %+v", r)
+	}
+	if !errors.Is(tracker.Err(), ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", tracker.Err())
+	}
+}
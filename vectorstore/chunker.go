@@ -0,0 +1,150 @@
+package vectorstore
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+)
+
+// Document is a text to index
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]string
+}
+
+// Chunk is a piece of a document, the unit that is embedded and retrieved
+type Chunk struct {
+	ID       string
+	DocID    string
+	Text     string
+	Metadata map[string]string
+	Vector   []float32
+}
+
+// Chunker splits documents into chunks of about Size tokens. Paragraphs are
+// kept whole where possible, and consecutive chunks share up to Overlap
+// tokens of whole paragraphs so that a passage cut at a boundary is still
+// found.
+type Chunker struct {
+	Size      int
+	Overlap   int
+	Tokenizer contextbudget.Tokenizer
+}
+
+// DefaultChunker produces chunks of about 300 tokens with 50 tokens of overlap
+var DefaultChunker = Chunker{Size: 300, Overlap: 50}
+
+// Split splits a document into chunks with IDs "<doc id>#<n>"
+func (c Chunker) Split(doc Document) []Chunk {
+	tok := c.Tokenizer
+	if tok == nil {
+		tok = contextbudget.HeuristicTokenizer{}
+	}
+	size := c.Size
+	if size <= 0 {
+		size = DefaultChunker.Size
+	}
+	overlap := min(max(c.Overlap, 0), size/2)
+
+	// Break the text into pieces no larger than a chunk: paragraphs, or
+	// runs of words for paragraphs that are too long
+	var pieces []string
+	for _, para := range contextbudget.SplitParagraphs(doc.Text) {
+		if tok.Count(para.Text) <= size {
+			pieces = append(pieces, para.Text)
+			continue
+		}
+		pieces = append(pieces, splitWords(para.Text, size, tok)...)
+	}
+
+	var chunks []Chunk
+	var current []string
+	used := 0
+	// fresh is set once current holds text not yet in a chunk
+	fresh := false
+	flush := func() {
+		chunks = append(chunks, Chunk{
+			ID:       fmt.Sprintf("%s#%d", doc.ID, len(chunks)),
+			DocID:    doc.ID,
+			Text:     strings.Join(current, "\n\n"),
+			Metadata: doc.Metadata,
+		})
+		// Carry the tail of this chunk into the next one
+		var carried []string
+		carriedTokens := 0
+		for i := len(current) - 1; i > 0; i-- {
+			n := tok.Count(current[i])
+			if carriedTokens+n > overlap {
+				break
+			}
+			carried = append([]string{current[i]}, carried...)
+			carriedTokens += n
+		}
+		current, used, fresh = carried, carriedTokens, false
+	}
+
+	for _, p := range pieces {
+		n := tok.Count(p)
+		if fresh && used+n > size {
+			flush()
+		}
+		// Drop carried text that leaves no room for the new piece
+		for len(current) > 0 && used+n > size {
+			used -= tok.Count(current[0])
+			current = current[1:]
+		}
+		current = append(current, p)
+		used += n
+		fresh = true
+	}
+	if fresh {
+		flush()
+	}
+	return chunks
+}
+
+func splitWords(text string, size int, tok contextbudget.Tokenizer) []string {
+	var pieces []string
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if len(words) > 0 && tok.Count(strings.Join(append(words, w), " ")) > size {
+			pieces = append(pieces, strings.Join(words, " "))
+			words = nil
+		}
+		words = append(words, w)
+	}
+	if len(words) > 0 {
+		pieces = append(pieces, strings.Join(words, " "))
+	}
+	return pieces
+}
+
+// ReadDocuments loads the files in fsys matching any of patterns (such as
+// "*.md") as documents, using each path as the document ID
+func ReadDocuments(fsys fs.FS, patterns ...string) ([]Document, error) {
+	var docs []Document
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, path.Base(p)); ok {
+				data, err := fs.ReadFile(fsys, p)
+				if err != nil {
+					return err
+				}
+				docs = append(docs, Document{ID: p, Text: string(data), Metadata: map[string]string{"source": p}})
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading documents: %w", err)
+	}
+	return docs, nil
+}
@@ -0,0 +1,91 @@
+// Package vectorstore grounds flows in local documents.
+//
+// Documents are split into chunks by a Chunker, embedded by an Embedder and
+// indexed by an Index: Flat for exact cosine search, or HNSW for approximate
+// search over large collections. A Store ties the three together, persists
+// its chunks to disk, and backs RetrieveNode, which puts the chunks most
+// similar to a query into the shared map.
+package vectorstore
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into vectors. Every vector it returns must have the
+// same dimension.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc adapts a function to the Embedder interface
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// Embed calls f(ctx, texts)
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(ctx, texts)
+}
+
+// HashEmbedder embeds text as hashed bag-of-words vectors. It needs no model
+// and only matches shared words, which makes it useful for tests, offline use
+// and keyword-heavy corpora.
+type HashEmbedder struct {
+	// Dim is the vector dimension (256 when unset)
+	Dim int
+}
+
+// Embed implements Embedder
+func (h HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	dim := h.Dim
+	if dim <= 0 {
+		dim = 256
+	}
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec := make([]float32, dim)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, w := range words {
+			hash := fnv.New32a()
+			hash.Write([]byte(w))
+			sum := hash.Sum32()
+			// The top bit picks the sign so that collisions tend to cancel
+			if sum&(1<<31) != 0 {
+				vec[int(sum%uint32(dim))]--
+			} else {
+				vec[int(sum%uint32(dim))]++
+			}
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+// normalize scales v to unit length in place, so that cosine similarity is a
+// dot product
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+	return v
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
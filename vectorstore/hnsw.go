@@ -0,0 +1,251 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// HNSW is an approximate Index based on hierarchical navigable small world
+// graphs (Malkov & Yashunin). Search time grows roughly logarithmically with
+// the number of vectors, at the cost of occasionally missing a true nearest
+// neighbour; raise EfSearch to trade speed for recall.
+type HNSW struct {
+	// M is the number of neighbours kept per node on the upper layers;
+	// layer 0 keeps 2*M
+	M int
+	// EfConstruction is the candidate list size used while inserting
+	EfConstruction int
+	// EfSearch is the candidate list size used while searching; it is
+	// raised to k when smaller
+	EfSearch int
+
+	mu       sync.RWMutex
+	dim      int
+	nodes    []*hnswNode
+	index    map[string]int
+	entry    int
+	maxLevel int
+	rng      *rand.Rand
+}
+
+type hnswNode struct {
+	id     string
+	vec    []float32
+	levels [][]int // neighbours per layer
+}
+
+// NewHNSW creates an empty HNSW index with common defaults (M=16,
+// EfConstruction=200, EfSearch=64)
+func NewHNSW() *HNSW {
+	return &HNSW{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+		index:          make(map[string]int),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(1)),
+	}
+}
+
+// Add implements Index
+func (h *HNSW) Add(items ...Item) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, it := range items {
+		if err := checkDim(&h.dim, it.Vector); err != nil {
+			return err
+		}
+		if _, ok := h.index[it.ID]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateID, it.ID)
+		}
+		h.insert(it.ID, normalize(append([]float32{}, it.Vector...)))
+	}
+	return nil
+}
+
+func (h *HNSW) insert(id string, vec []float32) {
+	m := max(h.M, 2)
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) / math.Log(float64(m))))
+
+	n := len(h.nodes)
+	node := &hnswNode{id: id, vec: vec, levels: make([][]int, level+1)}
+	h.nodes = append(h.nodes, node)
+	h.index[id] = n
+
+	if h.entry < 0 {
+		h.entry, h.maxLevel = n, level
+		return
+	}
+
+	ep := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedy(vec, ep, l)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(vec, ep, max(h.EfConstruction, m), l)
+		neighbours := h.closest(candidates, h.maxConn(l))
+		node.levels[l] = neighbours
+		for _, nb := range neighbours {
+			other := h.nodes[nb]
+			other.levels[l] = append(other.levels[l], n)
+			if len(other.levels[l]) > h.maxConn(l) {
+				other.levels[l] = h.prune(other.vec, other.levels[l], h.maxConn(l))
+			}
+		}
+		ep = candidates[0].node
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = n, level
+	}
+}
+
+func (h *HNSW) maxConn(level int) int {
+	m := max(h.M, 2)
+	if level == 0 {
+		return 2 * m
+	}
+	return m
+}
+
+// greedy walks layer l towards q and returns the closest node found
+func (h *HNSW) greedy(q []float32, ep, l int) int {
+	best, bestDist := ep, h.dist(q, ep)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.nodes[best].levels[l] {
+			if d := h.dist(q, nb); d < bestDist {
+				best, bestDist, changed = nb, d, true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of layer l closest to q, closest first
+func (h *HNSW) searchLayer(q []float32, ep, ef, l int) []candidate {
+	visited := map[int]bool{ep: true}
+	start := candidate{node: ep, dist: h.dist(q, ep)}
+	frontier := &minHeap{start}
+	results := &maxHeap{start}
+
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(candidate)
+		if c.dist > (*results)[0].dist && results.Len() >= ef {
+			break
+		}
+		for _, nb := range h.nodes[c.node].levels[l] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := h.dist(q, nb)
+			if results.Len() < ef || d < (*results)[0].dist {
+				heap.Push(frontier, candidate{node: nb, dist: d})
+				heap.Push(results, candidate{node: nb, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := append([]candidate{}, *results...)
+	sort.Slice(out, func(a, b int) bool { return out[a].dist < out[b].dist })
+	return out
+}
+
+func (h *HNSW) closest(candidates []candidate, n int) []int {
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	ids := make([]int, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.node
+	}
+	return ids
+}
+
+// prune keeps the n neighbours closest to vec
+func (h *HNSW) prune(vec []float32, neighbours []int, n int) []int {
+	cands := make([]candidate, len(neighbours))
+	for i, nb := range neighbours {
+		cands[i] = candidate{node: nb, dist: 1 - dot(vec, h.nodes[nb].vec)}
+	}
+	sort.Slice(cands, func(a, b int) bool { return cands[a].dist < cands[b].dist })
+	return h.closest(cands, n)
+}
+
+func (h *HNSW) dist(q []float32, node int) float32 {
+	return 1 - dot(q, h.nodes[node].vec)
+}
+
+// Search implements Index
+func (h *HNSW) Search(query []float32, k int) ([]Match, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.entry < 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != h.dim {
+		return nil, fmt.Errorf("vectorstore: query has dimension %d, index has %d", len(query), h.dim)
+	}
+	q := normalize(append([]float32{}, query...))
+
+	ep := h.entry
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.greedy(q, ep, l)
+	}
+	candidates := h.searchLayer(q, ep, max(h.EfSearch, k), 0)
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	matches := make([]Match, len(candidates))
+	for i, c := range candidates {
+		matches[i] = Match{ID: h.nodes[c.node].id, Score: 1 - c.dist}
+	}
+	return matches, nil
+}
+
+// Len implements Index
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes)
+}
+
+type candidate struct {
+	node int
+	dist float32
+}
+
+// minHeap pops the closest candidate first
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxHeap pops the farthest candidate first
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,110 @@
+package vectorstore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrDuplicateID is returned when an ID is added to an index twice
+var ErrDuplicateID = errors.New("vectorstore: duplicate id")
+
+// Item is a vector to index
+type Item struct {
+	ID     string
+	Vector []float32
+}
+
+// Match is a search result: the ID of an indexed vector and its cosine
+// similarity to the query
+type Match struct {
+	ID    string
+	Score float32
+}
+
+// Index finds the vectors most similar to a query
+type Index interface {
+	Add(items ...Item) error
+	// Search returns up to k matches, most similar first
+	Search(query []float32, k int) ([]Match, error)
+	Len() int
+}
+
+// Flat is an Index that compares the query with every vector. It is exact
+// and fast enough for tens of thousands of chunks.
+type Flat struct {
+	mu    sync.RWMutex
+	dim   int
+	ids   []string
+	vecs  [][]float32
+	index map[string]int
+}
+
+// NewFlat creates an empty Flat index
+func NewFlat() *Flat {
+	return &Flat{index: make(map[string]int)}
+}
+
+// Add implements Index
+func (f *Flat) Add(items ...Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, it := range items {
+		if err := checkDim(&f.dim, it.Vector); err != nil {
+			return err
+		}
+		if _, ok := f.index[it.ID]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateID, it.ID)
+		}
+		f.index[it.ID] = len(f.ids)
+		f.ids = append(f.ids, it.ID)
+		f.vecs = append(f.vecs, normalize(append([]float32{}, it.Vector...)))
+	}
+	return nil
+}
+
+// Search implements Index
+func (f *Flat) Search(query []float32, k int) ([]Match, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.ids) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(query) != f.dim {
+		return nil, fmt.Errorf("vectorstore: query has dimension %d, index has %d", len(query), f.dim)
+	}
+	q := normalize(append([]float32{}, query...))
+
+	matches := make([]Match, len(f.ids))
+	for i, v := range f.vecs {
+		matches[i] = Match{ID: f.ids[i], Score: dot(q, v)}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Score > matches[b].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// Len implements Index
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.ids)
+}
+
+// checkDim records the dimension of the first vector and rejects vectors of
+// any other dimension
+func checkDim(dim *int, v []float32) error {
+	if len(v) == 0 {
+		return errors.New("vectorstore: empty vector")
+	}
+	if *dim == 0 {
+		*dim = len(v)
+	}
+	if len(v) != *dim {
+		return fmt.Errorf("vectorstore: vector has dimension %d, index has %d", len(v), *dim)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+)
+
+// Default settings of a RetrieveNode
+const (
+	DefaultQueryKey   = "search_query"
+	DefaultResultsKey = "retrieved"
+	DefaultContextKey = "context"
+	DefaultAction     = "decide"
+)
+
+// RetrieveNode looks up the chunks most similar to a query in a Store. With
+// its defaults it is a drop-in alternative to a web search node: it reads
+// shared["search_query"], stores the hits in shared["retrieved"], appends
+// them to shared["context"] and returns "decide". A missing query or a
+// failed lookup is a failed attempt, retried when the node allows it; if
+// every attempt fails, Post sets shared["error"] and returns "error". Embed
+// it and override Post to handle the hits differently.
+type RetrieveNode struct {
+	*agent.Node
+
+	Store *Store
+	// K is the number of chunks to retrieve
+	K int
+	// QueryKey is the shared key of the query; "question" is used when it
+	// is empty
+	QueryKey string
+	// ResultsKey receives the []Hit
+	ResultsKey string
+	// ContextKey is the shared string the formatted hits are appended to;
+	// empty to leave the context alone
+	ContextKey string
+	// CtxKey optionally names a shared context.Context used for embedding
+	// the query
+	CtxKey string
+	// Action is returned from Post
+	Action string
+}
+
+// NewRetrieveNode creates a RetrieveNode retrieving k chunks from store
+func NewRetrieveNode(store *Store, k int) *RetrieveNode {
+	return &RetrieveNode{
+		Node:       agent.NewNode(1, 0),
+		Store:      store,
+		K:          k,
+		QueryKey:   DefaultQueryKey,
+		ResultsKey: DefaultResultsKey,
+		ContextKey: DefaultContextKey,
+		Action:     DefaultAction,
+	}
+}
+
+type retrieveInput struct {
+	ctx   context.Context
+	query string
+}
+
+// Prep reads the query
+func (r *RetrieveNode) Prep(shared map[string]interface{}) interface{} {
+	query, _ := shared[r.QueryKey].(string)
+	if query == "" {
+		query, _ = shared["question"].(string)
+	}
+	ctx, ok := shared[r.CtxKey].(context.Context)
+	if !ok {
+		ctx = context.Background()
+	}
+	return retrieveInput{ctx: ctx, query: query}
+}
+
+// Exec queries the store and returns the []Hit. Failures panic, which the
+// flow counts as a failed attempt.
+func (r *RetrieveNode) Exec(prepRes interface{}) interface{} {
+	in, ok := prepRes.(retrieveInput)
+	if !ok || in.query == "" {
+		panic(errors.New("vectorstore: no query to retrieve for"))
+	}
+	hits, err := r.Store.Query(in.ctx, in.query, r.K)
+	if err != nil {
+		panic(fmt.Errorf("vectorstore: retrieving %q: %w", in.query, err))
+	}
+	return hits
+}
+
+// Post stores the hits and appends them to the context
+func (r *RetrieveNode) Post(shared map[string]interface{}, prepRes interface{}, execRes interface{}) interface{} {
+	if err, ok := execRes.(error); ok {
+		log.Printf("Warning: retrieval failed: %v", err)
+		shared["error"] = err.Error()
+		return "error"
+	}
+	hits, _ := execRes.([]Hit)
+	if r.ResultsKey != "" {
+		shared[r.ResultsKey] = hits
+	}
+	if r.ContextKey != "" && len(hits) > 0 {
+		query := ""
+		if in, ok := prepRes.(retrieveInput); ok {
+			query = in.query
+		}
+		existing, _ := shared[r.ContextKey].(string)
+		entry := "RETRIEVED: " + query + "\nRESULTS:\n" + FormatHits(hits)
+		shared[r.ContextKey] = strings.TrimSpace(existing + "\n\n" + entry)
+	}
+	return r.Action
+}
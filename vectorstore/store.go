@@ -0,0 +1,180 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// embedBatchSize is the number of chunks embedded per Embedder call
+const embedBatchSize = 64
+
+// Hit is a retrieved chunk and its similarity to the query
+type Hit struct {
+	Chunk Chunk
+	Score float32
+}
+
+// Store indexes documents and retrieves the chunks most similar to a query
+type Store struct {
+	Embedder Embedder
+	Index    Index
+	Chunker  Chunker
+
+	mu     sync.RWMutex
+	chunks map[string]Chunk
+	order  []string
+}
+
+// NewStore creates a Store that splits documents with DefaultChunker.
+// A nil index defaults to Flat.
+func NewStore(embedder Embedder, index Index) *Store {
+	if index == nil {
+		index = NewFlat()
+	}
+	return &Store{
+		Embedder: embedder,
+		Index:    index,
+		Chunker:  DefaultChunker,
+		chunks:   make(map[string]Chunk),
+	}
+}
+
+// AddDocuments chunks, embeds and indexes documents
+func (s *Store) AddDocuments(ctx context.Context, docs ...Document) error {
+	var chunks []Chunk
+	for _, doc := range docs {
+		chunks = append(chunks, s.Chunker.Split(doc)...)
+	}
+
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		batch := chunks[start:min(start+embedBatchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Text
+		}
+		vecs, err := s.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("embedding chunks: %w", err)
+		}
+		if len(vecs) != len(batch) {
+			return fmt.Errorf("embedding chunks: got %d vectors for %d texts", len(vecs), len(batch))
+		}
+		for i := range batch {
+			batch[i].Vector = vecs[i]
+		}
+	}
+	return s.addChunks(chunks)
+}
+
+func (s *Store) addChunks(chunks []Chunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range chunks {
+		if err := s.Index.Add(Item{ID: c.ID, Vector: c.Vector}); err != nil {
+			return err
+		}
+		s.chunks[c.ID] = c
+		s.order = append(s.order, c.ID)
+	}
+	return nil
+}
+
+// Query returns the k chunks most similar to text
+func (s *Store) Query(ctx context.Context, text string, k int) ([]Hit, error) {
+	vecs, err := s.Embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	if len(vecs) != 1 {
+		return nil, fmt.Errorf("embedding query: got %d vectors", len(vecs))
+	}
+	matches, err := s.Index.Search(vecs[0], k)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hits := make([]Hit, 0, len(matches))
+	for _, m := range matches {
+		if c, ok := s.chunks[m.ID]; ok {
+			hits = append(hits, Hit{Chunk: c, Score: m.Score})
+		}
+	}
+	return hits, nil
+}
+
+// Len returns the number of indexed chunks
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.order)
+}
+
+// Save writes the chunks and their vectors, so that a store can be loaded
+// without embedding its documents again
+func (s *Store) Save(w io.Writer) error {
+	s.mu.RLock()
+	chunks := make([]Chunk, len(s.order))
+	for i, id := range s.order {
+		chunks[i] = s.chunks[id]
+	}
+	s.mu.RUnlock()
+
+	if err := gob.NewEncoder(w).Encode(chunks); err != nil {
+		return fmt.Errorf("saving vector store: %w", err)
+	}
+	return nil
+}
+
+// Load adds the chunks written by Save to the store, indexing them in the
+// store's Index
+func (s *Store) Load(r io.Reader) error {
+	var chunks []Chunk
+	if err := gob.NewDecoder(r).Decode(&chunks); err != nil {
+		return fmt.Errorf("loading vector store: %w", err)
+	}
+	return s.addChunks(chunks)
+}
+
+// SaveFile saves the store to path
+func (s *Store) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saving vector store: %w", err)
+	}
+	if err := s.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile loads a store saved with SaveFile
+func (s *Store) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("loading vector store: %w", err)
+	}
+	defer f.Close()
+	return s.Load(f)
+}
+
+// FormatHits renders hits as plain text for an LLM, one numbered passage per
+// hit with its source
+func FormatHits(hits []Hit) string {
+	var sb strings.Builder
+	for i, h := range hits {
+		source := h.Chunk.Metadata["source"]
+		if source == "" {
+			source = h.Chunk.DocID
+		}
+		fmt.Fprintf(&sb, "%d. %s (score %.2f)\n%s\n\n", i+1, source, h.Score, strings.TrimSpace(h.Chunk.Text))
+	}
+	return strings.TrimSpace(sb.String())
+}
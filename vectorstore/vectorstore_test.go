@@ -0,0 +1,214 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	agent "github.com/utkarsh-cpu/go_agent"
+	"github.com/utkarsh-cpu/go_agent/contextbudget"
+)
+
+var wordTokenizer = contextbudget.TokenizerFunc(func(text string) int {
+	return len(strings.Fields(text))
+})
+
+func randomVectors(n, dim int, rng *rand.Rand) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		items[i] = Item{ID: fmt.Sprint(i), Vector: v}
+	}
+	return items
+}
+
+func TestFlat_RanksBySimilarity(t *testing.T) {
+	f := NewFlat()
+	f.Add(
+		Item{ID: "x", Vector: []float32{1, 0}},
+		Item{ID: "diag", Vector: []float32{1, 1}},
+		Item{ID: "y", Vector: []float32{0, 3}},
+	)
+	got, err := f.Search([]float32{0, 1}, 2)
+	if err != nil {
+		t.Fatalf("Search error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "y" || got[1].ID != "diag" {
+		t.Errorf("Search() = %+v, want y then diag", got)
+	}
+	if err := f.Add(Item{ID: "x", Vector: []float32{1, 0}}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("duplicate Add error = %v, want ErrDuplicateID", err)
+	}
+	if err := f.Add(Item{ID: "z", Vector: []float32{1, 0, 0}}); err == nil {
+		t.Error("expected an error for a vector of the wrong dimension")
+	}
+}
+
+func TestHNSW_RecallMatchesFlat(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	items := randomVectors(1000, 16, rng)
+	flat, hnsw := NewFlat(), NewHNSW()
+	if err := flat.Add(items...); err != nil {
+		t.Fatal(err)
+	}
+	if err := hnsw.Add(items...); err != nil {
+		t.Fatal(err)
+	}
+
+	const k, queries = 10, 50
+	found := 0
+	for _, q := range randomVectors(queries, 16, rng) {
+		want, _ := flat.Search(q.Vector, k)
+		got, _ := hnsw.Search(q.Vector, k)
+		ids := make(map[string]bool)
+		for _, m := range got {
+			ids[m.ID] = true
+		}
+		for _, m := range want {
+			if ids[m.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / (k * queries); recall < 0.9 {
+		t.Errorf("HNSW recall = %.2f, want >= 0.9", recall)
+	}
+}
+
+func TestChunker_SplitsWithOverlap(t *testing.T) {
+	doc := Document{ID: "doc", Text: "one two three\n\nfour five six\n\nseven eight nine\n\nten"}
+	chunks := Chunker{Size: 6, Overlap: 3, Tokenizer: wordTokenizer}.Split(doc)
+
+	want := []string{
+		"one two three\n\nfour five six",
+		"four five six\n\nseven eight nine",
+		"seven eight nine\n\nten",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks %+v, want %d", len(chunks), chunks, len(want))
+	}
+	for i, c := range chunks {
+		if c.Text != want[i] {
+			t.Errorf("chunk %d = %q, want %q", i, c.Text, want[i])
+		}
+		if c.ID != fmt.Sprintf("doc#%d", i) || c.DocID != "doc" {
+			t.Errorf("chunk %d has ID %q, DocID %q", i, c.ID, c.DocID)
+		}
+	}
+}
+
+func TestChunker_SplitsLongParagraphs(t *testing.T) {
+	doc := Document{ID: "doc", Text: strings.Repeat("word ", 25)}
+	chunks := Chunker{Size: 10, Tokenizer: wordTokenizer}.Split(doc)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	for _, c := range chunks {
+		if n := wordTokenizer.Count(c.Text); n > 10 {
+			t.Errorf("chunk %q has %d tokens, want <= 10", c.ID, n)
+		}
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"bees.md":     {Data: []byte("Bees collect nectar and pollen from flowers.")},
+		"rust.md":     {Data: []byte("Rust programs are compiled ahead of time.")},
+		"notes/x.txt": {Data: []byte("Ignored because it is not markdown.")},
+	}
+	docs, err := ReadDocuments(fsys, "*.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("read %d documents, want 2", len(docs))
+	}
+	store := NewStore(HashEmbedder{}, nil)
+	if err := store.AddDocuments(context.Background(), docs...); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore_QueryAndPersist(t *testing.T) {
+	store := newTestStore(t)
+	hits, err := store.Query(context.Background(), "what do bees collect", 1)
+	if err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+	if len(hits) != 1 || hits[0].Chunk.DocID != "bees.md" {
+		t.Fatalf("Query() = %+v, want the bees document", hits)
+	}
+
+	var buf bytes.Buffer
+	if err := store.Save(&buf); err != nil {
+		t.Fatalf("Save error = %v", err)
+	}
+	loaded := NewStore(HashEmbedder{}, NewHNSW())
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if loaded.Len() != store.Len() {
+		t.Fatalf("loaded %d chunks, want %d", loaded.Len(), store.Len())
+	}
+	hits, _ = loaded.Query(context.Background(), "compiled programs", 1)
+	if len(hits) != 1 || hits[0].Chunk.DocID != "rust.md" {
+		t.Errorf("Query() after Load = %+v, want the rust document", hits)
+	}
+}
+
+func TestRetrieveNode_InFlow(t *testing.T) {
+	retrieve := NewRetrieveNode(newTestStore(t), 1)
+	shared := map[string]interface{}{"search_query": "nectar from flowers", "context": "earlier"}
+
+	action := agent.NewFlow(retrieve).Run(shared)
+	if action != DefaultAction {
+		t.Errorf("action = %v, want %q", action, DefaultAction)
+	}
+	hits, _ := shared["retrieved"].([]Hit)
+	if len(hits) != 1 || hits[0].Chunk.DocID != "bees.md" {
+		t.Errorf("retrieved = %+v", shared["retrieved"])
+	}
+	context := shared["context"].(string)
+	if !strings.HasPrefix(context, "earlier\n\nRETRIEVED: nectar from flowers") || !strings.Contains(context, "Bees collect nectar") {
+		t.Errorf("context = %q", context)
+	}
+}
+
+func TestRetrieveNode_ReportsFailures(t *testing.T) {
+	calls := 0
+	failing := EmbedderFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+		calls++
+		return nil, errors.New("embedding service down")
+	})
+	retrieve := NewRetrieveNode(NewStore(failing, nil), 1)
+	retrieve.Node = agent.NewNode(2, 0)
+	shared := map[string]interface{}{"search_query": "nectar"}
+
+	if action := agent.NewFlow(retrieve).Run(shared); action != "error" {
+		t.Errorf("action = %v, want error", action)
+	}
+	if calls != 2 {
+		t.Errorf("embedder calls = %d, want 2 with the failure retried", calls)
+	}
+	if msg, _ := shared["error"].(string); !strings.Contains(msg, "embedding service down") {
+		t.Errorf("error = %v", shared["error"])
+	}
+	if _, ok := shared["retrieved"]; ok {
+		t.Errorf("retrieved = %v, want no hits after a failure", shared["retrieved"])
+	}
+
+	shared = map[string]interface{}{}
+	if action := agent.NewFlow(NewRetrieveNode(newTestStore(t), 1)).Run(shared); action != "error" {
+		t.Errorf("action without a query = %v, want error", action)
+	}
+}